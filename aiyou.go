@@ -5,6 +5,7 @@ package aiyou
 import (
 	"context"
 	"io"
+	"net/http"
 	"time"
 
 	internal "github.com/chrlesur/aiyou.golib/pkg/aiyou"
@@ -17,18 +18,83 @@ type (
 	ClientOption      = internal.ClientOption
 	MessageBuilder    = internal.MessageBuilder
 	StreamReader      = internal.StreamReader
+	StreamEvent       = internal.StreamEvent  // Événement Server-Sent Events brut (type, ID, données)
+	StreamResult      = internal.StreamResult // Chunk ou erreur livré par StreamReader.Chunks
+	StreamAccumulator = internal.StreamAccumulator
+	ChatOption        = internal.ChatOption // Option de requête pour CreateChatCompletion
 	RateLimiter       = internal.RateLimiter
 	RateLimiterConfig = internal.RateLimiterConfig
+	Config            = internal.Config // Configuration déclarative (fichier YAML/JSON, environnement)
 
 	// Interfaces fondamentales
-	Authenticator = internal.Authenticator // Interface pour l'authentification (JWT ou Bearer)
-	Logger        = internal.Logger        // Interface pour le logging personnalisé
+	Authenticator            = internal.Authenticator            // Interface pour l'authentification (JWT ou Bearer)
+	RefreshableAuthenticator = internal.RefreshableAuthenticator // Authentification renouvelable après un 401
+	Logger                   = internal.Logger                   // Interface pour le logging personnalisé
+
+	// Cache de tokens JWT
+	TokenStore       = internal.TokenStore       // Persistance des tokens entre deux exécutions
+	StoredToken      = internal.StoredToken      // Token mis en cache avec son expiration
+	MemoryTokenStore = internal.MemoryTokenStore // Cache en mémoire
+	FileTokenStore   = internal.FileTokenStore   // Cache fichier (permissions 0600)
+
+	// Fournisseurs d'identifiants
+	Credentials                  = internal.Credentials
+	CredentialsProvider          = internal.CredentialsProvider
+	StaticCredentialsProvider    = internal.StaticCredentialsProvider
+	EnvCredentialsProvider       = internal.EnvCredentialsProvider       // AIYOU_TOKEN, AIYOU_EMAIL, AIYOU_PASSWORD
+	ProfileCredentialsProvider   = internal.ProfileCredentialsProvider   // Profils de ~/.aiyou.json
+	TokenFileCredentialsProvider = internal.TokenFileCredentialsProvider // Fichier de token relu à chaque modification
+	ChainCredentialsProvider     = internal.ChainCredentialsProvider
 
 	// Structures de messages et contenus
 	Message       = internal.Message     // Représente un message dans la conversation
 	ContentPart   = internal.ContentPart // Partie de contenu d'un message (texte, image, etc.)
+	ImageURL      = internal.ImageURL    // Image par URL ou data URI
+	FileContent   = internal.FileContent // Document joint (PDF, texte, ...)
 	StreamOptions = internal.StreamOptions
 
+	// Outils et appels de fonctions
+	Tool               = internal.Tool
+	FunctionDefinition = internal.FunctionDefinition
+	ToolCall           = internal.ToolCall
+	FunctionCall       = internal.FunctionCall
+	ToolChoice         = internal.ToolChoice
+	ToolHandler        = internal.ToolHandler
+	ToolRegistry       = internal.ToolRegistry // Associe des noms d'outils à des fonctions Go
+	JSONSchema         = internal.JSONSchema
+
+	// Agent
+	Agent         = internal.Agent // Boucle appel du modèle → exécution des outils
+	AgentOption   = internal.AgentOption
+	AgentStep     = internal.AgentStep
+	AgentResult   = internal.AgentResult
+	ToolCallTrace = internal.ToolCallTrace
+	ApprovalFunc  = internal.ApprovalFunc
+
+	// Sessions de conversation
+	Session       = internal.Session // Historique multi-tours, prompt système et thread
+	SessionOption = internal.SessionOption
+
+	// Résumé glissant des longues conversations
+	Summarizer       = internal.Summarizer // Condense les messages anciens en un résumé
+	SummarizerOption = internal.SummarizerOption
+
+	// Fenêtre de contexte
+	Tokenizer          = internal.Tokenizer // Compteur de tokens interchangeable
+	TokenizerFunc      = internal.TokenizerFunc
+	ContextWindow      = internal.ContextWindow // Troncature des requêtes trop longues
+	TruncationStrategy = internal.TruncationStrategy
+
+	// Batch de requêtes
+	BatchOptions  = internal.BatchOptions
+	BatchProgress = internal.BatchProgress
+	BatchResult   = internal.BatchResult
+	BatchError    = internal.BatchError // Requêtes en échec d'un batch
+
+	// Réponses JSON structurées
+	JSONOption      = internal.JSONOption
+	JSONOutputError = internal.JSONOutputError // JSON invalide après toutes les tentatives
+
 	// Structures d'authentification
 	LoginRequest  = internal.LoginRequest  // Requête d'authentification par email/mot de passe
 	LoginResponse = internal.LoginResponse // Réponse contenant le token JWT
@@ -72,6 +138,19 @@ type (
 	RateLimitError      = internal.RateLimitError      // Erreurs de limitation de débit
 	NetworkError        = internal.NetworkError        // Erreurs réseau
 
+	// Politique de retry
+	RetryPolicy        = internal.RetryPolicy        // Décide si et quand une requête échouée est retentée
+	RetryAttempt       = internal.RetryAttempt       // État d'une tentative échouée
+	ExponentialBackoff = internal.ExponentialBackoff // Backoff exponentiel avec jitter
+	JitterMode         = internal.JitterMode
+
+	// Configuration du transport HTTP
+	TimeoutConfig = internal.TimeoutConfig // Délais de connexion, TLS, en-têtes et connexions inactives
+
+	// Interception des requêtes HTTP
+	Middleware       = internal.Middleware       // Enveloppe le transport HTTP du client
+	RoundTripperFunc = internal.RoundTripperFunc // Adapte une fonction en http.RoundTripper
+
 	// Types de log
 	LogLevel = internal.LogLevel
 )
@@ -84,8 +163,67 @@ const (
 	ERROR = internal.ERROR // Niveau de log pour les erreurs
 )
 
+// Types de contenu et niveaux de détail des images
+const (
+	ContentTypeText     = internal.ContentTypeText
+	ContentTypeImageURL = internal.ContentTypeImageURL
+	ContentTypeFile     = internal.ContentTypeFile
+
+	ImageDetailAuto = internal.ImageDetailAuto
+	ImageDetailLow  = internal.ImageDetailLow
+	ImageDetailHigh = internal.ImageDetailHigh
+
+	MaxImageFileSize = internal.MaxImageFileSize // Taille maximale d'une image locale
+	MaxFileSize      = internal.MaxFileSize      // Taille maximale d'un document local
+)
+
+// Rôles des messages et constantes des outils
+const (
+	RoleSystem    = internal.RoleSystem
+	RoleUser      = internal.RoleUser
+	RoleAssistant = internal.RoleAssistant
+	RoleTool      = internal.RoleTool
+
+	ToolTypeFunction         = internal.ToolTypeFunction
+	ToolChoiceAuto           = internal.ToolChoiceAuto
+	ToolChoiceNone           = internal.ToolChoiceNone
+	ToolChoiceRequired       = internal.ToolChoiceRequired
+	FinishReasonToolCalls    = internal.FinishReasonToolCalls
+	DefaultAgentMaxSteps     = internal.DefaultAgentMaxSteps
+	DefaultJSONRetries       = internal.DefaultJSONRetries
+	DefaultSummaryThreshold  = internal.DefaultSummaryThreshold
+	DefaultSummaryKeepRecent = internal.DefaultSummaryKeepRecent
+	DefaultBatchConcurrency  = internal.DefaultBatchConcurrency
+)
+
+// Stratégies de réduction de la fenêtre de contexte
+const (
+	DropOldest                      = internal.DropOldest
+	KeepSystemAndLastN              = internal.KeepSystemAndLastN
+	SummarizeOlder                  = internal.SummarizeOlder
+	DefaultReservedCompletionTokens = internal.DefaultReservedCompletionTokens
+)
+
+// Modes de jitter pour ExponentialBackoff
+const (
+	NoJitter           = internal.NoJitter
+	FullJitter         = internal.FullJitter
+	DecorrelatedJitter = internal.DecorrelatedJitter
+)
+
 // Variables exportées
-var SupportedFormats = internal.SupportedFormats // Formats audio supportés
+var (
+	SupportedFormats     = internal.SupportedFormats     // Formats audio supportés
+	ErrStreamReadTimeout = internal.ErrStreamReadTimeout // Flux interrompu faute de données
+	ErrNoCredentials     = internal.ErrNoCredentials     // Aucun fournisseur n'a trouvé d'identifiants
+	ErrStreamTruncated   = internal.ErrStreamTruncated   // Flux terminé sans [DONE] ni finish_reason
+	ErrMalformedChunk    = internal.ErrMalformedChunk    // Chunk JSON invalide (mode strict)
+	ErrUnknownTool       = internal.ErrUnknownTool       // Appel d'un outil non enregistré
+	ErrMaxStepsReached   = internal.ErrMaxStepsReached   // Agent arrêté après le nombre maximal d'étapes
+	ErrNoJSON            = internal.ErrNoJSON            // Aucun JSON dans la réponse
+	ErrContextTooLarge   = internal.ErrContextTooLarge   // Requête trop longue même après troncature
+	DefaultTokenizer     = internal.DefaultTokenizer     // Estimation du nombre de tokens sans dépendance
+)
 
 // NewClient crée un nouveau client AI.YOU
 // Supporte deux méthodes d'authentification :
@@ -119,6 +257,27 @@ func NewImageMessage(role, imageURL string) Message {
 	return internal.NewImageMessage(role, imageURL)
 }
 
+// Fonctions de création de parties de contenu
+func NewTextPart(text string) ContentPart {
+	return internal.NewTextPart(text)
+}
+
+func NewImageURLPart(url, detail string) ContentPart {
+	return internal.NewImageURLPart(url, detail)
+}
+
+func NewImageFilePart(path, detail string) (ContentPart, error) {
+	return internal.NewImageFilePart(path, detail)
+}
+
+func NewFilePart(path string) (ContentPart, error) {
+	return internal.NewFilePart(path)
+}
+
+func NewFileIDPart(fileID string) ContentPart {
+	return internal.NewFileIDPart(fileID)
+}
+
 // Fonctions utilitaires de sécurité et logging
 func MaskSensitiveInfo(input string) string {
 	return internal.MaskSensitiveInfo(input)
@@ -155,6 +314,192 @@ func WithRetry(maxRetries int, initialDelay time.Duration) ClientOption {
 	return internal.WithRetry(maxRetries, initialDelay)
 }
 
+// WithRetryPolicy configure la politique de retry du client
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return internal.WithRetryPolicy(policy)
+}
+
+// DefaultRetryPolicy retourne la politique de retry utilisée par défaut
+func DefaultRetryPolicy() *ExponentialBackoff {
+	return internal.DefaultRetryPolicy()
+}
+
+// ContextWithRetryPolicy surcharge la politique de retry pour les requêtes utilisant ce contexte
+func ContextWithRetryPolicy(ctx context.Context, policy RetryPolicy) context.Context {
+	return internal.ContextWithRetryPolicy(ctx, policy)
+}
+
+// WithTokenRefreshSkew configure la marge de renouvellement anticipé du token JWT
+func WithTokenRefreshSkew(skew time.Duration) ClientOption {
+	return internal.WithTokenRefreshSkew(skew)
+}
+
+// WithTokenStore configure le cache persistant des tokens JWT
+func WithTokenStore(store TokenStore) ClientOption {
+	return internal.WithTokenStore(store)
+}
+
+// NewFileTokenStore crée un cache de tokens fichier dans dir (répertoire de configuration utilisateur si vide)
+func NewFileTokenStore(dir string) (*FileTokenStore, error) {
+	return internal.NewFileTokenStore(dir)
+}
+
+// NewMemoryTokenStore crée un cache de tokens en mémoire
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return internal.NewMemoryTokenStore()
+}
+
+// NewClientFromConfig crée un client à partir d'une configuration déclarative
+func NewClientFromConfig(cfg *Config, options ...ClientOption) (*Client, error) {
+	return internal.NewClientFromConfig(cfg, options...)
+}
+
+// LoadConfig charge un fichier de configuration (path ou $AIYOU_CONFIG) puis applique l'environnement
+func LoadConfig(path, profile string) (*Config, error) {
+	return internal.LoadConfig(path, profile)
+}
+
+// LoadConfigFile charge un fichier de configuration YAML ou JSON avec le profil donné
+func LoadConfigFile(path, profile string) (*Config, error) {
+	return internal.LoadConfigFile(path, profile)
+}
+
+// LoadConfigFromEnv crée une configuration à partir des variables d'environnement
+func LoadConfigFromEnv() (*Config, error) {
+	return internal.LoadConfigFromEnv()
+}
+
+// ParseLogLevel convertit un nom de niveau ("debug", "info", "warn", "error") en LogLevel
+func ParseLogLevel(name string) (LogLevel, error) {
+	return internal.ParseLogLevel(name)
+}
+
+// WithCredentialsProvider configure le fournisseur d'identifiants du client
+func WithCredentialsProvider(provider CredentialsProvider) ClientOption {
+	return internal.WithCredentialsProvider(provider)
+}
+
+// NewChainCredentialsProvider crée une chaîne de fournisseurs interrogés dans l'ordre
+func NewChainCredentialsProvider(providers ...CredentialsProvider) *ChainCredentialsProvider {
+	return internal.NewChainCredentialsProvider(providers...)
+}
+
+// DefaultCredentialsChain retourne la chaîne standard : fournisseurs explicites,
+// environnement, profil ~/.aiyou.json puis $AIYOU_TOKEN_FILE
+func DefaultCredentialsChain(explicit ...CredentialsProvider) *ChainCredentialsProvider {
+	return internal.DefaultCredentialsChain(explicit...)
+}
+
+// Ptr retourne un pointeur vers v, pour les champs optionnels des requêtes
+func Ptr[T any](v T) *T {
+	return internal.Ptr(v)
+}
+
+// WithModel choisit le modèle utilisé à la place de celui de l'assistant
+func WithModel(model string) ChatOption {
+	return internal.WithModel(model)
+}
+
+// WithTemperature définit la température d'échantillonnage
+func WithTemperature(temperature float64) ChatOption {
+	return internal.WithTemperature(temperature)
+}
+
+// WithTopP définit la probabilité cumulée du nucleus sampling
+func WithTopP(topP float64) ChatOption {
+	return internal.WithTopP(topP)
+}
+
+// WithMaxTokens limite le nombre de tokens générés
+func WithMaxTokens(maxTokens int) ChatOption {
+	return internal.WithMaxTokens(maxTokens)
+}
+
+// WithStop définit les séquences d'arrêt
+func WithStop(stop ...string) ChatOption {
+	return internal.WithStop(stop...)
+}
+
+// WithPromptSystem définit un prompt système personnalisé
+func WithPromptSystem(prompt string) ChatOption {
+	return internal.WithPromptSystem(prompt)
+}
+
+// WithThreadID rattache la requête à un thread existant
+func WithThreadID(threadID string) ChatOption {
+	return internal.WithThreadID(threadID)
+}
+
+// WithTools définit les outils que le modèle peut appeler
+func WithTools(tools ...Tool) ChatOption {
+	return internal.WithTools(tools...)
+}
+
+// WithToolChoice contrôle l'appel des outils
+func WithToolChoice(choice *ToolChoice) ChatOption {
+	return internal.WithToolChoice(choice)
+}
+
+// WithStreamOptions définit les options de streaming
+func WithStreamOptions(options StreamOptions) ChatOption {
+	return internal.WithStreamOptions(options)
+}
+
+// NewStreamAccumulator crée un accumulateur reconstruisant la réponse complète d'un flux
+func NewStreamAccumulator() *StreamAccumulator {
+	return internal.NewStreamAccumulator()
+}
+
+// WithStrictStreaming fait échouer les flux sur un chunk JSON invalide au lieu de l'ignorer
+func WithStrictStreaming(strict bool) ClientOption {
+	return internal.WithStrictStreaming(strict)
+}
+
+// WithMiddleware ajoute des intercepteurs autour de chaque requête HTTP sortante
+func WithMiddleware(middlewares ...Middleware) ClientOption {
+	return internal.WithMiddleware(middlewares...)
+}
+
+// HeaderMiddleware ajoute des en-têtes fixes à chaque requête
+func HeaderMiddleware(headers http.Header) Middleware {
+	return internal.HeaderMiddleware(headers)
+}
+
+// WithHTTPClient remplace le client HTTP utilisé pour toutes les requêtes
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return internal.WithHTTPClient(httpClient)
+}
+
+// WithTransport remplace le http.RoundTripper utilisé pour toutes les requêtes
+func WithTransport(transport http.RoundTripper) ClientOption {
+	return internal.WithTransport(transport)
+}
+
+// WithProxy fait passer les requêtes par un proxy HTTP(S)
+func WithProxy(proxyURL string) ClientOption {
+	return internal.WithProxy(proxyURL)
+}
+
+// WithCACertFile ajoute un bundle d'autorités de certification au format PEM
+func WithCACertFile(path string) ClientOption {
+	return internal.WithCACertFile(path)
+}
+
+// WithClientCertificate configure un certificat client pour le TLS mutuel
+func WithClientCertificate(certFile, keyFile string) ClientOption {
+	return internal.WithClientCertificate(certFile, keyFile)
+}
+
+// WithTimeouts configure les délais du transport HTTP
+func WithTimeouts(timeouts TimeoutConfig) ClientOption {
+	return internal.WithTimeouts(timeouts)
+}
+
+// WithStreamReadTimeout configure le délai maximal sans données sur un flux
+func WithStreamReadTimeout(timeout time.Duration) ClientOption {
+	return internal.WithStreamReadTimeout(timeout)
+}
+
 // Interface du Client définissant toutes les opérations disponibles
 type ClientInterface interface {
 	// Configuration
@@ -162,8 +507,8 @@ type ClientInterface interface {
 	SetLogger(logger Logger)
 
 	// Opérations de chat
-	CreateChatCompletion(ctx context.Context, messages []Message, assistantID string) (*ChatCompletionResponse, error)
-	CreateChatCompletionStream(ctx context.Context, messages []Message, assistantID string) (*StreamReader, error)
+	CreateChatCompletion(ctx context.Context, messages []Message, assistantID string, options ...ChatOption) (*ChatCompletionResponse, error)
+	CreateChatCompletionStream(ctx context.Context, messages []Message, assistantID string, options ...ChatOption) (*StreamReader, error)
 	ChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error)
 	ChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (*StreamReader, error)
 
@@ -184,3 +529,150 @@ type ClientInterface interface {
 
 // Vérification à la compilation que Client implémente ClientInterface
 var _ ClientInterface = (*Client)(nil)
+
+// Fonctions des outils
+func NewFunctionTool(name, description string, parameters interface{}) Tool {
+	return internal.NewFunctionTool(name, description, parameters)
+}
+
+func NewToolChoice(mode string) *ToolChoice {
+	return internal.NewToolChoice(mode)
+}
+
+func ToolChoiceFunction(name string) *ToolChoice {
+	return internal.ToolChoiceFunction(name)
+}
+
+func NewToolMessage(toolCallID, content string) Message {
+	return internal.NewToolMessage(toolCallID, content)
+}
+
+// NewToolRegistry crée un registre d'outils vide
+func NewToolRegistry() *ToolRegistry {
+	return internal.NewToolRegistry()
+}
+
+// RegisterFunc enregistre fn comme outil, avec un schéma généré à partir du type Args
+func RegisterFunc[Args, Result any](r *ToolRegistry, name, description string, fn func(ctx context.Context, args Args) (Result, error)) error {
+	return internal.RegisterFunc(r, name, description, fn)
+}
+
+// SchemaFor génère le schéma JSON du type de v
+func SchemaFor(v interface{}) *JSONSchema {
+	return internal.SchemaFor(v)
+}
+
+// NewAgent crée un agent exécutant la boucle d'appels d'outils
+func NewAgent(client *Client, assistantID, systemPrompt string, tools *ToolRegistry, opts ...AgentOption) *Agent {
+	return internal.NewAgent(client, assistantID, systemPrompt, tools, opts...)
+}
+
+// Options de l'agent
+func WithMaxSteps(maxSteps int) AgentOption {
+	return internal.WithMaxSteps(maxSteps)
+}
+
+func WithRunTimeout(timeout time.Duration) AgentOption {
+	return internal.WithRunTimeout(timeout)
+}
+
+func WithToolTimeout(timeout time.Duration) AgentOption {
+	return internal.WithToolTimeout(timeout)
+}
+
+func WithApproval(approve ApprovalFunc, toolNames ...string) AgentOption {
+	return internal.WithApproval(approve, toolNames...)
+}
+
+func WithAgentChatOptions(opts ...ChatOption) AgentOption {
+	return internal.WithAgentChatOptions(opts...)
+}
+
+func WithStepHook(hook func(AgentStep)) AgentOption {
+	return internal.WithStepHook(hook)
+}
+
+// CompleteJSON demande une réponse JSON conforme au schéma de T et la décode
+func CompleteJSON[T any](ctx context.Context, client *Client, req ChatCompletionRequest, opts ...JSONOption) (T, error) {
+	return internal.CompleteJSON[T](ctx, client, req, opts...)
+}
+
+func WithJSONRetries(retries int) JSONOption {
+	return internal.WithJSONRetries(retries)
+}
+
+func WithJSONSchema(schema *JSONSchema) JSONOption {
+	return internal.WithJSONSchema(schema)
+}
+
+// ExtractJSON retourne le premier document JSON trouvé dans un texte
+func ExtractJSON(text string) ([]byte, error) {
+	return internal.ExtractJSON(text)
+}
+
+// NewSession crée une session de conversation avec un assistant
+func NewSession(client *Client, assistantID string, opts ...SessionOption) *Session {
+	return internal.NewSession(client, assistantID, opts...)
+}
+
+// RestoreSession recrée une session à partir d'une conversation sauvegardée
+func RestoreSession(ctx context.Context, client *Client, threadID string, opts ...SessionOption) (*Session, error) {
+	return internal.RestoreSession(ctx, client, threadID, opts...)
+}
+
+// Options de session
+func WithSystemPrompt(prompt string) SessionOption {
+	return internal.WithSystemPrompt(prompt)
+}
+
+func WithSessionThreadID(threadID string) SessionOption {
+	return internal.WithSessionThreadID(threadID)
+}
+
+func WithHistory(messages ...Message) SessionOption {
+	return internal.WithHistory(messages...)
+}
+
+func WithSessionModel(modelName string) SessionOption {
+	return internal.WithSessionModel(modelName)
+}
+
+func WithSessionChatOptions(opts ...ChatOption) SessionOption {
+	return internal.WithSessionChatOptions(opts...)
+}
+
+func WithSummarizer(summarizer *Summarizer) SessionOption {
+	return internal.WithSummarizer(summarizer)
+}
+
+func WithSessionSummary(summary string) SessionOption {
+	return internal.WithSessionSummary(summary)
+}
+
+// NewSummarizer crée un composant de résumé utilisant un assistant dédié
+func NewSummarizer(client *Client, assistantID string, opts ...SummarizerOption) *Summarizer {
+	return internal.NewSummarizer(client, assistantID, opts...)
+}
+
+// Options du résumé glissant
+func WithSummaryThreshold(messages int) SummarizerOption {
+	return internal.WithSummaryThreshold(messages)
+}
+
+func WithSummaryKeepRecent(messages int) SummarizerOption {
+	return internal.WithSummaryKeepRecent(messages)
+}
+
+// CountMessageTokens estime le nombre de tokens de messages
+func CountMessageTokens(tokenizer Tokenizer, messages ...Message) int {
+	return internal.CountMessageTokens(tokenizer, messages...)
+}
+
+// ContextWindowForModel crée une fenêtre de contexte à partir des propriétés du modèle
+func ContextWindowForModel(model Model, reservedCompletion int, strategy TruncationStrategy) *ContextWindow {
+	return internal.ContextWindowForModel(model, reservedCompletion, strategy)
+}
+
+func WithContextWindow(window *ContextWindow) ClientOption {
+	return internal.WithContextWindow(window)
+}
@@ -57,8 +57,8 @@ func demonstrateNonStreamingMode(client *aiyou.Client, assistantID string, logge
 	req := aiyou.ChatCompletionRequest{
 		Messages:     []aiyou.Message{message},
 		AssistantID:  assistantID,
-		Temperature:  1,
-		TopP:         1.0,
+		Temperature:  aiyou.Ptr(1.0),
+		TopP:         aiyou.Ptr(1.0),
 		Stream:       false,
 		PromptSystem: "", // Explicitement vide
 	}
@@ -97,8 +97,8 @@ func demonstrateStreamingMode(client *aiyou.Client, assistantID string, logger a
 	req := aiyou.ChatCompletionRequest{
 		Messages:    []aiyou.Message{message},
 		AssistantID: assistantID,
-		Temperature: 1,
-		TopP:        1.0,
+		Temperature: aiyou.Ptr(1.0),
+		TopP:        aiyou.Ptr(1.0),
 		Stream:      true,
 	}
 
@@ -18,12 +18,15 @@ along with this program. If not, see <https://www.gnu.org/licenses/>.
 package main
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -47,6 +50,14 @@ var (
 	markdownMode bool
 	quietMode    bool
 
+	// Options de la commande batch
+	batchOutput      string
+	batchConcurrency int
+	batchRate        float64
+	batchBurst       int
+	batchTimeout     time.Duration
+	batchRetryErrors bool
+
 	// Couleurs pour l'interface
 	assistantColor = color.New(color.FgCyan, color.Bold)
 	userColor      = color.New(color.FgGreen)
@@ -108,6 +119,17 @@ var configCmd = &cobra.Command{
 	Run:   manageConfig,
 }
 
+var batchCmd = &cobra.Command{
+	Use:   "batch <requetes.jsonl>",
+	Short: "Exécuter un fichier JSONL de requêtes de chat",
+	Long: `Exécute les requêtes d'un fichier JSONL, une ChatCompletionRequest par ligne
+identifiée par un champ "id" obligatoire (chaîne ou nombre). Les réponses, erreurs
+et statistiques d'usage sont ajoutées au fichier de sortie au fil de l'eau ; relancer
+la commande reprend le traitement en ignorant les identifiants déjà présents.`,
+	Args: cobra.ExactArgs(1),
+	Run:  runBatch,
+}
+
 func init() {
 	cobra.OnInitialize(initConfig)
 
@@ -120,9 +142,17 @@ func init() {
 	rootCmd.PersistentFlags().BoolVar(&markdownMode, "markdown", true, "Active le rendu markdown")
 	rootCmd.PersistentFlags().BoolVar(&quietMode, "quiet", false, "Désactive les messages de statut")
 
+	batchCmd.Flags().StringVarP(&batchOutput, "output", "o", "", "fichier JSONL des résultats (par défaut <entrée>.results.jsonl)")
+	batchCmd.Flags().IntVar(&batchConcurrency, "concurrency", aiyou.DefaultBatchConcurrency, "nombre de requêtes simultanées")
+	batchCmd.Flags().Float64Var(&batchRate, "rate", 0, "nombre maximal de requêtes par seconde (0 = illimité)")
+	batchCmd.Flags().IntVar(&batchBurst, "burst", 1, "taille du burst initial du rate limiting")
+	batchCmd.Flags().DurationVar(&batchTimeout, "timeout", 2*time.Minute, "délai maximal de chaque requête")
+	batchCmd.Flags().BoolVar(&batchRetryErrors, "retry-errors", false, "relance les requêtes en erreur dans le fichier de sortie")
+
 	rootCmd.AddCommand(chatCmd)
 	rootCmd.AddCommand(listCmd)
 	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(batchCmd)
 }
 
 func initConfig() {
@@ -178,7 +208,7 @@ func formatCodeBlocks(markdown string) string {
 	})
 }
 
-func createClient() (*aiyou.Client, error) {
+func createClient(opts ...aiyou.ClientOption) (*aiyou.Client, error) {
 	clientEmail := email
 	if clientEmail == "" {
 		clientEmail = viper.GetString("email")
@@ -192,8 +222,13 @@ func createClient() (*aiyou.Client, error) {
 		clientBaseURL = viper.GetString("base_url")
 	}
 
-	if clientEmail == "" || clientPassword == "" {
-		return nil, fmt.Errorf("email et mot de passe requis")
+	// Les identifiants passés en flags ou dans ~/.aiyou.yaml priment ; sinon la chaîne
+	// par défaut consulte l'environnement, ~/.aiyou.json puis $AIYOU_TOKEN_FILE
+	var explicit []aiyou.CredentialsProvider
+	if clientEmail != "" && clientPassword != "" {
+		explicit = append(explicit, &aiyou.StaticCredentialsProvider{
+			Credentials: aiyou.Credentials{Email: clientEmail, Password: clientPassword},
+		})
 	}
 
 	logger := aiyou.NewDefaultLogger(os.Stderr)
@@ -206,11 +241,11 @@ func createClient() (*aiyou.Client, error) {
 	}
 
 	// Utilisation de la nouvelle méthode de création du client avec options
-	return aiyou.NewClient(
-		aiyou.WithEmailPassword(clientEmail, clientPassword),
+	return aiyou.NewClient(append([]aiyou.ClientOption{
+		aiyou.WithCredentialsProvider(aiyou.DefaultCredentialsChain(explicit...)),
 		aiyou.WithLogger(logger),
 		aiyou.WithBaseURL(clientBaseURL),
-	)
+	}, opts...)...)
 }
 
 func listAssistants(cmd *cobra.Command, args []string) {
@@ -297,7 +332,10 @@ func startChat(cmd *cobra.Command, args []string) {
 		fmt.Fprintln(os.Stderr, strings.Repeat("-", 50))
 	}
 
-	var conversation []aiyou.Message
+	// La session conserve l'historique : chaque tour envoie toute la conversation
+	session := aiyou.NewSession(client, currentAssistantID,
+		aiyou.WithSessionChatOptions(aiyou.WithTemperature(0.7), aiyou.WithTopP(0.95)),
+	)
 	for {
 		line, err := rl.Readline()
 		if err == readline.ErrInterrupt {
@@ -323,22 +361,22 @@ func startChat(cmd *cobra.Command, args []string) {
 				fmt.Fprintln(os.Stderr, "/exit - Quitter")
 				continue
 			case "/clear":
-				conversation = nil
+				session.Reset()
 				fmt.Fprintln(os.Stderr, "Conversation réinitialisée.")
 				continue
 			case "/history":
 				fmt.Fprintln(os.Stderr, "\nHistorique de la conversation:")
-				for _, msg := range conversation {
+				for _, msg := range session.Messages() {
 					if msg.Role == "user" {
-						userColor.Fprintf(os.Stderr, "Vous: %s\n", msg.Content[0].Text)
+						userColor.Fprintf(os.Stderr, "Vous: %s\n", msg.Text())
 					} else {
-						assistantColor.Fprintf(os.Stderr, "Assistant: %s\n", msg.Content[0].Text)
+						assistantColor.Fprintf(os.Stderr, "Assistant: %s\n", msg.Text())
 					}
 				}
 				continue
 			case "/save":
 				filename := fmt.Sprintf("conversation_%s.json", time.Now().Format("20060102_150405"))
-				data, err := json.MarshalIndent(conversation, "", " ")
+				data, err := json.MarshalIndent(session.Messages(), "", " ")
 				if err != nil {
 					errorColor.Fprintf(os.Stderr, "Erreur lors de la sauvegarde: %v\n", err)
 				} else if err := os.WriteFile(filename, data, 0644); err != nil {
@@ -352,31 +390,11 @@ func startChat(cmd *cobra.Command, args []string) {
 
 		userColor.Fprintf(os.Stderr, "\nVous: %s\n", line)
 
-		userMsg := aiyou.NewTextMessage("user", line)
-		conversation = append(conversation, userMsg)
-
 		spinnerDone := make(chan bool)
 		go showSpinner(spinnerDone)
 
 		ctx := context.Background()
-		req := aiyou.ChatCompletionRequest{
-			Messages: []aiyou.Message{
-				{
-					Role: "user",
-					Content: []aiyou.ContentPart{
-						{
-							Type: "text",
-							Text: line,
-						},
-					},
-				},
-			},
-			AssistantID: currentAssistantID,
-			Stream:      true,
-			Temperature: 0.7, // Changé pour utiliser une valeur flottante entre 0 et 1
-			TopP:        0.95,
-		}
-		stream, err := client.ChatCompletionStream(ctx, req)
+		stream, err := session.Stream(ctx, line)
 		if err != nil {
 			close(spinnerDone)
 			errorColor.Fprintf(os.Stderr, "Erreur: %v\n", err)
@@ -427,10 +445,8 @@ func startChat(cmd *cobra.Command, args []string) {
 			// Déjà affiché en streaming
 			fmt.Fprintf(os.Stderr, "\n")
 		}
-
-		// Ajouter la réponse à la conversation
-		assistantMsg := aiyou.NewTextMessage("assistant", fullResponse.String())
-		conversation = append(conversation, assistantMsg)
+		// La question et la réponse sont ajoutées à la session une fois le flux lu en entier
+		stream.Close()
 	}
 }
 
@@ -466,6 +482,264 @@ func manageConfig(cmd *cobra.Command, args []string) {
 	}
 }
 
+// batchRequest est une requête du fichier d'entrée de la commande batch
+type batchRequest struct {
+	ID      string
+	Request aiyou.ChatCompletionRequest
+}
+
+// batchResultLine est une ligne du fichier de sortie de la commande batch
+type batchResultLine struct {
+	ID         string                        `json:"id"`
+	Response   *aiyou.ChatCompletionResponse `json:"response,omitempty"`
+	Error      string                        `json:"error,omitempty"`
+	Usage      *aiyou.Usage                  `json:"usage,omitempty"`
+	DurationMs int64                         `json:"duration_ms"`
+}
+
+func runBatch(cmd *cobra.Command, args []string) {
+	input := args[0]
+	output := batchOutput
+	if output == "" {
+		output = strings.TrimSuffix(input, filepath.Ext(input)) + ".results.jsonl"
+	}
+
+	defaultAssistant := assistantID
+	if defaultAssistant == "" {
+		defaultAssistant = viper.GetString("assistant_id")
+	}
+	requests, err := readBatchRequests(input, defaultAssistant)
+	if err != nil {
+		errorColor.Fprintf(os.Stderr, "Erreur lors de la lecture des requêtes: %v\n", err)
+		return
+	}
+	completed, err := readCompletedIDs(output, batchRetryErrors)
+	if err != nil {
+		errorColor.Fprintf(os.Stderr, "Erreur lors de la lecture des résultats existants: %v\n", err)
+		return
+	}
+
+	var pending []batchRequest
+	for _, req := range requests {
+		if !completed[req.ID] {
+			pending = append(pending, req)
+		}
+	}
+	skipped := len(requests) - len(pending)
+	if !quietMode {
+		infoColor.Fprintf(os.Stderr, "%d requêtes, %d déjà traitées, %d à exécuter → %s\n", len(requests), skipped, len(pending), output)
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	var opts []aiyou.ClientOption
+	if batchRate > 0 {
+		opts = append(opts, aiyou.WithRateLimiter(aiyou.RateLimiterConfig{
+			RequestsPerSecond: batchRate,
+			BurstSize:         max(batchBurst, 1),
+		}))
+	}
+	client, err := createClient(opts...)
+	if err != nil {
+		errorColor.Fprintf(os.Stderr, "Erreur lors de la création du client: %v\n", err)
+		return
+	}
+
+	out, err := openResultsFile(output)
+	if err != nil {
+		errorColor.Fprintf(os.Stderr, "Erreur lors de l'ouverture du fichier de sortie: %v\n", err)
+		return
+	}
+	defer out.Close()
+
+	// Ctrl+C interrompt le batch ; les requêtes non terminées seront reprises
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	reqs := make([]aiyou.ChatCompletionRequest, len(pending))
+	for i, req := range pending {
+		reqs[i] = req.Request
+	}
+
+	var succeeded, failed int
+	var usage aiyou.Usage
+	var writeErr error
+	start := time.Now()
+
+	client.BatchChatCompletion(ctx, reqs, aiyou.BatchOptions{
+		Concurrency: batchConcurrency,
+		ItemTimeout: batchTimeout,
+		OnProgress: func(p aiyou.BatchProgress) {
+			result := p.Last
+			if result.Err != nil && ctx.Err() != nil && errors.Is(result.Err, ctx.Err()) {
+				return // interrompue : sera reprise au prochain lancement
+			}
+
+			line := batchResultLine{ID: pending[result.Index].ID, DurationMs: result.Duration.Milliseconds()}
+			if result.Err != nil {
+				line.Error = result.Err.Error()
+				failed++
+			} else {
+				line.Response = result.Response
+				line.Usage = result.Response.Usage
+				succeeded++
+				if u := result.Response.Usage; u != nil {
+					usage.PromptTokens += u.PromptTokens
+					usage.CompletionTokens += u.CompletionTokens
+					usage.TotalTokens += u.TotalTokens
+				}
+			}
+
+			if err := writeResultLine(out, line); err != nil && writeErr == nil {
+				writeErr = err
+				cancel()
+			}
+			if !quietMode {
+				fmt.Fprintf(os.Stderr, "\r%d/%d requêtes (%d en échec)", p.Done, p.Total, failed)
+			}
+		},
+	})
+	if !quietMode {
+		fmt.Fprintln(os.Stderr)
+	}
+
+	if writeErr != nil {
+		errorColor.Fprintf(os.Stderr, "Erreur lors de l'écriture des résultats: %v\n", writeErr)
+	}
+	if remaining := len(pending) - succeeded - failed; remaining > 0 {
+		infoColor.Fprintf(os.Stderr, "Batch interrompu : %d requêtes restantes, relancez la commande pour reprendre\n", remaining)
+	}
+	infoColor.Fprintf(os.Stderr, "Terminé en %v : %d réussies, %d en échec, %d déjà traitées\n",
+		time.Since(start).Round(time.Millisecond), succeeded, failed, skipped)
+	infoColor.Fprintf(os.Stderr, "Tokens : %d (prompt %d, completion %d)\n",
+		usage.TotalTokens, usage.PromptTokens, usage.CompletionTokens)
+}
+
+// readBatchRequests lit les requêtes du fichier JSONL d'entrée
+func readBatchRequests(path, defaultAssistant string) ([]batchRequest, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var requests []batchRequest
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		data := scanner.Bytes()
+		if strings.TrimSpace(string(data)) == "" {
+			continue
+		}
+
+		var header struct {
+			ID json.RawMessage `json:"id"`
+		}
+		req := batchRequest{}
+		if err := json.Unmarshal(data, &header); err != nil {
+			return nil, fmt.Errorf("ligne %d: %w", lineNumber, err)
+		}
+		if err := json.Unmarshal(data, &req.Request); err != nil {
+			return nil, fmt.Errorf("ligne %d: %w", lineNumber, err)
+		}
+
+		id, err := parseBatchID(header.ID)
+		if err != nil {
+			return nil, fmt.Errorf("ligne %d: %w", lineNumber, err)
+		}
+		req.ID = id
+		if seen[req.ID] {
+			return nil, fmt.Errorf("ligne %d: identifiant %q en double", lineNumber, req.ID)
+		}
+		seen[req.ID] = true
+
+		if req.Request.AssistantID == "" {
+			req.Request.AssistantID = defaultAssistant
+		}
+		requests = append(requests, req)
+	}
+	return requests, scanner.Err()
+}
+
+// parseBatchID décode l'identifiant d'une requête, qui peut être une chaîne
+// ou un nombre
+func parseBatchID(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", errors.New("identifiant manquant")
+	}
+	var id string
+	if err := json.Unmarshal(raw, &id); err == nil {
+		if id == "" {
+			return "", errors.New("identifiant vide")
+		}
+		return id, nil
+	}
+	var number json.Number
+	if err := json.Unmarshal(raw, &number); err != nil {
+		return "", fmt.Errorf("identifiant invalide %s : une chaîne ou un nombre est attendu", raw)
+	}
+	return number.String(), nil
+}
+
+// readCompletedIDs retourne les identifiants déjà présents dans le fichier de
+// sortie ; avec retryErrors, seuls ceux ayant une réponse sont retenus
+func readCompletedIDs(path string, retryErrors bool) (map[string]bool, error) {
+	completed := make(map[string]bool)
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return completed, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var line batchResultLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil || line.ID == "" {
+			continue // ligne tronquée par une interruption
+		}
+		if line.Error == "" || !retryErrors {
+			completed[line.ID] = true
+		}
+	}
+	return completed, scanner.Err()
+}
+
+// openResultsFile ouvre le fichier de sortie en ajout, en terminant une
+// éventuelle dernière ligne interrompue
+func openResultsFile(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := file.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := file.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			file.Write([]byte{'\n'})
+		}
+	}
+	return file, nil
+}
+
+// writeResultLine ajoute une ligne au fichier de sortie
+func writeResultLine(w io.Writer, line batchResultLine) error {
+	data, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
 func main() {
 	if err := rootCmd.Execute(); err != nil {
 		errorColor.Fprintln(os.Stderr, err)
@@ -0,0 +1,64 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadBatchRequests(t *testing.T) {
+	write := func(t *testing.T, lines ...string) string {
+		path := filepath.Join(t.TempDir(), "requetes.jsonl")
+		if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0600); err != nil {
+			t.Fatalf("Failed to write requests: %v", err)
+		}
+		return path
+	}
+
+	path := write(t,
+		`{"id":"a\"b","messages":[{"role":"user","content":"un"}]}`,
+		`{"id":42,"assistantId":"autre","messages":[{"role":"user","content":"deux"}]}`,
+	)
+	requests, err := readBatchRequests(path, "287")
+	if err != nil {
+		t.Fatalf("readBatchRequests failed: %v", err)
+	}
+	if len(requests) != 2 || requests[0].ID != `a"b` || requests[1].ID != "42" {
+		t.Fatalf("Unexpected requests: %+v", requests)
+	}
+	if requests[0].Request.AssistantID != "287" || requests[1].Request.AssistantID != "autre" {
+		t.Errorf("Unexpected assistants: %q, %q", requests[0].Request.AssistantID, requests[1].Request.AssistantID)
+	}
+
+	invalid := map[string]string{
+		"Missing id":   `{"messages":[{"role":"user","content":"un"}]}`,
+		"Null id":      `{"id":null,"messages":[{"role":"user","content":"un"}]}`,
+		"Empty id":     `{"id":"","messages":[{"role":"user","content":"un"}]}`,
+		"Object id":    `{"id":{},"messages":[{"role":"user","content":"un"}]}`,
+		"Duplicate id": `{"id":1,"messages":[]}` + "\n" + `{"id":"1","messages":[]}`,
+	}
+	for name, content := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if _, err := readBatchRequests(write(t, content), "287"); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
@@ -364,8 +364,8 @@ func startChat(cmd *cobra.Command, args []string) {
 			},
 			AssistantID: currentAssistantID,
 			Stream:      true,
-			Temperature: 0.7, // Changé pour utiliser une valeur flottante entre 0 et 1
-			TopP:        0.95,
+			Temperature: aiyou.Ptr(0.7),
+			TopP:        aiyou.Ptr(0.95),
 		}
 		stream, err := client.ChatCompletionStream(ctx, req)
 		if err != nil {
@@ -0,0 +1,146 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// File: pkg/aiyou/accumulator.go
+
+package aiyou
+
+import (
+	"io"
+	"sort"
+	"strings"
+)
+
+// StreamAccumulator reconstruit une réponse complète à partir des chunks d'un
+// flux : tous les choix avec leur rôle, leur contenu, leurs appels d'outils et leur finish_reason,
+// ainsi que l'usage, le modèle et la date de création. La réponse obtenue a
+// la même forme qu'une réponse non-streaming.
+type StreamAccumulator struct {
+	id      string
+	created int64
+	model   string
+	usage   *Usage
+	choices map[int]*accumulatedChoice
+}
+
+// accumulatedChoice contient l'état d'un choix en cours de reconstruction.
+type accumulatedChoice struct {
+	role         string
+	content      strings.Builder
+	toolCalls    toolCallAssembler
+	finishReason string
+}
+
+// NewStreamAccumulator crée un accumulateur vide.
+func NewStreamAccumulator() *StreamAccumulator {
+	return &StreamAccumulator{choices: make(map[int]*accumulatedChoice)}
+}
+
+// Add intègre un chunk du flux. Les chunks nil sont ignorés.
+func (a *StreamAccumulator) Add(chunk *ChatCompletionResponse) {
+	if chunk == nil {
+		return
+	}
+	if a.id == "" {
+		a.id = chunk.ID
+	}
+	if a.created == 0 {
+		a.created = chunk.Created
+	}
+	if a.model == "" {
+		a.model = chunk.Model
+	}
+	if chunk.Usage != nil {
+		// Le dernier usage reçu est le plus complet (statistiques continues)
+		usage := *chunk.Usage
+		a.usage = &usage
+	}
+
+	for _, choice := range chunk.Choices {
+		state, ok := a.choices[choice.Index]
+		if !ok {
+			state = &accumulatedChoice{}
+			a.choices[choice.Index] = state
+		}
+		if choice.Delta != nil {
+			if choice.Delta.Role != "" {
+				state.role = choice.Delta.Role
+			}
+			state.content.WriteString(choice.Delta.Content)
+			state.toolCalls.add(choice.Delta.ToolCalls)
+		}
+		if choice.FinishReason != "" {
+			state.finishReason = choice.FinishReason
+		}
+	}
+}
+
+// Response retourne la réponse reconstruite à partir des chunks reçus jusqu'ici.
+func (a *StreamAccumulator) Response() *ChatCompletionResponse {
+	response := &ChatCompletionResponse{
+		ID:      a.id,
+		Object:  "chat.completion",
+		Created: a.created,
+		Model:   a.model,
+		Choices: make([]Choice, 0, len(a.choices)),
+	}
+	if a.usage != nil {
+		usage := *a.usage
+		response.Usage = &usage
+	}
+
+	indexes := make([]int, 0, len(a.choices))
+	for index := range a.choices {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	for _, index := range indexes {
+		state := a.choices[index]
+		role := state.role
+		if role == "" {
+			role = "assistant"
+		}
+		message := Message{Role: role, ToolCalls: state.toolCalls.toolCalls()}
+		// Une réponse limitée à des appels d'outils n'a pas de contenu texte
+		if state.content.Len() > 0 || len(message.ToolCalls) == 0 {
+			message.Content = []ContentPart{NewTextPart(state.content.String())}
+		}
+		response.Choices = append(response.Choices, Choice{
+			Index:        index,
+			Message:      message,
+			FinishReason: state.finishReason,
+		})
+	}
+	return response
+}
+
+// Accumulate lit le flux jusqu'à sa fin et retourne la réponse complète.
+// Le flux n'est pas fermé.
+func (sr *StreamReader) Accumulate() (*ChatCompletionResponse, error) {
+	acc := NewStreamAccumulator()
+	for {
+		chunk, err := sr.ReadChunk()
+		if err == io.EOF {
+			return acc.Response(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		acc.Add(chunk)
+	}
+}
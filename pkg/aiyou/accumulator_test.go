@@ -0,0 +1,180 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package aiyou
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const accumulatorTestStream = `data: {"id":"cmpl-1","object":"chat.completion.chunk","created":1700000000,"model":"test-model","choices":[{"index":0,"delta":{"role":"assistant"}},{"index":1,"delta":{"role":"assistant"}}]}
+
+data: {"id":"cmpl-1","object":"chat.completion.chunk","created":1700000000,"model":"test-model","choices":[{"index":1,"delta":{"content":"Bon"}},{"index":0,"delta":{"content":"Hel"}}]}
+
+data: {"id":"cmpl-1","object":"chat.completion.chunk","created":1700000000,"model":"test-model","choices":[{"index":0,"delta":{"content":"lo"},"finish_reason":"stop"},{"index":1,"delta":{"content":"jour"},"finish_reason":"length"}]}
+
+data: {"id":"cmpl-1","object":"chat.completion.chunk","created":1700000000,"model":"test-model","choices":[],"usage":{"prompt_tokens":5,"completion_tokens":4,"total_tokens":9}}
+
+data: [DONE]
+
+`
+
+func checkAccumulatedResponse(t *testing.T, resp *ChatCompletionResponse) {
+	t.Helper()
+	if resp.ID != "cmpl-1" || resp.Model != "test-model" || resp.Created != 1700000000 || resp.Object != "chat.completion" {
+		t.Errorf("Unexpected response metadata: %+v", resp)
+	}
+	if len(resp.Choices) != 2 {
+		t.Fatalf("Expected 2 choices, got %d", len(resp.Choices))
+	}
+
+	expected := []struct {
+		text, finish string
+	}{{"Hello", "stop"}, {"Bonjour", "length"}}
+	for i, want := range expected {
+		choice := resp.Choices[i]
+		if choice.Index != i || choice.Message.Role != "assistant" || choice.FinishReason != want.finish {
+			t.Errorf("Unexpected choice %d: %+v", i, choice)
+		}
+		if len(choice.Message.Content) != 1 || choice.Message.Content[0].Text != want.text {
+			t.Errorf("Expected choice %d content %q, got %+v", i, want.text, choice.Message.Content)
+		}
+		if choice.Delta != nil {
+			t.Errorf("Expected no delta on accumulated choice %d", i)
+		}
+	}
+
+	if resp.Usage == nil || resp.Usage.TotalTokens != 9 || resp.Usage.CompletionTokens != 4 {
+		t.Errorf("Unexpected usage: %+v", resp.Usage)
+	}
+}
+
+func TestStreamAccumulator(t *testing.T) {
+	resp, err := newTestStreamReader(accumulatorTestStream).Accumulate()
+	if err != nil {
+		t.Fatalf("Accumulate failed: %v", err)
+	}
+	checkAccumulatedResponse(t, resp)
+}
+
+func TestFallbackUsesAccumulator(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if !req.Stream {
+			w.Write([]byte(`{"object":"error","message":"Stream options can only be defined when stream is true","type":"BadRequestError","code":400}`))
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, accumulatorTestStream)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(
+		WithBearerToken("test_token"),
+		WithBaseURL(server.URL),
+		WithLogger(NewDefaultLogger(io.Discard)),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	resp, err := client.ChatCompletion(context.Background(), ChatCompletionRequest{
+		Messages:    []Message{NewTextMessage("user", "Hello")},
+		AssistantID: "287",
+	})
+	if err != nil {
+		t.Fatalf("ChatCompletion failed: %v", err)
+	}
+	checkAccumulatedResponse(t, resp)
+}
+
+func TestFallbackStreamOptions(t *testing.T) {
+	var streamed []*StreamOptions
+	rejectOptions := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if !req.Stream {
+			if req.StreamOptions != nil {
+				t.Error("Expected no stream options on the non-streaming attempt")
+			}
+			w.Write([]byte(`{"object":"error","message":"Stream options can only be defined when stream is true","type":"BadRequestError","code":400}`))
+			return
+		}
+		streamed = append(streamed, req.StreamOptions)
+		if rejectOptions && req.StreamOptions != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"object":"error","message":"stream_options is not supported","type":"BadRequestError","code":400}`))
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, accumulatorTestStream)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(
+		WithBearerToken("test_token"),
+		WithBaseURL(server.URL),
+		WithLogger(NewDefaultLogger(io.Discard)),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	req := ChatCompletionRequest{
+		Messages:      []Message{NewTextMessage("user", "Hello")},
+		AssistantID:   "287",
+		StreamOptions: &StreamOptions{IncludeUsage: true, ContinuousUsageStats: true},
+	}
+
+	t.Run("Options are sent with the streamed request", func(t *testing.T) {
+		streamed = nil
+		if _, err := client.ChatCompletion(context.Background(), req); err != nil {
+			t.Fatalf("ChatCompletion failed: %v", err)
+		}
+		if len(streamed) != 1 || streamed[0] == nil || !streamed[0].ContinuousUsageStats {
+			t.Errorf("Expected stream options to be sent, got %+v", streamed)
+		}
+	})
+
+	t.Run("Rejected options are dropped", func(t *testing.T) {
+		streamed, rejectOptions = nil, true
+		resp, err := client.ChatCompletion(context.Background(), req)
+		if err != nil {
+			t.Fatalf("ChatCompletion failed: %v", err)
+		}
+		if len(streamed) != 2 || streamed[1] != nil {
+			t.Errorf("Expected a retry without stream options, got %+v", streamed)
+		}
+		if resp.Choices[0].Message.Content[0].Text != "Hello" {
+			t.Errorf("Unexpected response: %+v", resp)
+		}
+	})
+
+	t.Run("Non-200 stream responses are APIErrors", func(t *testing.T) {
+		_, err := client.ChatCompletionStream(context.Background(), req)
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || apiErr.Message != "stream_options is not supported" {
+			t.Errorf("Expected APIError with the server message, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,315 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// File: pkg/aiyou/agent.go
+
+package aiyou
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultAgentMaxSteps est le nombre maximal d'appels au modèle par exécution.
+const DefaultAgentMaxSteps = 10
+
+// ErrMaxStepsReached est retournée lorsque le modèle demande encore des appels
+// d'outils après le nombre maximal d'étapes.
+var ErrMaxStepsReached = errors.New("agent reached the maximum number of steps")
+
+// rejectedToolResult est le résultat transmis au modèle pour un appel refusé.
+const rejectedToolResult = "Error: this tool call was rejected by the user"
+
+// ApprovalFunc est appelée avant l'exécution d'un outil soumis à approbation.
+// Elle retourne false pour refuser l'appel, qui est alors signalé au modèle ;
+// une erreur interrompt l'exécution de l'agent.
+type ApprovalFunc func(ctx context.Context, call ToolCall) (bool, error)
+
+// Agent exécute la boucle appel du modèle → exécution des outils → réponse
+// jusqu'à ce que le modèle réponde sans demander d'outil.
+type Agent struct {
+	client       *Client
+	assistantID  string
+	systemPrompt string
+	tools        *ToolRegistry
+
+	maxSteps      int
+	timeout       time.Duration   // durée maximale d'une exécution complète
+	toolTimeout   time.Duration   // durée maximale d'un appel d'outil
+	approve       ApprovalFunc    // hook d'approbation des outils à effets de bord
+	approvalTools map[string]bool // outils soumis à approbation, tous si vide
+	chatOptions   []ChatOption    // options appliquées à chaque requête
+	onStep        func(AgentStep) // notification de chaque étape terminée
+}
+
+// AgentOption configure un Agent.
+type AgentOption func(*Agent)
+
+// WithMaxSteps limits the number of model calls made by a single run.
+func WithMaxSteps(maxSteps int) AgentOption {
+	return func(a *Agent) {
+		a.maxSteps = maxSteps
+	}
+}
+
+// WithRunTimeout limits the total duration of a run.
+func WithRunTimeout(timeout time.Duration) AgentOption {
+	return func(a *Agent) {
+		a.timeout = timeout
+	}
+}
+
+// WithToolTimeout limits the duration of each tool call.
+func WithToolTimeout(timeout time.Duration) AgentOption {
+	return func(a *Agent) {
+		a.toolTimeout = timeout
+	}
+}
+
+// WithApproval requires approve to accept calls to the given side-effecting
+// tools before they run. Without tool names, every tool call needs approval.
+func WithApproval(approve ApprovalFunc, toolNames ...string) AgentOption {
+	return func(a *Agent) {
+		a.approve = approve
+		a.approvalTools = make(map[string]bool, len(toolNames))
+		for _, name := range toolNames {
+			a.approvalTools[name] = true
+		}
+	}
+}
+
+// WithAgentChatOptions sets chat options (model, temperature, ...) applied
+// to every request made by the agent.
+func WithAgentChatOptions(opts ...ChatOption) AgentOption {
+	return func(a *Agent) {
+		a.chatOptions = append(a.chatOptions, opts...)
+	}
+}
+
+// WithStepHook calls hook after each step, e.g. to display progress.
+func WithStepHook(hook func(AgentStep)) AgentOption {
+	return func(a *Agent) {
+		a.onStep = hook
+	}
+}
+
+// AgentStep trace un appel au modèle et les appels d'outils qui en découlent.
+type AgentStep struct {
+	Index     int             // Numéro de l'étape, à partir de 1
+	Message   Message         // Réponse de l'assistant
+	Usage     *Usage          // Usage de l'appel au modèle, s'il est connu
+	ToolCalls []ToolCallTrace // Appels d'outils exécutés ou refusés
+	Duration  time.Duration
+}
+
+// ToolCallTrace trace l'exécution d'un appel d'outil.
+type ToolCallTrace struct {
+	Call     ToolCall
+	Result   string // Contenu renvoyé au modèle
+	Err      error  // Erreur de l'outil, transmise au modèle
+	Rejected bool   // Appel refusé par le hook d'approbation
+	Duration time.Duration
+}
+
+// AgentResult contient le résultat d'une exécution de l'agent.
+type AgentResult struct {
+	Response *ChatCompletionResponse // Dernière réponse du modèle, sans appel d'outil
+	Messages []Message               // Conversation complète, messages initiaux compris
+	Steps    []AgentStep             // Trace de chaque étape
+	Usage    Usage                   // Usage cumulé de toutes les étapes
+}
+
+// Text returns the text of the final answer.
+func (r *AgentResult) Text() string {
+	if r.Response == nil || len(r.Response.Choices) == 0 {
+		return ""
+	}
+	return r.Response.Choices[0].Message.Text()
+}
+
+// NewAgent crée un agent utilisant l'assistant assistantID. systemPrompt et
+// tools sont optionnels.
+func NewAgent(client *Client, assistantID, systemPrompt string, tools *ToolRegistry, opts ...AgentOption) *Agent {
+	agent := &Agent{
+		client:       client,
+		assistantID:  assistantID,
+		systemPrompt: systemPrompt,
+		tools:        tools,
+		maxSteps:     DefaultAgentMaxSteps,
+	}
+	for _, opt := range opts {
+		opt(agent)
+	}
+	return agent
+}
+
+// Run exécute l'agent à partir des messages donnés. En cas d'erreur, le
+// résultat partiel est retourné avec la trace des étapes déjà effectuées ;
+// ErrMaxStepsReached signale que le nombre maximal d'étapes est atteint.
+func (a *Agent) Run(ctx context.Context, messages ...Message) (*AgentResult, error) {
+	if a.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.timeout)
+		defer cancel()
+	}
+
+	result := &AgentResult{Messages: append([]Message(nil), messages...)}
+	for step := 1; step <= a.maxSteps; step++ {
+		start := time.Now()
+		a.client.logger.Debugf("Agent step %d", step)
+
+		resp, err := a.client.ChatCompletion(ctx, a.request(result.Messages))
+		if err != nil {
+			return result, fmt.Errorf("agent step %d failed: %w", step, err)
+		}
+		if len(resp.Choices) == 0 {
+			return result, fmt.Errorf("agent step %d failed: no choices in response", step)
+		}
+		if resp.Usage != nil {
+			result.Usage.PromptTokens += resp.Usage.PromptTokens
+			result.Usage.CompletionTokens += resp.Usage.CompletionTokens
+			result.Usage.TotalTokens += resp.Usage.TotalTokens
+		}
+
+		reply := resp.Choices[0].Message
+		if reply.Role == "" {
+			reply.Role = RoleAssistant
+		}
+		result.Messages = append(result.Messages, reply)
+
+		trace := AgentStep{Index: step, Message: reply, Usage: resp.Usage}
+		if len(reply.ToolCalls) == 0 {
+			trace.Duration = time.Since(start)
+			a.recordStep(result, trace)
+			result.Response = resp
+			return result, nil
+		}
+
+		trace.ToolCalls, err = a.runTools(ctx, reply.ToolCalls)
+		trace.Duration = time.Since(start)
+		a.recordStep(result, trace)
+		if err != nil {
+			return result, fmt.Errorf("agent step %d failed: %w", step, err)
+		}
+		for _, call := range trace.ToolCalls {
+			result.Messages = append(result.Messages, NewToolMessage(call.Call.ID, call.Result))
+		}
+	}
+
+	a.client.logger.Warnf("Agent stopped after %d steps", a.maxSteps)
+	return result, ErrMaxStepsReached
+}
+
+// request construit la requête d'une étape.
+func (a *Agent) request(messages []Message) ChatCompletionRequest {
+	req := ChatCompletionRequest{
+		Messages:     messages,
+		AssistantID:  a.assistantID,
+		PromptSystem: a.systemPrompt,
+	}
+	if a.tools != nil {
+		req.Tools = a.tools.Tools()
+	}
+	for _, opt := range a.chatOptions {
+		opt(&req)
+	}
+	return req
+}
+
+// recordStep ajoute l'étape à la trace et notifie le hook éventuel.
+func (a *Agent) recordStep(result *AgentResult, step AgentStep) {
+	result.Steps = append(result.Steps, step)
+	if a.onStep != nil {
+		a.onStep(step)
+	}
+}
+
+// needsApproval indique si l'appel doit être soumis au hook d'approbation.
+func (a *Agent) needsApproval(call ToolCall) bool {
+	return a.approve != nil && (len(a.approvalTools) == 0 || a.approvalTools[call.Function.Name])
+}
+
+// runTools soumet les appels au hook d'approbation, un par un, puis exécute
+// en parallèle ceux qui ont été acceptés. Les traces suivent l'ordre des appels.
+func (a *Agent) runTools(ctx context.Context, calls []ToolCall) ([]ToolCallTrace, error) {
+	traces := make([]ToolCallTrace, len(calls))
+	for i, call := range calls {
+		traces[i].Call = call
+		if !a.needsApproval(call) {
+			continue
+		}
+		approved, err := a.approve(ctx, call)
+		if err != nil {
+			return traces[:i], fmt.Errorf("failed to approve tool call %s: %w", call.Function.Name, err)
+		}
+		if !approved {
+			a.client.logger.Infof("Tool call %s rejected", call.Function.Name)
+			traces[i].Rejected = true
+			traces[i].Result = rejectedToolResult
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := range traces {
+		if traces[i].Rejected {
+			continue
+		}
+		wg.Add(1)
+		go func(trace *ToolCallTrace) {
+			defer wg.Done()
+			a.runTool(ctx, trace)
+		}(&traces[i])
+	}
+	wg.Wait()
+
+	return traces, ctx.Err()
+}
+
+// runTool exécute un appel d'outil et complète sa trace.
+func (a *Agent) runTool(ctx context.Context, trace *ToolCallTrace) {
+	start := time.Now()
+	defer func() { trace.Duration = time.Since(start) }()
+
+	if a.toolTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.toolTimeout)
+		defer cancel()
+	}
+
+	trace.Result, trace.Err = a.callTool(ctx, trace.Call)
+	if trace.Err != nil {
+		a.client.logger.Errorf("Tool %s failed: %v", trace.Call.Function.Name, trace.Err)
+		trace.Result = "Error: " + trace.Err.Error()
+	}
+}
+
+// callTool exécute un appel d'outil. Une panique de l'outil est convertie en
+// erreur afin de ne pas interrompre le programme.
+func (a *Agent) callTool(ctx context.Context, call ToolCall) (result string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("tool %s panicked: %v", call.Function.Name, r)
+		}
+	}()
+	if a.tools == nil {
+		return "", fmt.Errorf("%w: %s", ErrUnknownTool, call.Function.Name)
+	}
+	return a.tools.Call(ctx, call)
+}
@@ -0,0 +1,181 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package aiyou
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const agentToolCallsResponse = `{"id":"1","object":"chat.completion","choices":[{"index":0,"finish_reason":"tool_calls","message":{"role":"assistant","content":null,"tool_calls":[` +
+	`{"id":"call_1","type":"function","function":{"name":"lookup","arguments":"{\"key\":\"a\"}"}},` +
+	`{"id":"call_2","type":"function","function":{"name":"lookup","arguments":"{\"key\":\"b\"}"}},` +
+	`{"id":"call_3","type":"function","function":{"name":"delete","arguments":"{\"key\":\"a\"}"}}]}}],` +
+	`"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`
+
+const agentFinalResponse = `{"id":"2","object":"chat.completion","choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"Terminé"}}],` +
+	`"usage":{"prompt_tokens":20,"completion_tokens":2,"total_tokens":22}}`
+
+func TestAgentRun(t *testing.T) {
+	var requests []ChatCompletionRequest
+	client := newTestClient(t, chatTestHandler(func(req ChatCompletionRequest) string {
+		requests = append(requests, req)
+		if len(requests) == 1 {
+			return agentToolCallsResponse
+		}
+		return agentFinalResponse
+	}))
+
+	// Les deux appels à lookup s'attendent mutuellement : ils ne peuvent
+	// aboutir que s'ils sont exécutés en parallèle.
+	var barrier sync.WaitGroup
+	barrier.Add(2)
+	registry := NewToolRegistry()
+	RegisterFunc(registry, "lookup", "Lecture", func(ctx context.Context, args struct {
+		Key string `json:"key"`
+	}) (string, error) {
+		barrier.Done()
+		done := make(chan struct{})
+		go func() { barrier.Wait(); close(done) }()
+		select {
+		case <-done:
+			return "value-" + args.Key, nil
+		case <-time.After(2 * time.Second):
+			return "", errors.New("tool calls were not run in parallel")
+		}
+	})
+	deleted := false
+	RegisterFunc(registry, "delete", "Suppression", func(ctx context.Context, args struct {
+		Key string `json:"key"`
+	}) (string, error) {
+		deleted = true
+		return "deleted", nil
+	})
+
+	var approvals []string
+	var hooked []int
+	agent := NewAgent(client, "287", "Tu es un agent de test", registry,
+		WithApproval(func(ctx context.Context, call ToolCall) (bool, error) {
+			approvals = append(approvals, call.Function.Name)
+			return false, nil
+		}, "delete"),
+		WithAgentChatOptions(WithTemperature(0)),
+		WithStepHook(func(step AgentStep) { hooked = append(hooked, step.Index) }),
+	)
+
+	result, err := agent.Run(context.Background(), NewTextMessage(RoleUser, "Nettoie la clé a"))
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if result.Text() != "Terminé" {
+		t.Errorf("Expected final answer, got %q", result.Text())
+	}
+
+	if len(requests) != 2 || requests[0].PromptSystem != "Tu es un agent de test" || len(requests[0].Tools) != 2 || requests[0].Temperature == nil {
+		t.Fatalf("Unexpected requests: %+v", requests)
+	}
+	if len(requests[1].Messages) != 5 {
+		t.Fatalf("Expected user, assistant and 3 tool messages, got %+v", requests[1].Messages)
+	}
+	for i, want := range []string{"value-a", "value-b", rejectedToolResult} {
+		msg := requests[1].Messages[2+i]
+		if msg.Role != RoleTool || msg.ToolCallID != result.Steps[0].ToolCalls[i].Call.ID || msg.Text() != want {
+			t.Errorf("Unexpected tool message %d: %+v", i, msg)
+		}
+	}
+
+	if deleted || len(approvals) != 1 || approvals[0] != "delete" {
+		t.Errorf("Expected only delete to be submitted and rejected, got %v (deleted=%v)", approvals, deleted)
+	}
+	if len(result.Steps) != 2 || !result.Steps[0].ToolCalls[2].Rejected || len(hooked) != 2 {
+		t.Errorf("Unexpected trace: %+v", result.Steps)
+	}
+	if len(result.Messages) != 6 || result.Usage.TotalTokens != 37 {
+		t.Errorf("Unexpected result: %d messages, usage %+v", len(result.Messages), result.Usage)
+	}
+}
+
+func TestAgentGuards(t *testing.T) {
+	client := newTestClient(t, chatTestHandler(func(req ChatCompletionRequest) string {
+		return agentToolCallsResponse
+	}))
+	registry := NewToolRegistry()
+	RegisterFunc(registry, "lookup", "Lecture", func(ctx context.Context, args struct{}) (string, error) {
+		return "ok", nil
+	})
+
+	t.Run("Max steps", func(t *testing.T) {
+		result, err := NewAgent(client, "287", "", registry, WithMaxSteps(2)).
+			Run(context.Background(), NewTextMessage(RoleUser, "Boucle"))
+		if !errors.Is(err, ErrMaxStepsReached) {
+			t.Fatalf("Expected ErrMaxStepsReached, got %v", err)
+		}
+		if len(result.Steps) != 2 {
+			t.Errorf("Expected 2 steps in trace, got %d", len(result.Steps))
+		}
+		// Les appels à un outil inconnu sont signalés au modèle
+		if trace := result.Steps[0].ToolCalls[2]; !errors.Is(trace.Err, ErrUnknownTool) {
+			t.Errorf("Expected ErrUnknownTool in trace, got %+v", trace)
+		}
+	})
+
+	t.Run("Tool panic", func(t *testing.T) {
+		panicking := NewToolRegistry()
+		RegisterFunc(panicking, "lookup", "Lecture", func(ctx context.Context, args struct{}) (string, error) {
+			panic("index out of range")
+		})
+		result, err := NewAgent(client, "287", "", panicking, WithMaxSteps(1)).
+			Run(context.Background(), NewTextMessage(RoleUser, "Boucle"))
+		if !errors.Is(err, ErrMaxStepsReached) {
+			t.Fatalf("Expected ErrMaxStepsReached, got %v", err)
+		}
+		trace := result.Steps[0].ToolCalls[0]
+		if trace.Err == nil || !strings.Contains(trace.Err.Error(), "tool lookup panicked: index out of range") {
+			t.Errorf("Expected the panic in trace, got %+v", trace)
+		}
+		if !strings.HasPrefix(trace.Result, "Error: ") {
+			t.Errorf("Expected the panic to be reported to the model, got %q", trace.Result)
+		}
+	})
+
+	t.Run("Approval error aborts the run", func(t *testing.T) {
+		approvalErr := errors.New("no operator")
+		_, err := NewAgent(client, "287", "", registry,
+			WithApproval(func(ctx context.Context, call ToolCall) (bool, error) { return false, approvalErr }),
+		).Run(context.Background(), NewTextMessage(RoleUser, "Boucle"))
+		if !errors.Is(err, approvalErr) {
+			t.Errorf("Expected approval error, got %v", err)
+		}
+	})
+
+	t.Run("Run timeout", func(t *testing.T) {
+		slow := NewToolRegistry()
+		RegisterFunc(slow, "lookup", "Lecture", func(ctx context.Context, args struct{}) (string, error) {
+			<-ctx.Done()
+			return "", ctx.Err()
+		})
+		_, err := NewAgent(client, "287", "", slow, WithRunTimeout(50*time.Millisecond)).
+			Run(context.Background(), NewTextMessage(RoleUser, "Boucle"))
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected deadline exceeded, got %v", err)
+		}
+	})
+}
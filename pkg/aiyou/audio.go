@@ -23,7 +23,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -54,87 +53,23 @@ func (c *Client) TranscribeAudioFile(ctx context.Context, filePath string, opts
 		return nil, fmt.Errorf("failed to get file info: %w", err)
 	}
 
-	// Créer un pipe pour lire le body
-	pr, pw := io.Pipe()
-	writer := multipart.NewWriter(pw)
-
-	// Goroutine pour écrire le multipart form
-	go func() {
-		defer pw.Close()
-		var writeError error
-
-		// Créer la partie fichier
-		part, err := writer.CreateFormFile("audioFile", filepath.Base(filePath))
-		if err != nil {
-			writeError = err
-			pw.CloseWithError(err)
-			return
+	// Construire un formulaire multipart rejouable : le fichier est relu
+	// à chaque tentative afin que les retries renvoient le même contenu
+	var fields []formField
+	if opts != nil {
+		if opts.Language != "" {
+			fields = append(fields, formField{name: "language", value: opts.Language})
 		}
-
-		// Copier le fichier
-		_, err = io.Copy(part, file)
-		if err != nil {
-			writeError = err
-			pw.CloseWithError(err)
-			return
-		}
-
-		// Ajouter les champs optionnels
-		if opts != nil {
-			if opts.Language != "" {
-				if err := writer.WriteField("language", opts.Language); err != nil {
-					writeError = err
-					pw.CloseWithError(err)
-					return
-				}
-			}
-			if opts.Format != "" {
-				if err := writer.WriteField("format", opts.Format); err != nil {
-					writeError = err
-					pw.CloseWithError(err)
-					return
-				}
-			}
-		}
-
-		// Fermer le writer
-		if err := writer.Close(); err != nil {
-			writeError = err
-			pw.CloseWithError(err)
-			return
-		}
-
-		if writeError != nil {
-			c.logger.Errorf("Error writing multipart form: %v", writeError)
+		if opts.Format != "" {
+			fields = append(fields, formField{name: "format", value: opts.Format})
 		}
-	}()
+	}
+	form := newMultipartFileBody("audioFile", filePath, fields)
 
-	// Créer la requête
 	endpoint := "/api/v1/audio/transcriptions"
 	c.logger.Debugf("Creating request to %s with file size: %d bytes", endpoint, fileInfo.Size())
 
-	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+endpoint, pr)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	// Authentification
-	if err := c.auth.Authenticate(ctx); err != nil {
-		return nil, fmt.Errorf("failed to authenticate: %w", err)
-	}
-	req.Header.Set("Authorization", "Bearer "+c.auth.Token())
-
-	// Content-Type
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-
-	// Log des headers
-	c.logger.Debugf("Request headers:")
-	for name, values := range req.Header {
-		c.logger.Debugf(" %s: %v", name, values)
-	}
-
-	// Envoyer la requête
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.sendAuthenticated(ctx, "POST", endpoint, form)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
@@ -26,24 +26,46 @@ import (
 	"io"
 	"net/http"
 	"regexp"
+	"sync"
 	"time"
 )
 
+// DefaultTokenRefreshSkew est la marge avant l'expiration d'un token JWT
+// à partir de laquelle il est renouvelé de manière proactive.
+const DefaultTokenRefreshSkew = 30 * time.Second
+
+// DefaultLoginTimeout borne le login partagé, qui ne suit pas l'annulation
+// du contexte de l'appelant qui l'a déclenché.
+const DefaultLoginTimeout = 30 * time.Second
+
 // JWTAuthenticator implements the Authenticator interface for JWT-based authentication
-// using email and password credentials.
+// using email and password credentials. It is safe for concurrent use: parallel
+// callers share a single login call when the token needs to be renewed.
 type JWTAuthenticator struct {
-	email    string
-	password string
-	token    string
-	expiry   time.Time
-	client   *http.Client
-	baseURL  string
-	logger   Logger
+	email       string
+	password    string
+	token       string
+	expiry      time.Time
+	client      *http.Client
+	baseURL     string
+	logger      Logger
+	refreshSkew time.Duration
+	store       TokenStore
+
+	mu       sync.Mutex
+	inflight *loginCall
+}
+
+// loginCall représente un login en cours, partagé par tous les appelants concurrents.
+type loginCall struct {
+	done chan struct{}
+	err  error
 }
 
 // BearerAuthenticator implements the Authenticator interface for direct bearer token authentication
 // without requiring email/password credentials.
 type BearerAuthenticator struct {
+	mu     sync.RWMutex
 	token  string
 	logger Logger
 }
@@ -54,11 +76,12 @@ func NewJWTAuthenticator(email, password, baseURL string, client *http.Client, l
 		logger = NewDefaultLogger(io.Discard) // Default silent logger
 	}
 	return &JWTAuthenticator{
-		email:    email,
-		password: password,
-		baseURL:  baseURL,
-		client:   client,
-		logger:   logger,
+		email:       email,
+		password:    password,
+		baseURL:     baseURL,
+		client:      client,
+		logger:      logger,
+		refreshSkew: DefaultTokenRefreshSkew,
 	}
 }
 
@@ -79,19 +102,118 @@ func (a *JWTAuthenticator) SetLogger(logger Logger) {
 	a.logger = logger
 }
 
+// SetRefreshSkew sets how long before its expiry the JWT token is renewed
+func (a *JWTAuthenticator) SetRefreshSkew(skew time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.refreshSkew = skew
+}
+
+// SetTokenStore sets the store used to reuse tokens across process restarts.
+// The store is read before logging in and written after each successful login.
+func (a *JWTAuthenticator) SetTokenStore(store TokenStore) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.store = store
+}
+
+// setTransport sets the HTTP client and base URL used for the login call
+func (a *JWTAuthenticator) setTransport(client *http.Client, baseURL string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.client = client
+	a.baseURL = baseURL
+}
+
 // SetLogger sets a custom logger for the Bearer authenticator
 func (a *BearerAuthenticator) SetLogger(logger Logger) {
 	a.logger = logger
 }
 
 // Authenticate performs the authentication process and obtains a JWT token
-// for email/password authentication.
+// for email/password authentication. If a login is already in progress,
+// the caller waits for its result instead of issuing another one. The shared
+// login is not canceled with the caller's ctx: it runs on a detached context
+// bounded by DefaultLoginTimeout, and each caller only stops waiting for it.
 func (a *JWTAuthenticator) Authenticate(ctx context.Context) error {
-	if !a.tokenExpired() {
+	a.mu.Lock()
+	if !a.tokenExpiredLocked() {
+		a.mu.Unlock()
 		a.logger.Debugf("JWT token is still valid, skipping authentication")
 		return nil
 	}
 
+	call := a.inflight
+	if call != nil {
+		a.logger.Debugf("Waiting for in-flight authentication")
+	} else {
+		call = &loginCall{done: make(chan struct{})}
+		a.inflight = call
+		go a.runLogin(context.WithoutCancel(ctx), call, a.client, a.baseURL, a.store, a.refreshSkew)
+	}
+	a.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// runLogin effectue le login partagé par les appelants de Authenticate et
+// publie son résultat dans call.
+func (a *JWTAuthenticator) runLogin(ctx context.Context, call *loginCall, client *http.Client, baseURL string, store TokenStore, skew time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, DefaultLoginTimeout)
+	defer cancel()
+
+	loginResp := a.loadCachedToken(store, baseURL, skew)
+	var err error
+	if loginResp == nil {
+		loginResp, err = a.login(ctx, client, baseURL)
+		if err == nil && store != nil {
+			cached := StoredToken{Token: loginResp.Token, ExpiresAt: loginResp.ExpiresAt}
+			if saveErr := store.Save(TokenCacheKey(baseURL, a.email), cached); saveErr != nil {
+				a.logger.Warnf("Failed to cache JWT token: %v", saveErr)
+			}
+		}
+	}
+
+	a.mu.Lock()
+	if err == nil {
+		a.token = loginResp.Token
+		a.expiry = loginResp.ExpiresAt
+	}
+	a.inflight = nil
+	a.mu.Unlock()
+
+	call.err = err
+	close(call.done)
+
+	if err == nil {
+		a.logger.Debugf("Authentication successful, token expires at %v", loginResp.ExpiresAt)
+	}
+}
+
+// loadCachedToken retourne le token du cache s'il est encore valide, nil sinon.
+func (a *JWTAuthenticator) loadCachedToken(store TokenStore, baseURL string, skew time.Duration) *LoginResponse {
+	if store == nil {
+		return nil
+	}
+	cached, err := store.Load(TokenCacheKey(baseURL, a.email))
+	if err != nil {
+		a.logger.Warnf("Failed to load cached JWT token: %v", err)
+		return nil
+	}
+	if cached == nil || cached.Token == "" || time.Now().Add(skew).After(cached.ExpiresAt) {
+		return nil
+	}
+	a.logger.Debugf("Using cached JWT token")
+	return &LoginResponse{Token: cached.Token, ExpiresAt: cached.ExpiresAt}
+}
+
+// login envoie la requête de login et décode la réponse.
+func (a *JWTAuthenticator) login(ctx context.Context, client *http.Client, baseURL string) (*LoginResponse, error) {
 	a.logger.Debugf("Authenticating user: %s", maskSensitiveInfo(a.email))
 	loginReq := LoginRequest{
 		Email:    a.email,
@@ -101,47 +223,60 @@ func (a *JWTAuthenticator) Authenticate(ctx context.Context) error {
 	jsonData, err := json.Marshal(loginReq)
 	if err != nil {
 		a.logger.Errorf("Failed to marshal login request: %v", err)
-		return fmt.Errorf("failed to marshal login request: %w", err)
+		return nil, fmt.Errorf("failed to marshal login request: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", a.baseURL+"/api/login", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", baseURL+"/api/login", bytes.NewBuffer(jsonData))
 	if err != nil {
 		a.logger.Errorf("Failed to create login request: %v", err)
-		return fmt.Errorf("failed to create login request: %w", err)
+		return nil, fmt.Errorf("failed to create login request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 
 	a.logger.Debugf("Sending login request")
-	resp, err := a.client.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		a.logger.Errorf("Failed to send login request: %v", err)
-		return fmt.Errorf("failed to send login request: %w", err)
+		return nil, fmt.Errorf("failed to send login request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		a.logger.Warnf("Authentication failed with status code: %d", resp.StatusCode)
-		return fmt.Errorf("authentication failed with status code: %d", resp.StatusCode)
+		return nil, fmt.Errorf("authentication failed with status code: %d", resp.StatusCode)
 	}
 
 	var loginResp LoginResponse
 	if err := json.NewDecoder(resp.Body).Decode(&loginResp); err != nil {
 		a.logger.Errorf("Failed to decode login response: %v", err)
-		return fmt.Errorf("failed to decode login response: %w", err)
+		return nil, fmt.Errorf("failed to decode login response: %w", err)
 	}
 
-	a.token = loginResp.Token
-	a.expiry = loginResp.ExpiresAt
+	return &loginResp, nil
+}
 
-	a.logger.Debugf("Authentication successful, token expires at %v", a.expiry)
-	return nil
+// Invalidate discards the current JWT token if it is still the given one,
+// so that the next call to Authenticate performs a new login.
+func (a *JWTAuthenticator) Invalidate(token string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token == token {
+		a.logger.Debugf("Invalidating rejected JWT token")
+		a.token = ""
+		a.expiry = time.Time{}
+		if a.store != nil {
+			if err := a.store.Delete(TokenCacheKey(a.baseURL, a.email)); err != nil {
+				a.logger.Warnf("Failed to delete cached JWT token: %v", err)
+			}
+		}
+	}
 }
 
 // Authenticate for BearerAuthenticator validates the token existence
 // and returns immediately as no API call is needed.
 func (a *BearerAuthenticator) Authenticate(ctx context.Context) error {
-	if a.token == "" {
+	if a.Token() == "" {
 		a.logger.Errorf("Bearer token authentication failed: token is empty")
 		return &AuthenticationError{Message: "bearer token is empty"}
 	}
@@ -151,24 +286,37 @@ func (a *BearerAuthenticator) Authenticate(ctx context.Context) error {
 
 // Token returns the current JWT token
 func (a *JWTAuthenticator) Token() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 	return a.token
 }
 
 // Token returns the bearer token
 func (a *BearerAuthenticator) Token() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
 	return a.token
 }
 
 // SetToken updates the bearer token
 func (a *BearerAuthenticator) SetToken(token string) {
 	a.logger.Infof("Updating bearer token")
+	a.mu.Lock()
 	a.token = token
+	a.mu.Unlock()
 	a.logger.Debugf("Bearer token has been successfully updated: %s", maskSensitiveInfo(token))
 }
 
-// tokenExpired checks if the current JWT token has expired
+// tokenExpired checks if the current JWT token has expired or is about to expire
 func (a *JWTAuthenticator) tokenExpired() bool {
-	return a.token == "" || time.Now().After(a.expiry)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.tokenExpiredLocked()
+}
+
+// tokenExpiredLocked is tokenExpired for callers already holding a.mu
+func (a *JWTAuthenticator) tokenExpiredLocked() bool {
+	return a.token == "" || time.Now().Add(a.refreshSkew).After(a.expiry)
 }
 
 // maskSensitiveInfo masque les informations sensibles dans une chaîne
@@ -2,8 +2,15 @@ package aiyou
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -168,3 +175,158 @@ func TestAuthenticatorInterface(t *testing.T) {
 
 	t.Log("Verified that both authenticators implement the Authenticator interface")
 }
+
+// newLoginCountingServer simule /api/login en émettant token-1, token-2, ...
+// valables pendant validity, et rejette avec 401 les requêtes portant un token révoqué.
+func newLoginCountingServer(t *testing.T, validity time.Duration, revoked string) (*httptest.Server, *int32) {
+	var logins int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/login" {
+			n := atomic.AddInt32(&logins, 1)
+			time.Sleep(20 * time.Millisecond) // laisser les appelants concurrents s'accumuler
+			json.NewEncoder(w).Encode(LoginResponse{
+				Token:     fmt.Sprintf("token-%d", n),
+				ExpiresAt: time.Now().Add(validity),
+			})
+			return
+		}
+		if r.Header.Get("Authorization") == "Bearer "+revoked {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"message":"success"}`))
+	}))
+	return server, &logins
+}
+
+func TestJWTConcurrentAuthentication(t *testing.T) {
+	server, logins := newLoginCountingServer(t, time.Hour, "")
+	defer server.Close()
+
+	auth := NewJWTAuthenticator("test@example.com", "password", server.URL, server.Client(), nil)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := auth.Authenticate(context.Background()); err != nil {
+				errs <- err
+				return
+			}
+			if auth.Token() != "token-1" {
+				errs <- fmt.Errorf("unexpected token %q", auth.Token())
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+	if got := atomic.LoadInt32(logins); got != 1 {
+		t.Errorf("Expected a single shared login, got %d", got)
+	}
+}
+
+func TestJWTLoginSurvivesLeaderCancel(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var logins int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&logins, 1) == 1 {
+			close(started)
+		}
+		<-release
+		json.NewEncoder(w).Encode(LoginResponse{Token: "token-1", ExpiresAt: time.Now().Add(time.Hour)})
+	}))
+	defer server.Close()
+
+	auth := NewJWTAuthenticator("test@example.com", "password", server.URL, server.Client(), nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := make(chan error, 1)
+	go func() { leader <- auth.Authenticate(ctx) }()
+	<-started
+
+	follower := make(chan error, 1)
+	go func() { follower <- auth.Authenticate(context.Background()) }()
+
+	cancel()
+	if err := <-leader; err != context.Canceled {
+		t.Errorf("Expected the leader to stop waiting with context.Canceled, got %v", err)
+	}
+	close(release)
+
+	if err := <-follower; err != nil {
+		t.Fatalf("Expected the follower to get the shared login, got %v", err)
+	}
+	if auth.Token() != "token-1" {
+		t.Errorf("Unexpected token %q", auth.Token())
+	}
+	if got := atomic.LoadInt32(&logins); got != 1 {
+		t.Errorf("Expected a single shared login, got %d", got)
+	}
+}
+
+func TestJWTProactiveRenewal(t *testing.T) {
+	server, logins := newLoginCountingServer(t, 10*time.Second, "")
+	defer server.Close()
+
+	auth := NewJWTAuthenticator("test@example.com", "password", server.URL, server.Client(), nil)
+
+	t.Run("Token within refresh skew is renewed", func(t *testing.T) {
+		auth.SetRefreshSkew(time.Minute)
+		for i := 0; i < 2; i++ {
+			if err := auth.Authenticate(context.Background()); err != nil {
+				t.Fatalf("Authentication failed: %v", err)
+			}
+		}
+		if got := atomic.LoadInt32(logins); got != 2 {
+			t.Errorf("Expected token expiring within the skew to be renewed, got %d logins", got)
+		}
+	})
+
+	t.Run("Token outside refresh skew is reused", func(t *testing.T) {
+		auth.SetRefreshSkew(time.Second)
+		before := atomic.LoadInt32(logins)
+		if err := auth.Authenticate(context.Background()); err != nil {
+			t.Fatalf("Authentication failed: %v", err)
+		}
+		if got := atomic.LoadInt32(logins); got != before {
+			t.Errorf("Expected cached token to be reused, got %d new logins", got-before)
+		}
+	})
+}
+
+func TestReauthenticateOnUnauthorized(t *testing.T) {
+	server, logins := newLoginCountingServer(t, time.Hour, "token-1")
+	defer server.Close()
+
+	client, err := NewClient(
+		WithEmailPassword("test@example.com", "password"),
+		WithBaseURL(server.URL),
+		WithLogger(NewDefaultLogger(io.Discard)),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	resp, err := client.AuthenticatedRequest(context.Background(), "POST", "/api/v1/save", strings.NewReader(`{"conversation":"x"}`))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected replayed request to succeed, got status %d", resp.StatusCode)
+	}
+	if got := atomic.LoadInt32(logins); got != 2 {
+		t.Errorf("Expected a re-login after 401, got %d logins", got)
+	}
+	if token := client.auth.Token(); token != "token-2" {
+		t.Errorf("Expected refreshed token-2, got %q", token)
+	}
+}
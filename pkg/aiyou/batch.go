@@ -0,0 +1,333 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// File: pkg/aiyou/batch.go
+
+package aiyou
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultBatchConcurrency est le nombre de requêtes simultanées d'un batch
+// lorsque BatchOptions.Concurrency n'est pas renseigné.
+const DefaultBatchConcurrency = 4
+
+// BatchOptions configure BatchChatCompletion.
+type BatchOptions struct {
+	Concurrency    int                 // Requêtes simultanées (DefaultBatchConcurrency par défaut)
+	ItemTimeout    time.Duration       // Délai maximal de chaque requête, hors attente du premier jeton du rate limiter (0 = aucun)
+	OnProgress     func(BatchProgress) // Appelée après chaque requête, jamais en parallèle
+	CheckpointFile string              // Fichier JSONL des réponses obtenues, relu pour reprendre un batch
+}
+
+// BatchProgress décrit l'avancement d'un batch.
+type BatchProgress struct {
+	Total   int          // Nombre de requêtes du batch
+	Done    int          // Requêtes terminées, y compris en échec ou reprises
+	Failed  int          // Requêtes en échec
+	Resumed int          // Réponses reprises du fichier de checkpoint
+	Last    *BatchResult // Dernier résultat obtenu
+}
+
+// BatchResult est le résultat d'une requête d'un batch.
+type BatchResult struct {
+	Index    int                     // Position de la requête dans le batch
+	Response *ChatCompletionResponse // Réponse, nil en cas d'échec
+	Err      error                   // Erreur de la requête
+	Duration time.Duration           // Durée de la requête
+	Resumed  bool                    // Réponse reprise du fichier de checkpoint
+}
+
+// BatchError signale les requêtes en échec d'un batch. Les autres résultats
+// restent disponibles.
+type BatchError struct {
+	Total  int
+	Failed []BatchResult
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%d of %d batch requests failed, first error: %v", len(e.Failed), e.Total, e.Failed[0].Err)
+}
+
+// Unwrap permet errors.Is et errors.As sur les erreurs des requêtes.
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, len(e.Failed))
+	for i, result := range e.Failed {
+		errs[i] = result.Err
+	}
+	return errs
+}
+
+// batchCheckpoint est une ligne du fichier de checkpoint.
+type batchCheckpoint struct {
+	Index    int                     `json:"index"`
+	Request  string                  `json:"request"` // Empreinte de la requête
+	Response *ChatCompletionResponse `json:"response"`
+}
+
+// rateLimitReserved marque les requêtes dont le jeton du rate limiter a déjà
+// été obtenu, afin que l'attente ne soit pas décomptée de leur délai. La
+// valeur associée, un *atomic.Bool, n'est consommée que par la première
+// tentative : les suivantes (repli en streaming) attendent leur propre jeton.
+type rateLimitReserved struct{}
+
+// takeRateLimitReservation consomme le jeton réservé dans ctx, s'il existe
+// et n'a pas déjà été utilisé.
+func takeRateLimitReservation(ctx context.Context) bool {
+	reserved, ok := ctx.Value(rateLimitReserved{}).(*atomic.Bool)
+	return ok && reserved.CompareAndSwap(true, false)
+}
+
+// BatchChatCompletion envoie reqs avec au plus opts.Concurrency requêtes
+// simultanées, en respectant le RateLimiter du client. Les résultats sont
+// retournés dans l'ordre de reqs ; si des requêtes échouent, les autres
+// résultats sont conservés et l'erreur est un *BatchError.
+//
+// Avec opts.CheckpointFile, chaque réponse obtenue est ajoutée au fichier ;
+// relancer le même batch ne renvoie que les requêtes absentes du fichier.
+func (c *Client) BatchChatCompletion(ctx context.Context, reqs []ChatCompletionRequest, opts BatchOptions) ([]BatchResult, error) {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultBatchConcurrency
+	}
+
+	keys := make([]string, len(reqs))
+	for i, req := range reqs {
+		key, err := batchRequestKey(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal batch request %d: %w", i, err)
+		}
+		keys[i] = key
+	}
+
+	results := make([]BatchResult, len(reqs))
+	done := make([]bool, len(reqs))
+	tracker := &batchTracker{progress: BatchProgress{Total: len(reqs)}, onProgress: opts.OnProgress}
+
+	var checkpoint *os.File
+	if opts.CheckpointFile != "" {
+		resumed, err := c.loadBatchCheckpoint(opts.CheckpointFile, keys)
+		if err != nil {
+			return nil, err
+		}
+		for i := range reqs {
+			if resp, ok := resumed[i]; ok {
+				results[i] = BatchResult{Index: i, Response: resp, Resumed: true}
+				done[i] = true
+				tracker.record(&results[i])
+			}
+		}
+
+		checkpoint, err = openBatchCheckpoint(opts.CheckpointFile)
+		if err != nil {
+			return nil, err
+		}
+		defer checkpoint.Close()
+	}
+
+	c.logger.Infof("Starting batch of %d requests (%d resumed, concurrency %d)", len(reqs), tracker.progress.Resumed, concurrency)
+
+	jobs := make(chan int)
+	var checkpointMu sync.Mutex
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				start := time.Now()
+				resp, err := c.batchItem(ctx, reqs[i], opts.ItemTimeout)
+				results[i] = BatchResult{Index: i, Response: resp, Err: err, Duration: time.Since(start)}
+
+				if err == nil && checkpoint != nil {
+					checkpointMu.Lock()
+					if err := writeBatchCheckpoint(checkpoint, batchCheckpoint{Index: i, Request: keys[i], Response: resp}); err != nil {
+						c.logger.Warnf("Failed to write batch checkpoint for request %d: %v", i, err)
+					}
+					checkpointMu.Unlock()
+				}
+				tracker.record(&results[i])
+			}
+		}()
+	}
+
+	// Les requêtes non envoyées après une annulation reçoivent l'erreur du contexte
+	for i := range reqs {
+		if done[i] {
+			continue
+		}
+		if ctx.Err() != nil {
+			results[i] = BatchResult{Index: i, Err: ctx.Err()}
+			tracker.record(&results[i])
+			continue
+		}
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			results[i] = BatchResult{Index: i, Err: ctx.Err()}
+			tracker.record(&results[i])
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	batchErr := &BatchError{Total: len(reqs)}
+	for _, result := range results {
+		if result.Err != nil {
+			batchErr.Failed = append(batchErr.Failed, result)
+		}
+	}
+	c.logger.Infof("Batch completed: %d succeeded, %d failed, %d resumed",
+		len(reqs)-len(batchErr.Failed), len(batchErr.Failed), tracker.progress.Resumed)
+	if len(batchErr.Failed) > 0 {
+		return results, batchErr
+	}
+	return results, nil
+}
+
+// batchItem envoie une requête du batch. Le jeton du rate limiter de la
+// première tentative est obtenu avant le début du délai propre à la requête.
+func (c *Client) batchItem(ctx context.Context, req ChatCompletionRequest, timeout time.Duration) (*ChatCompletionResponse, error) {
+	if c.rateLimiter != nil {
+		if err := c.rateLimiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+		reserved := new(atomic.Bool)
+		reserved.Store(true)
+		ctx = context.WithValue(ctx, rateLimitReserved{}, reserved)
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return c.ChatCompletion(ctx, req)
+}
+
+// batchTracker met à jour l'avancement et appelle OnProgress sans parallélisme.
+type batchTracker struct {
+	mu         sync.Mutex
+	progress   BatchProgress
+	onProgress func(BatchProgress)
+}
+
+// record comptabilise result et notifie l'avancement.
+func (t *batchTracker) record(result *BatchResult) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.progress.Done++
+	if result.Err != nil {
+		t.progress.Failed++
+	}
+	if result.Resumed {
+		t.progress.Resumed++
+	}
+	if t.onProgress != nil {
+		progress := t.progress
+		last := *result
+		progress.Last = &last
+		t.onProgress(progress)
+	}
+}
+
+// batchRequestKey retourne l'empreinte d'une requête, qui identifie sa
+// réponse dans le fichier de checkpoint.
+func batchRequestKey(req ChatCompletionRequest) (string, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// loadBatchCheckpoint retourne les réponses du fichier de checkpoint dont la
+// requête correspond toujours à celle du batch. Un fichier absent est ignoré,
+// ainsi que les lignes illisibles (écriture interrompue).
+func (c *Client) loadBatchCheckpoint(path string, keys []string) (map[int]*ChatCompletionResponse, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checkpoint file: %w", err)
+	}
+	defer file.Close()
+
+	resumed := make(map[int]*ChatCompletionResponse)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var entry batchCheckpoint
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || entry.Response == nil {
+			c.logger.Warnf("Skipping invalid checkpoint line %d in %s", line, path)
+			continue
+		}
+		if entry.Index < 0 || entry.Index >= len(keys) || entry.Request != keys[entry.Index] {
+			c.logger.Warnf("Skipping checkpoint line %d: request %d has changed", line, entry.Index)
+			continue
+		}
+		resumed[entry.Index] = entry.Response
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint file: %w", err)
+	}
+	return resumed, nil
+}
+
+// openBatchCheckpoint ouvre le fichier de checkpoint en ajout. Une dernière
+// ligne interrompue est terminée pour ne pas corrompre la suivante.
+func openBatchCheckpoint(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checkpoint file: %w", err)
+	}
+	info, err := file.Stat()
+	if err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err = file.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			_, err = file.Write([]byte{'\n'})
+		}
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to prepare checkpoint file: %w", err)
+	}
+	return file, nil
+}
+
+// writeBatchCheckpoint ajoute entry au fichier de checkpoint.
+func writeBatchCheckpoint(file *os.File, entry batchCheckpoint) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,227 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package aiyou
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// batchTestServer répond en écho au dernier message, échoue pour les
+// messages contenant "fail" et attend pour ceux contenant "slow".
+type batchTestServer struct {
+	mu       sync.Mutex
+	received []string
+	inFlight int32
+	maxSeen  int32
+	failing  bool
+}
+
+func (s *batchTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	current := atomic.AddInt32(&s.inFlight, 1)
+	defer atomic.AddInt32(&s.inFlight, -1)
+	for {
+		max := atomic.LoadInt32(&s.maxSeen)
+		if current <= max || atomic.CompareAndSwapInt32(&s.maxSeen, max, current) {
+			break
+		}
+	}
+
+	var req ChatCompletionRequest
+	json.NewDecoder(r.Body).Decode(&req)
+	text := req.Messages[len(req.Messages)-1].Text()
+
+	s.mu.Lock()
+	s.received = append(s.received, text)
+	failing := s.failing
+	s.mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+	if strings.Contains(text, "slow") {
+		select {
+		case <-time.After(300 * time.Millisecond):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if failing && strings.Contains(text, "fail") {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"object":"error","message":"invalid request","type":"invalid_request_error"}`))
+		return
+	}
+	w.Write([]byte(chatTestResponse("echo: " + text)))
+}
+
+func batchTestRequests(texts ...string) []ChatCompletionRequest {
+	reqs := make([]ChatCompletionRequest, len(texts))
+	for i, text := range texts {
+		reqs[i] = ChatCompletionRequest{AssistantID: "287", Messages: []Message{NewTextMessage(RoleUser, text)}}
+	}
+	return reqs
+}
+
+func TestBatchChatCompletion(t *testing.T) {
+	server := &batchTestServer{failing: true}
+	client := newTestClient(t, server)
+
+	var texts []string
+	for i := 0; i < 12; i++ {
+		texts = append(texts, fmt.Sprintf("question %d", i))
+	}
+	texts[5] = "please fail"
+
+	var progress []BatchProgress
+	results, err := client.BatchChatCompletion(context.Background(), batchTestRequests(texts...), BatchOptions{
+		Concurrency: 3,
+		OnProgress:  func(p BatchProgress) { progress = append(progress, p) },
+	})
+
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Failed) != 1 || batchErr.Failed[0].Index != 5 {
+		t.Fatalf("Expected a BatchError for request 5, got %v", err)
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected the API error to be reachable, got %v", err)
+	}
+
+	for i, result := range results {
+		if result.Index != i {
+			t.Errorf("Result %d has index %d", i, result.Index)
+		}
+		if i == 5 {
+			continue
+		}
+		if result.Err != nil || result.Response.Choices[0].Message.Text() != "echo: "+texts[i] {
+			t.Errorf("Unexpected result %d: %+v", i, result)
+		}
+	}
+
+	if max := atomic.LoadInt32(&server.maxSeen); max > 3 || max < 2 {
+		t.Errorf("Expected up to 3 concurrent requests, saw %d", max)
+	}
+	last := progress[len(progress)-1]
+	if len(progress) != 12 || last.Done != 12 || last.Failed != 1 || last.Total != 12 {
+		t.Errorf("Unexpected progress: %d callbacks, last %+v", len(progress), last)
+	}
+}
+
+func TestBatchItemTimeout(t *testing.T) {
+	client := newTestClient(t, &batchTestServer{failing: true})
+
+	results, err := client.BatchChatCompletion(context.Background(), batchTestRequests("rapide", "slow", "rapide aussi"), BatchOptions{
+		ItemTimeout: 100 * time.Millisecond,
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded, got %v", err)
+	}
+	if results[0].Err != nil || results[1].Err == nil || results[2].Err != nil {
+		t.Errorf("Expected only the slow request to time out, got %+v", results)
+	}
+}
+
+func TestBatchRateLimiter(t *testing.T) {
+	client := newTestClient(t, &batchTestServer{failing: true}, WithRateLimiter(RateLimiterConfig{RequestsPerSecond: 10, BurstSize: 1}))
+
+	start := time.Now()
+	_, err := client.BatchChatCompletion(context.Background(), batchTestRequests("a", "b", "c"), BatchOptions{
+		Concurrency: 3,
+		ItemTimeout: 80 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Expected rate limiter wait to be excluded from the item timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Errorf("Expected requests to be rate limited, batch took %v", elapsed)
+	}
+}
+
+func TestBatchRateLimiterFallback(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if !req.Stream {
+			w.Write([]byte(`{"object":"error","message":"Stream options can only be defined when stream is true","type":"BadRequestError","code":400}`))
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, accumulatorTestStream)
+	}), WithRateLimiter(RateLimiterConfig{RequestsPerSecond: 0.01, BurstSize: 2}))
+
+	if _, err := client.BatchChatCompletion(context.Background(), batchTestRequests("a"), BatchOptions{}); err != nil {
+		t.Fatalf("Expected the streaming fallback to succeed, got %v", err)
+	}
+	// Le repli en streaming consomme un second jeton
+	if client.rateLimiter.GetWaitTime() == 0 {
+		t.Error("Expected each attempt to take a rate limiter token")
+	}
+}
+
+func TestBatchCheckpointResume(t *testing.T) {
+	server := &batchTestServer{failing: true}
+	client := newTestClient(t, server)
+	checkpoint := filepath.Join(t.TempDir(), "batch.jsonl")
+	reqs := batchTestRequests("un", "deux fail", "trois")
+
+	if _, err := client.BatchChatCompletion(context.Background(), reqs, BatchOptions{CheckpointFile: checkpoint}); err == nil {
+		t.Fatal("Expected the first run to fail")
+	}
+
+	// Ligne tronquée par une interruption, puis reprise
+	f, _ := os.OpenFile(checkpoint, os.O_APPEND|os.O_WRONLY, 0o600)
+	f.WriteString(`{"index":1,"request":"`)
+	f.Close()
+
+	server.mu.Lock()
+	server.received = nil
+	server.failing = false
+	server.mu.Unlock()
+
+	var resumed int
+	results, err := client.BatchChatCompletion(context.Background(), reqs, BatchOptions{
+		CheckpointFile: checkpoint,
+		OnProgress:     func(p BatchProgress) { resumed = p.Resumed },
+	})
+	if err != nil {
+		t.Fatalf("Expected resumed batch to succeed, got %v", err)
+	}
+	if len(server.received) != 1 || server.received[0] != "deux fail" {
+		t.Errorf("Expected only the failed request to be sent again, got %v", server.received)
+	}
+	if resumed != 2 || !results[0].Resumed || results[1].Resumed || results[2].Response.Choices[0].Message.Text() != "echo: trois" {
+		t.Errorf("Unexpected resumed results: %+v", results)
+	}
+
+	// Une requête modifiée n'est pas reprise du checkpoint
+	server.received = nil
+	reqs[0].Messages = []Message{NewTextMessage(RoleUser, "un modifié")}
+	client.BatchChatCompletion(context.Background(), reqs, BatchOptions{CheckpointFile: checkpoint})
+	if len(server.received) != 1 || server.received[0] != "un modifié" {
+		t.Errorf("Expected the modified request to be sent, got %v", server.received)
+	}
+}
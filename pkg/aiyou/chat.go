@@ -19,10 +19,10 @@ along with this program.  If not, see <https://www.gnu.org/licenses/>.
 package aiyou
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -31,17 +31,29 @@ import (
 
 // StreamReader helps read and process the streaming response
 type StreamReader struct {
-	reader *bufio.Reader
-	closer io.Closer
-	logger Logger
+	decoder  *sseDecoder
+	closer   io.Closer
+	logger   Logger
+	strict   bool   // échouer sur un chunk JSON invalide plutôt que l'ignorer
+	done     bool   // [DONE] ou erreur reçue
+	finished bool   // un finish_reason a été reçu
+	usage    *Usage // dernier usage reçu
+
+	toolCalls toolCallAssembler // appels d'outils du premier choix, reconstitués au fil des deltas
+
+	onChunk    func(*ChatCompletionResponse) // observateur des chunks lus (sessions)
+	onComplete func()                        // appelé une fois à la fin normale du flux
+
+	ctx       context.Context // contexte de la requête, s'il est connu
+	stopClose func() bool     // annule la fermeture automatique à l'annulation du contexte
 }
 
 // NewStreamReader creates a new StreamReader
 func NewStreamReader(r io.ReadCloser, logger Logger) *StreamReader {
 	return &StreamReader{
-		reader: bufio.NewReader(r),
-		closer: r,
-		logger: logger,
+		decoder: newSSEDecoder(r),
+		closer:  r,
+		logger:  logger,
 	}
 }
 
@@ -49,9 +61,19 @@ func NewStreamReader(r io.ReadCloser, logger Logger) *StreamReader {
 func (c *Client) ChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
 	c.logger.Debugf("Starting ChatCompletion request")
 
-	// Première tentative en mode non-streaming
-	req.Stream = false
-	jsonData, err := json.Marshal(req)
+	if err := req.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+	if err := c.fitContext(ctx, &req); err != nil {
+		return nil, err
+	}
+
+	// Première tentative en mode non-streaming ; les options de streaming n'y sont
+	// pas acceptées et l'usage est de toute façon inclus dans la réponse
+	nonStreamReq := req
+	nonStreamReq.Stream = false
+	nonStreamReq.StreamOptions = nil
+	jsonData, err := json.Marshal(nonStreamReq)
 	if err != nil {
 		c.logger.Errorf("Failed to marshal request: %v", err)
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
@@ -76,23 +98,14 @@ func (c *Client) ChatCompletion(ctx context.Context, req ChatCompletionRequest)
 	}
 
 	// Vérifier si c'est une réponse d'erreur qui nécessite le fallback
-	var errorResp struct {
-		Object  string `json:"object"`
-		Message string `json:"message"`
-		Type    string `json:"type"`
-		Code    int    `json:"code"`
-	}
-
-	if err := json.Unmarshal(body, &errorResp); err == nil && errorResp.Object == "error" {
-		if strings.Contains(errorResp.Message, "Stream options") {
+	if apiErr, ok := parseErrorPayload(resp.StatusCode, body); ok {
+		if isStreamOptionsError(apiErr) {
 			c.logger.Debugf("Detected streaming options error, falling back to streaming aggregation")
 			return c.fallbackToStreamingAggregation(ctx, req)
 		}
 		// Autres erreurs API
-		return nil, &APIError{
-			StatusCode: resp.StatusCode,
-			Message:    fmt.Sprintf("API Error: %s - %s", errorResp.Type, errorResp.Message),
-		}
+		apiErr.Message = fmt.Sprintf("API Error: %s - %s", apiErr.Type, apiErr.Message)
+		return nil, apiErr
 	}
 
 	// Si on arrive ici, le mode non-streaming a fonctionné
@@ -110,56 +123,60 @@ func (c *Client) ChatCompletion(ctx context.Context, req ChatCompletionRequest)
 func (c *Client) fallbackToStreamingAggregation(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
 	c.logger.Infof("Falling back to streaming aggregation mode")
 
+	// Demander l'usage afin que la réponse ait la même forme qu'en mode non-streaming
 	req.Stream = true
+	if req.StreamOptions == nil {
+		req.StreamOptions = &StreamOptions{IncludeUsage: true}
+	}
+
+	fullResponse, err := c.aggregateStream(ctx, req)
+	if err != nil && isStreamOptionsError(err) {
+		// Le serveur refuse les options de streaming : réessayer sans
+		c.logger.Warnf("Stream options rejected by the server, retrying without usage statistics")
+		req.StreamOptions = nil
+		fullResponse, err = c.aggregateStream(ctx, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c.logger.Infof("Successfully completed request using streaming aggregation fallback")
+	return fullResponse, nil
+}
+
+// aggregateStream envoie une requête en streaming et reconstruit la réponse complète.
+func (c *Client) aggregateStream(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
 	stream, err := c.ChatCompletionStream(ctx, req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to start stream in fallback: %w", err)
 	}
 	defer stream.Close()
 
-	var fullResponse ChatCompletionResponse
-	var aggregatedContent strings.Builder
-
-	for {
-		chunk, err := stream.ReadChunk()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil, fmt.Errorf("error reading stream in fallback: %w", err)
-		}
-		if chunk == nil || len(chunk.Choices) == 0 {
-			continue
-		}
-
-		if fullResponse.ID == "" {
-			fullResponse = *chunk
-		}
-
-		choice := chunk.Choices[0]
-		if choice.Delta != nil && choice.Delta.Content != "" {
-			aggregatedContent.WriteString(choice.Delta.Content)
-		}
+	fullResponse, err := stream.Accumulate()
+	if err != nil {
+		return nil, fmt.Errorf("error reading stream in fallback: %w", err)
 	}
+	return fullResponse, nil
+}
 
-	if len(fullResponse.Choices) > 0 {
-		fullResponse.Choices[0].Message = Message{
-			Role: "assistant",
-			Content: []ContentPart{
-				{
-					Type: "text",
-					Text: aggregatedContent.String(),
-				},
-			},
-		}
+// isStreamOptionsError indique si err est un refus des options de streaming par le serveur.
+func isStreamOptionsError(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
 	}
-
-	c.logger.Infof("Successfully completed request using streaming aggregation fallback")
-	return &fullResponse, nil
+	message := strings.ToLower(apiErr.Message)
+	return strings.Contains(message, "stream options") || strings.Contains(message, "stream_options")
 }
 
 // ChatCompletionStream sends a streaming chat completion request
 func (c *Client) ChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (*StreamReader, error) {
+	if err := req.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+	if err := c.fitContext(ctx, &req); err != nil {
+		return nil, err
+	}
 	req.Stream = true
 
 	jsonData, err := json.Marshal(req)
@@ -168,7 +185,9 @@ func (c *Client) ChatCompletionStream(ctx context.Context, req ChatCompletionReq
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	resp, err := c.AuthenticatedRequest(ctx, "POST", "/api/v1/chat/completions", bytes.NewReader(jsonData))
+	// Le flux est borné par le délai de lecture et non par le délai global
+	streamCtx := context.WithValue(ctx, streamingRequest{}, true)
+	resp, err := c.AuthenticatedRequest(streamCtx, "POST", "/api/v1/chat/completions", bytes.NewReader(jsonData))
 	if err != nil {
 		c.logger.Errorf("ChatCompletionStream request failed: %v", err)
 		// Propager directement l'erreur
@@ -176,60 +195,170 @@ func (c *Client) ChatCompletionStream(ctx context.Context, req ChatCompletionReq
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		resp.Body.Close()
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
 		c.logger.Warnf("Unexpected status code: %d", resp.StatusCode)
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, newAPIErrorFromBody(resp.StatusCode, body)
 	}
 
-	return NewStreamReader(resp.Body, c.logger), nil
+	stream := NewStreamReader(newIdleTimeoutReader(resp.Body, c.streamReadTimeout), c.logger)
+	stream.SetStrict(c.strictStreaming)
+	stream.bindContext(ctx)
+	return stream, nil
 }
 
-// ReadChunk reads and processes a single chunk from the stream
-// Dans pkg/aiyou/chat.go
-func (sr *StreamReader) ReadChunk() (*ChatCompletionResponse, error) {
-	line, err := sr.reader.ReadBytes('\n')
+// ReadEvent returns the next raw Server-Sent Event of the stream, including its
+// type and ID. It returns io.EOF once the stream is over.
+func (sr *StreamReader) ReadEvent() (*StreamEvent, error) {
+	if sr.done {
+		return nil, io.EOF
+	}
+	event, err := sr.decoder.Next()
 	if err != nil {
-		if err == io.EOF {
-			return nil, err
+		// Corps fermé suite à l'annulation du contexte
+		if sr.ctx != nil && sr.ctx.Err() != nil {
+			return nil, sr.ctx.Err()
+		}
+		if err != io.EOF {
+			sr.logger.Errorf("Error reading stream: %v", err)
 		}
-		sr.logger.Errorf("Error reading stream: %v", err)
 		return nil, err
 	}
+	return event, nil
+}
 
-	// Nettoyer la ligne
-	line = bytes.TrimSpace(line)
-	if len(line) == 0 {
-		return sr.ReadChunk() // Continuer à lire si la ligne est vide
-	}
+// bindContext ferme le flux dès que ctx est annulé, afin qu'un flux abandonné
+// ne retienne pas sa connexion.
+func (sr *StreamReader) bindContext(ctx context.Context) {
+	sr.ctx = ctx
+	sr.stopClose = context.AfterFunc(ctx, func() {
+		sr.closer.Close()
+	})
+}
 
-	// Vérifier si c'est la fin du stream
-	if string(line) == "[DONE]" {
-		return nil, io.EOF
-	}
+// LastEventID returns the ID of the last event received, as needed to resume a stream.
+func (sr *StreamReader) LastEventID() string {
+	return sr.decoder.lastID
+}
 
-	// Vérifier et traiter le préfixe "data: "
-	if bytes.HasPrefix(line, []byte("data: ")) {
-		line = bytes.TrimPrefix(line, []byte("data: "))
-	} else {
-		sr.logger.Debugf("Skipping non-data line: %s", string(line))
-		return sr.ReadChunk() // Ignorer les lignes sans préfixe "data: "
+// Usage returns the last token usage received on the stream, or nil if none was sent.
+// With StreamOptions.ContinuousUsageStats it is updated on every chunk; once the
+// stream is over it holds the final usage (requires StreamOptions.IncludeUsage).
+func (sr *StreamReader) Usage() *Usage {
+	if sr.usage == nil {
+		return nil
 	}
+	usage := *sr.usage
+	return &usage
+}
+
+// ToolCalls returns the tool calls of the first choice assembled from the
+// deltas read so far. Arguments are complete once the choice has finished
+// with FinishReasonToolCalls.
+func (sr *StreamReader) ToolCalls() []ToolCall {
+	return sr.toolCalls.toolCalls()
+}
+
+// SetStrict sets whether a chunk that is not valid JSON aborts the stream with
+// ErrMalformedChunk (strict) or is logged and skipped (default).
+func (sr *StreamReader) SetStrict(strict bool) {
+	sr.strict = strict
+}
+
+// ReadChunk reads and processes a single chunk from the stream.
+// It returns io.EOF at the end of the stream, an *APIError for error events
+// and error payloads, and ErrStreamTruncated if the stream ends before
+// [DONE] or a finish_reason.
+func (sr *StreamReader) ReadChunk() (*ChatCompletionResponse, error) {
+	for {
+		event, err := sr.ReadEvent()
+		if err == io.EOF && !sr.done && !sr.finished {
+			sr.logger.Warnf("Stream ended without [DONE] or finish_reason")
+			return nil, ErrStreamTruncated
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("%w: %v", ErrStreamTruncated, err)
+		}
+		if err == io.EOF {
+			sr.complete()
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Fin du flux
+		if event.IsDone() {
+			sr.done = true
+			sr.complete()
+			return nil, io.EOF
+		}
 
-	// Vérifier si la ligne est vide après le trim
-	if len(bytes.TrimSpace(line)) == 0 {
-		return sr.ReadChunk()
+		if event.Event == "error" {
+			sr.done = true
+			return nil, newStreamError(event.Data)
+		}
+
+		data := bytes.TrimSpace(event.Data)
+		if len(data) == 0 {
+			continue
+		}
+
+		// Objet d'erreur envoyé par le serveur au milieu du flux
+		if apiErr, ok := parseErrorPayload(http.StatusOK, data); ok {
+			sr.done = true
+			sr.logger.Errorf("Error received in stream: %s", apiErr.Message)
+			return nil, apiErr
+		}
+
+		var chunk ChatCompletionResponse
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			if sr.strict {
+				sr.done = true
+				return nil, fmt.Errorf("%w: %v, raw data: %s", ErrMalformedChunk, err, string(data))
+			}
+			sr.logger.Errorf("Failed to unmarshal chunk: %v, raw data: %s", err, string(data))
+			continue
+		}
+
+		for _, choice := range chunk.Choices {
+			if choice.FinishReason != "" {
+				sr.finished = true
+			}
+			if choice.Index == 0 && choice.Delta != nil {
+				sr.toolCalls.add(choice.Delta.ToolCalls)
+			}
+		}
+		if chunk.Usage != nil {
+			usage := *chunk.Usage
+			sr.usage = &usage
+		}
+		if sr.onChunk != nil {
+			sr.onChunk(&chunk)
+		}
+		return &chunk, nil
 	}
+}
 
-	var chunk ChatCompletionResponse
-	if err := json.Unmarshal(line, &chunk); err != nil {
-		sr.logger.Errorf("Failed to unmarshal chunk: %v, raw data: %s", err, string(line))
-		// Option 1 : continuer à lire
-		return sr.ReadChunk()
-		// Option 2 : retourner l'erreur
-		// return nil, fmt.Errorf("failed to unmarshal chunk: %w, raw data: %s", err, string(line))
+// complete signale la fin normale du flux à l'observateur éventuel, une seule fois.
+func (sr *StreamReader) complete() {
+	if sr.onComplete != nil {
+		onComplete := sr.onComplete
+		sr.onComplete = nil
+		onComplete()
 	}
+}
 
-	return &chunk, nil
+// newStreamError convertit les données d'un événement d'erreur en APIError.
+// La réponse HTTP ayant abouti, le statut par défaut est 200.
+func newStreamError(data []byte) *APIError {
+	apiErr := newAPIErrorFromBody(0, data)
+	if apiErr.StatusCode == 0 {
+		apiErr.StatusCode = http.StatusOK
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = "error event received in stream"
+	}
+	return apiErr
 }
 
 // SetLogger sets a custom logger for the StreamReader
@@ -237,7 +366,53 @@ func (sr *StreamReader) SetLogger(logger Logger) {
 	sr.logger = logger
 }
 
-// Close closes the underlying reader
+// Close closes the underlying reader. It is safe to call it more than once.
 func (sr *StreamReader) Close() error {
+	if sr.stopClose != nil {
+		sr.stopClose()
+	}
 	return sr.closer.Close()
 }
+
+// StreamResult is a chunk or an error delivered by StreamReader.Chunks.
+type StreamResult struct {
+	Chunk *ChatCompletionResponse
+	Err   error
+}
+
+// Chunks reads the stream in a goroutine and delivers its chunks on the returned
+// channel, followed by at most one result carrying an error other than io.EOF.
+// The channel is closed and the stream released at the end of the stream or
+// when ctx is cancelled.
+func (sr *StreamReader) Chunks(ctx context.Context) <-chan StreamResult {
+	results := make(chan StreamResult)
+	stop := context.AfterFunc(ctx, func() {
+		sr.Close()
+	})
+
+	go func() {
+		defer close(results)
+		defer stop()
+		defer sr.Close()
+
+		for {
+			chunk, err := sr.ReadChunk()
+			if err == io.EOF {
+				return
+			}
+			if err != nil && ctx.Err() != nil {
+				err = ctx.Err()
+			}
+
+			select {
+			case results <- StreamResult{Chunk: chunk, Err: err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return results
+}
@@ -0,0 +1,145 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// File: pkg/aiyou/chat_options.go
+
+package aiyou
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Bornes des paramètres d'échantillonnage acceptées par l'API
+const (
+	MinTemperature = 0.0
+	MaxTemperature = 10.0
+	MaxTopP        = 1.0
+)
+
+// Ptr retourne un pointeur vers v, pour renseigner les champs optionnels
+// d'une requête : Temperature: aiyou.Ptr(0.7).
+func Ptr[T any](v T) *T {
+	return &v
+}
+
+// Validate vérifie la requête avant son envoi. Les paramètres non renseignés
+// (nil) ne sont pas envoyés et l'assistant applique alors sa configuration.
+func (r *ChatCompletionRequest) Validate() error {
+	if len(r.Messages) == 0 {
+		return errors.New("at least one message is required")
+	}
+	if r.Temperature != nil && (*r.Temperature < MinTemperature || *r.Temperature > MaxTemperature) {
+		return fmt.Errorf("temperature must be between %v and %v, got %v", MinTemperature, MaxTemperature, *r.Temperature)
+	}
+	if r.TopP != nil && (*r.TopP <= 0 || *r.TopP > MaxTopP) {
+		return fmt.Errorf("top_p must be in (0, %v], got %v", MaxTopP, *r.TopP)
+	}
+	if r.MaxTokens != nil && *r.MaxTokens <= 0 {
+		return fmt.Errorf("max_tokens must be positive, got %d", *r.MaxTokens)
+	}
+	for _, stop := range r.Stop {
+		if stop == "" {
+			return errors.New("stop sequences cannot be empty")
+		}
+	}
+	for i, tool := range r.Tools {
+		if tool.Function.Name == "" {
+			return fmt.Errorf("tool %d has no function name", i)
+		}
+	}
+	for i, msg := range r.Messages {
+		if msg.Role == RoleTool && msg.ToolCallID == "" {
+			return fmt.Errorf("message %d has the tool role but no tool_call_id", i)
+		}
+	}
+	return nil
+}
+
+// ChatOption modifie une requête construite par CreateChatCompletion
+// ou CreateChatCompletionStream.
+type ChatOption func(*ChatCompletionRequest)
+
+// WithModel sets the model used instead of the assistant's one.
+func WithModel(model string) ChatOption {
+	return func(r *ChatCompletionRequest) {
+		r.Model = model
+	}
+}
+
+// WithTemperature sets the sampling temperature.
+func WithTemperature(temperature float64) ChatOption {
+	return func(r *ChatCompletionRequest) {
+		r.Temperature = &temperature
+	}
+}
+
+// WithTopP sets the nucleus sampling probability mass.
+func WithTopP(topP float64) ChatOption {
+	return func(r *ChatCompletionRequest) {
+		r.TopP = &topP
+	}
+}
+
+// WithMaxTokens limits the number of tokens generated.
+func WithMaxTokens(maxTokens int) ChatOption {
+	return func(r *ChatCompletionRequest) {
+		r.MaxTokens = &maxTokens
+	}
+}
+
+// WithStop sets the sequences that stop the generation.
+func WithStop(stop ...string) ChatOption {
+	return func(r *ChatCompletionRequest) {
+		r.Stop = stop
+	}
+}
+
+// WithPromptSystem sets a custom system prompt.
+func WithPromptSystem(prompt string) ChatOption {
+	return func(r *ChatCompletionRequest) {
+		r.PromptSystem = prompt
+	}
+}
+
+// WithThreadID attaches the request to an existing conversation thread.
+func WithThreadID(threadID string) ChatOption {
+	return func(r *ChatCompletionRequest) {
+		r.ThreadId = threadID
+	}
+}
+
+// WithTools sets the tools the model may call.
+func WithTools(tools ...Tool) ChatOption {
+	return func(r *ChatCompletionRequest) {
+		r.Tools = tools
+	}
+}
+
+// WithToolChoice controls whether and which tool the model calls.
+func WithToolChoice(choice *ToolChoice) ChatOption {
+	return func(r *ChatCompletionRequest) {
+		r.ToolChoice = choice
+	}
+}
+
+// WithStreamOptions sets the streaming options, e.g. to receive token usage.
+func WithStreamOptions(options StreamOptions) ChatOption {
+	return func(r *ChatCompletionRequest) {
+		r.StreamOptions = &options
+	}
+}
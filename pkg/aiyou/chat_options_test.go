@@ -0,0 +1,117 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package aiyou
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestChatCompletionRequestOmitsUnsetParameters(t *testing.T) {
+	data, err := json.Marshal(ChatCompletionRequest{
+		Messages:    []Message{NewTextMessage("user", "Hello")},
+		AssistantID: "287",
+	})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	var fields map[string]interface{}
+	json.Unmarshal(data, &fields)
+	for _, name := range []string{"temperature", "top_p", "max_tokens", "model", "stop"} {
+		if _, ok := fields[name]; ok {
+			t.Errorf("Expected %s to be omitted, got %s", name, data)
+		}
+	}
+}
+
+func TestChatCompletionRequestValidate(t *testing.T) {
+	messages := []Message{NewTextMessage("user", "Hello")}
+	tests := []struct {
+		name    string
+		req     ChatCompletionRequest
+		wantErr bool
+	}{
+		{"Defaults", ChatCompletionRequest{Messages: messages}, false},
+		{"Explicit zero temperature", ChatCompletionRequest{Messages: messages, Temperature: Ptr(0.0)}, false},
+		{"Valid parameters", ChatCompletionRequest{Messages: messages, Temperature: Ptr(0.7), TopP: Ptr(0.9), MaxTokens: Ptr(100)}, false},
+		{"No messages", ChatCompletionRequest{}, true},
+		{"Temperature too high", ChatCompletionRequest{Messages: messages, Temperature: Ptr(11.0)}, true},
+		{"Negative temperature", ChatCompletionRequest{Messages: messages, Temperature: Ptr(-0.1)}, true},
+		{"Zero top_p", ChatCompletionRequest{Messages: messages, TopP: Ptr(0.0)}, true},
+		{"top_p above one", ChatCompletionRequest{Messages: messages, TopP: Ptr(1.5)}, true},
+		{"Zero max_tokens", ChatCompletionRequest{Messages: messages, MaxTokens: Ptr(0)}, true},
+		{"Empty stop sequence", ChatCompletionRequest{Messages: messages, Stop: []string{""}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.req.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCreateChatCompletionOptions(t *testing.T) {
+	var received map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		w.Write([]byte(`{"id":"1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":[{"type":"text","text":"Hi"}]},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(
+		WithBearerToken("test_token"),
+		WithBaseURL(server.URL),
+		WithLogger(NewDefaultLogger(io.Discard)),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	_, err = client.CreateChatCompletion(context.Background(),
+		[]Message{NewTextMessage("user", "Hello")}, "287",
+		WithModel("mistral-small"),
+		WithTemperature(0),
+		WithMaxTokens(64),
+		WithStop("\n\n", "END"),
+	)
+	if err != nil {
+		t.Fatalf("CreateChatCompletion failed: %v", err)
+	}
+
+	if received["model"] != "mistral-small" || received["temperature"] != 0.0 || received["max_tokens"] != 64.0 {
+		t.Errorf("Unexpected request: %v", received)
+	}
+	if stop, _ := received["stop"].([]interface{}); len(stop) != 2 {
+		t.Errorf("Expected 2 stop sequences, got %v", received["stop"])
+	}
+	if _, ok := received["top_p"]; ok {
+		t.Error("Expected top_p to be omitted")
+	}
+
+	if _, err := client.CreateChatCompletion(context.Background(),
+		[]Message{NewTextMessage("user", "Hello")}, "287", WithTopP(2)); err == nil {
+		t.Error("Expected validation error for top_p out of range")
+	}
+}
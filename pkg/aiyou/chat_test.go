@@ -128,8 +128,8 @@ func TestChatCompletionWithComplexMessage(t *testing.T) {
 	req := ChatCompletionRequest{
 		Messages:    []Message{builder.Build()},
 		AssistantID: "287", // Utiliser un ID d'assistant valide
-		Temperature: 7,
-		TopP:        1.0,
+		Temperature: Ptr(7.0),
+		TopP:        Ptr(1.0),
 	}
 
 	t.Log("Sending complex chat completion request...")
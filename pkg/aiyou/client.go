@@ -27,30 +27,47 @@ import (
 	"time"
 )
 
+// DefaultBaseURL is the base URL used when none is configured.
+const DefaultBaseURL = "https://ai.dragonflygroup.fr"
+
 // Client represents a client for the AI.YOU API.
 type Client struct {
-	baseURL      string
-	httpClient   *http.Client
-	auth         Authenticator
-	maxRetries   int
-	initialDelay time.Duration
-	logger       Logger
-	safeLog      func(level LogLevel, format string, args ...interface{})
-	rateLimiter  *RateLimiter
+	baseURL          string
+	httpClient       *http.Client
+	streamHTTPClient *http.Client // httpClient sans délai global, pour le streaming
+	auth             Authenticator
+	retryPolicy      RetryPolicy
+	logger           Logger
+	safeLog          func(level LogLevel, format string, args ...interface{})
+	rateLimiter      *RateLimiter
+	middlewares      []Middleware
+
+	credentialsProvider CredentialsProvider
+	tokenRefreshSkew    time.Duration
+	tokenStore          TokenStore
+
+	customHTTPClient  *http.Client
+	customTransport   http.RoundTripper
+	transport         transportConfig
+	streamReadTimeout time.Duration
+	strictStreaming   bool
+	contextWindow     *ContextWindow
+	summaries         *summaryCache
 }
 
 // ClientOption is a function type to modify Client.
 type ClientOption func(*Client) error
 
 // NewClient creates a new instance of Client with the given options.
-// At least one authentication method (email/password or bearer token) must be provided.
+// At least one authentication method (email/password, bearer token or credentials provider) must be provided.
 func NewClient(options ...ClientOption) (*Client, error) {
 	client := &Client{
-		baseURL:      "https://ai.dragonflygroup.fr",
-		httpClient:   &http.Client{Timeout: 30 * time.Second},
-		maxRetries:   3,
-		initialDelay: time.Second,
-		logger:       NewDefaultLogger(os.Stderr),
+		baseURL:           DefaultBaseURL,
+		retryPolicy:       DefaultRetryPolicy(),
+		logger:            NewDefaultLogger(os.Stderr),
+		streamReadTimeout: DefaultStreamReadTimeout,
+		tokenRefreshSkew:  DefaultTokenRefreshSkew,
+		summaries:         newSummaryCache(),
 	}
 
 	var err error
@@ -62,14 +79,44 @@ func NewClient(options ...ClientOption) (*Client, error) {
 
 	client.safeLog = SafeLog(client.logger)
 
+	// Les options explicites priment sur le fournisseur d'identifiants
+	if client.auth == nil && client.credentialsProvider != nil {
+		client.auth = newCredentialsAuthenticator(client.credentialsProvider, client.logger)
+	}
+
 	// Vérifier qu'une méthode d'authentification a été configurée
 	if client.auth == nil {
-		return nil, fmt.Errorf("no authentication method provided: use WithEmailPassword or WithBearerToken")
+		return nil, fmt.Errorf("no authentication method provided: use WithEmailPassword, WithBearerToken or WithCredentialsProvider")
 	}
 
+	client.httpClient, err = client.buildHTTPClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure http client: %w", err)
+	}
+	client.streamHTTPClient = streamingHTTPClient(client.httpClient)
+	client.bindAuthenticator()
+
 	return client, nil
 }
 
+// bindAuthenticator aligns the JWT authenticator with the final client configuration,
+// whatever the order in which the options were applied.
+func (c *Client) bindAuthenticator() {
+	switch auth := c.auth.(type) {
+	case *JWTAuthenticator:
+		c.configureJWT(auth)
+	case *credentialsAuthenticator:
+		auth.setJWTConfigurer(c.configureJWT)
+	}
+}
+
+// configureJWT applique la configuration du client à un authentificateur JWT.
+func (c *Client) configureJWT(auth *JWTAuthenticator) {
+	auth.setTransport(c.httpClient, c.baseURL)
+	auth.SetRefreshSkew(c.tokenRefreshSkew)
+	auth.SetTokenStore(c.tokenStore)
+}
+
 // WithEmailPassword configures the client to use email/password authentication
 func WithEmailPassword(email, password string) ClientOption {
 	return func(c *Client) error {
@@ -94,21 +141,37 @@ func WithBearerToken(token string) ClientOption {
 	}
 }
 
+// WithTokenRefreshSkew sets how long before its expiry the JWT token is renewed,
+// so that requests never go out with a token about to expire.
+func WithTokenRefreshSkew(skew time.Duration) ClientOption {
+	return func(c *Client) error {
+		if skew < 0 {
+			return fmt.Errorf("token refresh skew cannot be negative")
+		}
+		c.tokenRefreshSkew = skew
+		return nil
+	}
+}
+
+// WithTokenStore sets the store used to persist JWT tokens across process restarts,
+// keyed by base URL and email. See NewFileTokenStore and NewMemoryTokenStore.
+func WithTokenStore(store TokenStore) ClientOption {
+	return func(c *Client) error {
+		if store == nil {
+			return fmt.Errorf("token store cannot be nil")
+		}
+		c.tokenStore = store
+		return nil
+	}
+}
+
 // WithLogger sets a custom logger for the client.
 func WithLogger(logger Logger) ClientOption {
 	return func(c *Client) error {
 		if logger == nil {
 			return fmt.Errorf("logger cannot be nil")
 		}
-		c.logger = logger
-		if c.auth != nil {
-			switch auth := c.auth.(type) {
-			case *JWTAuthenticator:
-				auth.SetLogger(logger)
-			case *BearerAuthenticator:
-				auth.SetLogger(logger)
-			}
-		}
+		c.SetLogger(logger)
 		return nil
 	}
 }
@@ -133,8 +196,23 @@ func WithRetry(maxRetries int, initialDelay time.Duration) ClientOption {
 		if initialDelay < 0 {
 			return fmt.Errorf("initialDelay cannot be negative")
 		}
-		c.maxRetries = maxRetries
-		c.initialDelay = initialDelay
+		c.retryPolicy = &ExponentialBackoff{
+			MaxRetries:   maxRetries,
+			InitialDelay: initialDelay,
+			Multiplier:   2,
+		}
+		return nil
+	}
+}
+
+// WithRetryPolicy sets the policy deciding whether and when failed requests are retried.
+// A policy attached to a request context with ContextWithRetryPolicy takes precedence.
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(c *Client) error {
+		if policy == nil {
+			return fmt.Errorf("retry policy cannot be nil")
+		}
+		c.retryPolicy = policy
 		return nil
 	}
 }
@@ -147,6 +225,15 @@ func WithRateLimiter(config RateLimiterConfig) ClientOption {
 	}
 }
 
+// WithStrictStreaming makes streams returned by ChatCompletionStream fail with
+// ErrMalformedChunk on invalid JSON instead of logging and skipping the chunk.
+func WithStrictStreaming(strict bool) ClientOption {
+	return func(c *Client) error {
+		c.strictStreaming = strict
+		return nil
+	}
+}
+
 // SetBearerToken updates the bearer token if using bearer token authentication
 func (c *Client) SetBearerToken(token string) error {
 	if token == "" {
@@ -164,10 +251,21 @@ func (c *Client) SetBearerToken(token string) error {
 }
 
 // AuthenticatedRequest performs an authenticated request to the API.
+// The body is read once and replayed identically on every retry.
 func (c *Client) AuthenticatedRequest(ctx context.Context, method, path string, body io.Reader) (*http.Response, error) {
+	payload, err := newReaderBody(body, "application/json")
+	if err != nil {
+		c.safeLog(ERROR, "Failed to buffer request body: %v", err)
+		return nil, err
+	}
+	return c.sendAuthenticated(ctx, method, path, payload)
+}
+
+// sendAuthenticated performs an authenticated request with a replayable body.
+func (c *Client) sendAuthenticated(ctx context.Context, method, path string, body *requestBody) (*http.Response, error) {
 	c.safeLog(DEBUG, "Preparing authenticated request: %s %s", method, path)
 
-	if c.rateLimiter != nil {
+	if c.rateLimiter != nil && !takeRateLimitReservation(ctx) {
 		if err := c.rateLimiter.Wait(ctx); err != nil {
 			c.safeLog(WARN, "Client-side rate limit exceeded: %v", err)
 			waitTime := c.rateLimiter.GetWaitTime()
@@ -178,37 +276,53 @@ func (c *Client) AuthenticatedRequest(ctx context.Context, method, path string,
 		}
 	}
 
-	var resp *http.Response
-	err := retryOperation(ctx, c.logger, c.maxRetries, c.initialDelay, func() error {
-		if err := c.auth.Authenticate(ctx); err != nil {
-			c.safeLog(ERROR, "Authentication failed: %v", err)
-			return &AuthenticationError{Message: err.Error()}
-		}
+	policy := retryPolicyFromContext(ctx, c.retryPolicy)
 
-		req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	var resp *http.Response
+	reauthenticated := false
+	err := retryWithPolicy(ctx, c.logger, policy, func() error {
+		var token string
+		var err error
+		resp, token, err = c.doAuthenticated(ctx, method, path, body)
 		if err != nil {
-			c.safeLog(ERROR, "Failed to create request: %v", err)
-			return fmt.Errorf("failed to create request: %w", err)
+			return err
 		}
 
-		req.Header.Set("Authorization", "Bearer "+c.auth.Token())
-		req.Header.Set("Content-Type", "application/json")
-
-		c.safeLog(DEBUG, "Sending request to %s", req.URL)
-		resp, err = c.httpClient.Do(req)
-		if err != nil {
-			c.safeLog(ERROR, "Request failed: %v", err)
-			return &NetworkError{Err: err}
+		// Token rejeté : on force un nouveau login et on rejoue la requête une fois
+		if resp.StatusCode == http.StatusUnauthorized && !reauthenticated {
+			if auth, ok := c.auth.(RefreshableAuthenticator); ok {
+				reauthenticated = true
+				resp.Body.Close()
+				auth.Invalidate(token)
+				c.safeLog(WARN, "Request rejected with status 401, re-authenticating and replaying")
+				resp, _, err = c.doAuthenticated(ctx, method, path, body)
+				if err != nil {
+					return err
+				}
+			}
 		}
 
 		if resp.StatusCode == http.StatusTooManyRequests {
-			c.safeLog(WARN, "Server-side rate limit exceeded, retrying after 60 seconds")
+			resp.Body.Close()
+			retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+			c.safeLog(WARN, "Server-side rate limit exceeded, server asked to retry after %d seconds", retryAfter)
 			return &RateLimitError{
-				RetryAfter:   60,
+				RetryAfter:   retryAfter,
 				IsClientSide: false,
 			}
 		}
 
+		if isRetryableStatus(resp.StatusCode) {
+			message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+			c.safeLog(WARN, "Server temporarily unavailable with status: %d", resp.StatusCode)
+			return &APIError{
+				StatusCode: resp.StatusCode,
+				Message:    string(message),
+				RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+			}
+		}
+
 		c.safeLog(INFO, "Request completed with status: %d", resp.StatusCode)
 		return nil
 	})
@@ -220,9 +334,44 @@ func (c *Client) AuthenticatedRequest(ctx context.Context, method, path string,
 	return resp, nil
 }
 
+// doAuthenticated authenticates then sends a single attempt of the request.
+// It also returns the token that was sent with the request.
+func (c *Client) doAuthenticated(ctx context.Context, method, path string, body *requestBody) (*http.Response, string, error) {
+	if err := c.auth.Authenticate(ctx); err != nil {
+		c.safeLog(ERROR, "Authentication failed: %v", err)
+		return nil, "", &AuthenticationError{Message: err.Error(), Err: err}
+	}
+
+	req, err := c.newHTTPRequest(ctx, method, path, body)
+	if err != nil {
+		c.safeLog(ERROR, "Failed to create request: %v", err)
+		return nil, "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	token := c.auth.Token()
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body == nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	httpClient := c.httpClient
+	if ctx.Value(streamingRequest{}) != nil {
+		httpClient = c.streamHTTPClient
+	}
+
+	c.safeLog(DEBUG, "Sending request to %s", req.URL)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		c.safeLog(ERROR, "Request failed: %v", err)
+		return nil, token, &NetworkError{Err: err}
+	}
+	return resp, token, nil
+}
+
 // SetBaseURL sets the base URL for API requests
 func (c *Client) SetBaseURL(url string) {
 	c.baseURL = url
+	c.bindAuthenticator()
 }
 
 // SetLogger sets the logger for the client
@@ -234,27 +383,35 @@ func (c *Client) SetLogger(logger Logger) {
 			auth.SetLogger(logger)
 		case *BearerAuthenticator:
 			auth.SetLogger(logger)
+		case *credentialsAuthenticator:
+			auth.SetLogger(logger)
 		}
 	}
 	c.safeLog = SafeLog(logger)
 }
 
 // CreateChatCompletion is a helper method that wraps ChatCompletion
-func (c *Client) CreateChatCompletion(ctx context.Context, messages []Message, assistantID string) (*ChatCompletionResponse, error) {
+func (c *Client) CreateChatCompletion(ctx context.Context, messages []Message, assistantID string, options ...ChatOption) (*ChatCompletionResponse, error) {
 	req := ChatCompletionRequest{
 		Messages:    messages,
 		AssistantID: assistantID,
 		Stream:      false,
 	}
+	for _, option := range options {
+		option(&req)
+	}
 	return c.ChatCompletion(ctx, req)
 }
 
 // CreateChatCompletionStream is a helper method that wraps ChatCompletionStream
-func (c *Client) CreateChatCompletionStream(ctx context.Context, messages []Message, assistantID string) (*StreamReader, error) {
+func (c *Client) CreateChatCompletionStream(ctx context.Context, messages []Message, assistantID string, options ...ChatOption) (*StreamReader, error) {
 	req := ChatCompletionRequest{
 		Messages:    messages,
 		AssistantID: assistantID,
 		Stream:      true,
 	}
+	for _, option := range options {
+		option(&req)
+	}
 	return c.ChatCompletionStream(ctx, req)
 }
@@ -17,31 +17,354 @@ along with this program.  If not, see <https://www.gnu.org/licenses/>.
 package aiyou
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
 	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
+// EnvConfigFile désigne le fichier de configuration lu par LoadConfig
+const EnvConfigFile = "AIYOU_CONFIG"
+
 // Config contient les paramètres de configuration pour le client AI.YOU.
+// Elle peut être chargée depuis un fichier YAML ou JSON (LoadConfigFile),
+// depuis l'environnement (LoadEnv) ou les deux (LoadConfig), puis convertie
+// en client avec NewClientFromConfig. Les durées s'écrivent "30s", "2m", etc.
 type Config struct {
-	BaseURL    string
-	APIKey     string
-	Timeout    time.Duration
-	RetryCount int
+	BaseURL string `yaml:"base_url"`
+
+	// Authentification : APIKey (bearer token) ou Email/Password
+	APIKey   string `yaml:"api_key"`
+	Email    string `yaml:"email"`
+	Password string `yaml:"password"`
+
+	// Délais du transport HTTP ; une valeur nulle conserve la valeur par défaut.
+	// Timeout borne une requête non streamée complète (DefaultRequestTimeout
+	// par défaut), ResponseHeaderTimeout l'attente des en-têtes de réponse.
+	Timeout               time.Duration `yaml:"timeout"`
+	ResponseHeaderTimeout time.Duration `yaml:"response_header_timeout"`
+	ConnectTimeout        time.Duration `yaml:"connect_timeout"`
+	TLSHandshakeTimeout   time.Duration `yaml:"tls_handshake_timeout"`
+	IdleConnTimeout       time.Duration `yaml:"idle_conn_timeout"`
+	StreamReadTimeout     time.Duration `yaml:"stream_read_timeout"`
+
+	// Retry : 0 conserve la politique par défaut (DefaultRetryPolicy), une
+	// valeur négative désactive les nouvelles tentatives.
+	RetryCount    int           `yaml:"retry_count"`
+	RetryDelay    time.Duration `yaml:"retry_delay"`
+	MaxRetryDelay time.Duration `yaml:"max_retry_delay"`
+
+	LogLevel  string             `yaml:"log_level"` // debug, info, warn ou error
+	RateLimit *RateLimiterConfig `yaml:"rate_limit"`
+
+	// Proxy et TLS
+	ProxyURL       string `yaml:"proxy_url"`
+	CACertFile     string `yaml:"ca_cert_file"`
+	ClientCertFile string `yaml:"client_cert_file"`
+	ClientKeyFile  string `yaml:"client_key_file"`
+
+	// Tokens JWT
+	TokenRefreshSkew time.Duration `yaml:"token_refresh_skew"`
+	TokenCacheDir    string        `yaml:"token_cache_dir"` // active le cache fichier des tokens
+}
+
+// configFile est le format du fichier de configuration : les champs de
+// premier niveau s'appliquent à tous les profils, chaque profil nommé sous
+// "profiles" surcharge les champs qu'il définit.
+type configFile struct {
+	Config   `yaml:",inline"`
+	Profile  string               `yaml:"profile"` // profil utilisé par défaut
+	Profiles map[string]yaml.Node `yaml:"profiles"`
 }
 
-// Validate vérifie que la configuration est valide.
+// Validate vérifie que la configuration est valide. Une URL de base absente
+// est remplacée par DefaultBaseURL.
 func (c *Config) Validate() error {
 	if c.BaseURL == "" {
-		return errors.New("BaseURL est requis")
+		c.BaseURL = DefaultBaseURL // Valeur par défaut
 	}
-	if c.APIKey == "" {
-		return errors.New("APIKey est requis")
+	if c.APIKey == "" && (c.Email == "" || c.Password == "") {
+		return errors.New("APIKey ou Email et Password sont requis")
 	}
-	if c.Timeout <= 0 {
-		c.Timeout = 30 * time.Second // Valeur par défaut
+	if c.Timeout < 0 || c.ResponseHeaderTimeout < 0 || c.ConnectTimeout < 0 || c.TLSHandshakeTimeout < 0 || c.IdleConnTimeout < 0 || c.StreamReadTimeout < 0 {
+		return errors.New("les délais ne peuvent pas être négatifs")
 	}
-	if c.RetryCount < 0 {
-		c.RetryCount = 0
+	if c.RetryDelay < 0 || c.MaxRetryDelay < 0 || c.TokenRefreshSkew < 0 {
+		return errors.New("les délais de retry et de renouvellement ne peuvent pas être négatifs")
+	}
+	if c.LogLevel != "" {
+		if _, err := ParseLogLevel(c.LogLevel); err != nil {
+			return err
+		}
+	}
+	if c.RateLimit != nil && (c.RateLimit.RequestsPerSecond <= 0 || c.RateLimit.BurstSize <= 0) {
+		return errors.New("rate_limit requiert requests_per_second et burst_size positifs")
+	}
+	if (c.ClientCertFile == "") != (c.ClientKeyFile == "") {
+		return errors.New("client_cert_file et client_key_file doivent être fournis ensemble")
 	}
 	return nil
 }
+
+// ClientOptions convertit la configuration en options du client.
+func (c *Config) ClientOptions() ([]ClientOption, error) {
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	options := []ClientOption{WithBaseURL(c.BaseURL)}
+
+	if c.APIKey != "" {
+		options = append(options, WithBearerToken(c.APIKey))
+	} else {
+		options = append(options, WithEmailPassword(c.Email, c.Password))
+	}
+
+	timeouts := TimeoutConfig{
+		Connect:        c.ConnectTimeout,
+		TLSHandshake:   c.TLSHandshakeTimeout,
+		Request:        c.Timeout,
+		ResponseHeader: c.ResponseHeaderTimeout,
+		IdleConn:       c.IdleConnTimeout,
+	}
+	if timeouts != (TimeoutConfig{}) {
+		options = append(options, WithTimeouts(timeouts))
+	}
+	if c.StreamReadTimeout > 0 {
+		options = append(options, WithStreamReadTimeout(c.StreamReadTimeout))
+	}
+
+	if c.RetryCount != 0 || c.RetryDelay > 0 || c.MaxRetryDelay > 0 {
+		policy := DefaultRetryPolicy()
+		switch {
+		case c.RetryCount < 0:
+			policy.MaxRetries = 0
+		case c.RetryCount > 0:
+			policy.MaxRetries = c.RetryCount
+		}
+		if c.RetryDelay > 0 {
+			policy.InitialDelay = c.RetryDelay
+		}
+		policy.MaxDelay = c.MaxRetryDelay
+		options = append(options, WithRetryPolicy(policy))
+	}
+
+	if c.RateLimit != nil {
+		options = append(options, WithRateLimiter(*c.RateLimit))
+	}
+
+	if c.ProxyURL != "" {
+		options = append(options, WithProxy(c.ProxyURL))
+	}
+	if c.CACertFile != "" {
+		options = append(options, WithCACertFile(c.CACertFile))
+	}
+	if c.ClientCertFile != "" {
+		options = append(options, WithClientCertificate(c.ClientCertFile, c.ClientKeyFile))
+	}
+
+	if c.TokenRefreshSkew > 0 {
+		options = append(options, WithTokenRefreshSkew(c.TokenRefreshSkew))
+	}
+	if c.TokenCacheDir != "" {
+		store, err := NewFileTokenStore(c.TokenCacheDir)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, WithTokenStore(store))
+	}
+
+	return options, nil
+}
+
+// NewClientFromConfig crée un client à partir de la configuration. Les options
+// supplémentaires sont appliquées après celles issues de la configuration ;
+// le niveau de log configuré s'applique aussi à un logger fourni par WithLogger.
+func NewClientFromConfig(cfg *Config, options ...ClientOption) (*Client, error) {
+	if cfg == nil {
+		return nil, errors.New("config cannot be nil")
+	}
+
+	configOptions, err := cfg.ClientOptions()
+	if err != nil {
+		return nil, err
+	}
+	configOptions = append(configOptions, options...)
+
+	if cfg.LogLevel != "" {
+		level, _ := ParseLogLevel(cfg.LogLevel)
+		configOptions = append(configOptions, func(c *Client) error {
+			c.logger.SetLevel(level)
+			return nil
+		})
+	}
+
+	return NewClient(configOptions...)
+}
+
+// LoadConfig charge la configuration depuis le fichier path (ou $AIYOU_CONFIG
+// si path est vide, aucun fichier si les deux sont vides), puis applique les
+// variables d'environnement, qui sont prioritaires. Voir LoadConfigFile pour
+// le choix du profil.
+func LoadConfig(path, profile string) (*Config, error) {
+	if path == "" {
+		path = os.Getenv(EnvConfigFile)
+	}
+
+	cfg := &Config{}
+	if path != "" {
+		var err error
+		if cfg, err = LoadConfigFile(path, profile); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.LoadEnv(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// LoadConfigFile charge un fichier de configuration YAML ou JSON. Le profil
+// appliqué est profile, à défaut $AIYOU_PROFILE, à défaut la clé "profile"
+// du fichier ; sans profil, seuls les champs de premier niveau sont utilisés.
+func LoadConfigFile(path, profile string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	cfg, err := parseConfig(data, profile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config file %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// parseConfig décode un document YAML ou JSON (JSON étant un sous-ensemble de YAML)
+// et applique le profil sélectionné.
+func parseConfig(data []byte, profile string) (*Config, error) {
+	var file configFile
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	if profile == "" {
+		profile = os.Getenv(EnvProfile)
+	}
+	if profile == "" {
+		profile = file.Profile
+	}
+
+	cfg := file.Config
+	if profile != "" {
+		node, ok := file.Profiles[profile]
+		if !ok {
+			return nil, fmt.Errorf("profile %q not found", profile)
+		}
+		// yaml.Node.Decode ignore les champs inconnus : le profil est réencodé
+		// puis décodé avec le même décodeur strict que le fichier
+		raw, err := yaml.Marshal(&node)
+		if err != nil {
+			return nil, fmt.Errorf("invalid profile %q: %w", profile, err)
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(raw))
+		decoder.KnownFields(true)
+		// Le décodage sur la configuration existante ne remplace que les champs présents
+		if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("invalid profile %q: %w", profile, err)
+		}
+	}
+	return &cfg, nil
+}
+
+// LoadEnv surcharge la configuration avec les variables d'environnement définies :
+// AIYOU_BASE_URL, AIYOU_API_KEY (ou AIYOU_TOKEN), AIYOU_EMAIL, AIYOU_PASSWORD,
+// AIYOU_TIMEOUT, AIYOU_RESPONSE_HEADER_TIMEOUT, AIYOU_STREAM_READ_TIMEOUT,
+// AIYOU_RETRY_COUNT, AIYOU_RETRY_DELAY, AIYOU_LOG_LEVEL, AIYOU_RATE_LIMIT,
+// AIYOU_RATE_LIMIT_BURST, AIYOU_PROXY_URL, AIYOU_CA_CERT_FILE,
+// AIYOU_CLIENT_CERT_FILE, AIYOU_CLIENT_KEY_FILE et AIYOU_TOKEN_CACHE_DIR.
+func (c *Config) LoadEnv() error {
+	// L'ordre compte : AIYOU_API_KEY est appliquée après AIYOU_TOKEN et l'emporte donc
+	stringVars := []struct {
+		name  string
+		field *string
+	}{
+		{"AIYOU_BASE_URL", &c.BaseURL},
+		{EnvToken, &c.APIKey},
+		{"AIYOU_API_KEY", &c.APIKey},
+		{EnvEmail, &c.Email},
+		{EnvPassword, &c.Password},
+		{"AIYOU_LOG_LEVEL", &c.LogLevel},
+		{"AIYOU_PROXY_URL", &c.ProxyURL},
+		{"AIYOU_CA_CERT_FILE", &c.CACertFile},
+		{"AIYOU_CLIENT_CERT_FILE", &c.ClientCertFile},
+		{"AIYOU_CLIENT_KEY_FILE", &c.ClientKeyFile},
+		{"AIYOU_TOKEN_CACHE_DIR", &c.TokenCacheDir},
+	}
+	for _, v := range stringVars {
+		if value := os.Getenv(v.name); value != "" {
+			*v.field = value
+		}
+	}
+
+	durations := map[string]*time.Duration{
+		"AIYOU_TIMEOUT":                 &c.Timeout,
+		"AIYOU_RESPONSE_HEADER_TIMEOUT": &c.ResponseHeaderTimeout,
+		"AIYOU_STREAM_READ_TIMEOUT":     &c.StreamReadTimeout,
+		"AIYOU_RETRY_DELAY":             &c.RetryDelay,
+	}
+	for name, field := range durations {
+		if value := os.Getenv(name); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %w", name, err)
+			}
+			*field = d
+		}
+	}
+
+	if value := os.Getenv("AIYOU_RETRY_COUNT"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid AIYOU_RETRY_COUNT: %w", err)
+		}
+		c.RetryCount = n
+	}
+
+	if value := os.Getenv("AIYOU_RATE_LIMIT"); value != "" {
+		rps, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid AIYOU_RATE_LIMIT: %w", err)
+		}
+		if c.RateLimit == nil {
+			c.RateLimit = &RateLimiterConfig{BurstSize: 1}
+		}
+		c.RateLimit.RequestsPerSecond = rps
+	}
+	if value := os.Getenv("AIYOU_RATE_LIMIT_BURST"); value != "" {
+		burst, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid AIYOU_RATE_LIMIT_BURST: %w", err)
+		}
+		if c.RateLimit == nil {
+			c.RateLimit = &RateLimiterConfig{}
+		}
+		c.RateLimit.BurstSize = burst
+	}
+	return nil
+}
+
+// LoadConfigFromEnv crée une configuration à partir des seules variables d'environnement.
+func LoadConfigFromEnv() (*Config, error) {
+	cfg := &Config{}
+	if err := cfg.LoadEnv(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
@@ -0,0 +1,263 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package aiyou
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testConfigYAML = `
+base_url: https://prod.example.com
+email: user@example.com
+password: secret
+timeout: 45s
+retry_count: 5
+retry_delay: 200ms
+log_level: warn
+rate_limit:
+  requests_per_second: 10
+  burst_size: 2
+profile: prod
+profiles:
+  prod: {}
+  staging:
+    base_url: https://staging.example.com
+    api_key: staging-key
+    retry_count: 1
+`
+
+func TestLoadConfigFile(t *testing.T) {
+	clearCredentialsEnv(t)
+	dir := t.TempDir()
+
+	yamlFile := filepath.Join(dir, "aiyou.yaml")
+	if err := os.WriteFile(yamlFile, []byte(testConfigYAML), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	t.Run("Default profile from file", func(t *testing.T) {
+		cfg, err := LoadConfigFile(yamlFile, "")
+		if err != nil {
+			t.Fatalf("LoadConfigFile failed: %v", err)
+		}
+		if cfg.BaseURL != "https://prod.example.com" || cfg.Email != "user@example.com" {
+			t.Errorf("Unexpected config: %+v", cfg)
+		}
+		if cfg.Timeout != 45*time.Second || cfg.RetryDelay != 200*time.Millisecond || cfg.RetryCount != 5 {
+			t.Errorf("Unexpected durations: %+v", cfg)
+		}
+		if cfg.RateLimit == nil || cfg.RateLimit.RequestsPerSecond != 10 || cfg.RateLimit.BurstSize != 2 {
+			t.Errorf("Unexpected rate limit: %+v", cfg.RateLimit)
+		}
+	})
+
+	t.Run("Named profile overrides top-level fields", func(t *testing.T) {
+		cfg, err := LoadConfigFile(yamlFile, "staging")
+		if err != nil {
+			t.Fatalf("LoadConfigFile failed: %v", err)
+		}
+		if cfg.BaseURL != "https://staging.example.com" || cfg.APIKey != "staging-key" || cfg.RetryCount != 1 {
+			t.Errorf("Profile not applied: %+v", cfg)
+		}
+		if cfg.Timeout != 45*time.Second || cfg.LogLevel != "warn" {
+			t.Errorf("Expected inherited fields, got %+v", cfg)
+		}
+	})
+
+	t.Run("Profile from environment", func(t *testing.T) {
+		t.Setenv(EnvProfile, "staging")
+		cfg, err := LoadConfigFile(yamlFile, "")
+		if err != nil {
+			t.Fatalf("LoadConfigFile failed: %v", err)
+		}
+		if cfg.APIKey != "staging-key" {
+			t.Errorf("Expected staging profile, got %+v", cfg)
+		}
+	})
+
+	t.Run("Unknown profile", func(t *testing.T) {
+		if _, err := LoadConfigFile(yamlFile, "dev"); err == nil {
+			t.Error("Expected error for unknown profile")
+		}
+	})
+
+	t.Run("JSON file", func(t *testing.T) {
+		jsonFile := filepath.Join(dir, "aiyou.json")
+		content := `{"base_url": "https://json.example.com", "api_key": "key", "stream_read_timeout": "2m"}`
+		os.WriteFile(jsonFile, []byte(content), 0600)
+
+		cfg, err := LoadConfigFile(jsonFile, "")
+		if err != nil {
+			t.Fatalf("LoadConfigFile failed: %v", err)
+		}
+		if cfg.BaseURL != "https://json.example.com" || cfg.StreamReadTimeout != 2*time.Minute {
+			t.Errorf("Unexpected config: %+v", cfg)
+		}
+	})
+
+	t.Run("Unknown field is rejected", func(t *testing.T) {
+		invalid := filepath.Join(dir, "invalid.yaml")
+		os.WriteFile(invalid, []byte("api_key: key\nretries: 3\n"), 0600)
+		if _, err := LoadConfigFile(invalid, ""); err == nil {
+			t.Error("Expected error for unknown field")
+		}
+	})
+
+	t.Run("Unknown profile field is rejected", func(t *testing.T) {
+		invalid := filepath.Join(dir, "invalid-profile.yaml")
+		os.WriteFile(invalid, []byte("api_key: key\nprofiles:\n  prod:\n    base_ur: https://prod.example.com\n"), 0600)
+		if _, err := LoadConfigFile(invalid, "prod"); err == nil {
+			t.Error("Expected error for unknown field in profile")
+		}
+	})
+}
+
+func TestLoadConfigEnvOverridesFile(t *testing.T) {
+	clearCredentialsEnv(t)
+	file := filepath.Join(t.TempDir(), "aiyou.yaml")
+	os.WriteFile(file, []byte(testConfigYAML), 0600)
+
+	t.Setenv(EnvConfigFile, file)
+	t.Setenv("AIYOU_API_KEY", "env-key")
+	t.Setenv("AIYOU_TIMEOUT", "10s")
+	t.Setenv("AIYOU_RETRY_COUNT", "7")
+
+	cfg, err := LoadConfig("", "")
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.APIKey != "env-key" || cfg.Timeout != 10*time.Second || cfg.RetryCount != 7 {
+		t.Errorf("Environment not applied: %+v", cfg)
+	}
+	if cfg.BaseURL != "https://prod.example.com" {
+		t.Errorf("Expected base URL from file, got %q", cfg.BaseURL)
+	}
+
+	t.Setenv("AIYOU_RETRY_COUNT", "many")
+	if _, err := LoadConfig("", ""); err == nil {
+		t.Error("Expected error for invalid AIYOU_RETRY_COUNT")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"API key", Config{APIKey: "key"}, false},
+		{"Email and password", Config{Email: "user@example.com", Password: "secret"}, false},
+		{"No credentials", Config{Email: "user@example.com"}, true},
+		{"Negative timeout", Config{APIKey: "key", Timeout: -time.Second}, true},
+		{"Unknown log level", Config{APIKey: "key", LogLevel: "verbose"}, true},
+		{"Incomplete rate limit", Config{APIKey: "key", RateLimit: &RateLimiterConfig{RequestsPerSecond: 1}}, true},
+		{"Certificate without key", Config{APIKey: "key", ClientCertFile: "client.crt"}, true},
+		{"Negative retry count disables retries", Config{APIKey: "key", RetryCount: -1}, false},
+		{"Negative response header timeout", Config{APIKey: "key", ResponseHeaderTimeout: -time.Second}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			// Sans base_url, la configuration utilise DefaultBaseURL
+			if err == nil && tt.cfg.BaseURL != DefaultBaseURL {
+				t.Errorf("Expected default base URL, got %q", tt.cfg.BaseURL)
+			}
+		})
+	}
+
+	cfg := Config{BaseURL: "https://staging.example.com", APIKey: "key"}
+	if err := cfg.Validate(); err != nil || cfg.BaseURL != "https://staging.example.com" {
+		t.Errorf("Expected explicit base URL to be kept, got %q (%v)", cfg.BaseURL, err)
+	}
+}
+
+func TestNewClientFromConfig(t *testing.T) {
+	var attempts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if r.Header.Get("Authorization") != "Bearer config-key" {
+			t.Errorf("Unexpected Authorization header: %q", r.Header.Get("Authorization"))
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	var logs bytes.Buffer
+	client, err := NewClientFromConfig(&Config{
+		BaseURL:    server.URL,
+		APIKey:     "config-key",
+		RetryCount: 2,
+		RetryDelay: time.Millisecond,
+		Timeout:    45 * time.Second,
+		LogLevel:   "debug",
+		RateLimit:  &RateLimiterConfig{RequestsPerSecond: 100, BurstSize: 10},
+	}, WithLogger(NewDefaultLogger(&logs)))
+	if err != nil {
+		t.Fatalf("NewClientFromConfig failed: %v", err)
+	}
+
+	if client.httpClient.Timeout != 45*time.Second {
+		t.Errorf("Expected timeout to bound the whole request, got %v", client.httpClient.Timeout)
+	}
+
+	if client.rateLimiter == nil {
+		t.Error("Expected rate limiter to be configured")
+	}
+	if _, err := client.AuthenticatedRequest(context.Background(), "GET", "/test", nil); err == nil {
+		t.Error("Expected error after exhausting retries")
+	}
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts with retry_count 2, got %d", attempts)
+	}
+	if !strings.Contains(logs.String(), "DEBUG") {
+		t.Error("Expected configured log level to apply to the custom logger")
+	}
+
+	if _, err := NewClientFromConfig(&Config{BaseURL: server.URL}); err == nil {
+		t.Error("Expected error for config without credentials")
+	}
+
+	// Un retry_count négatif désactive les nouvelles tentatives
+	cfg, err := parseConfig([]byte("base_url: "+server.URL+"\napi_key: config-key\nretry_count: -1\n"), "")
+	if err != nil {
+		t.Fatalf("parseConfig failed: %v", err)
+	}
+	client, err = NewClientFromConfig(cfg, WithLogger(NewDefaultLogger(io.Discard)))
+	if err != nil {
+		t.Fatalf("NewClientFromConfig failed: %v", err)
+	}
+	attempts = 0
+	if _, err := client.AuthenticatedRequest(context.Background(), "GET", "/test", nil); err == nil {
+		t.Error("Expected error without retries")
+	}
+	if attempts != 1 {
+		t.Errorf("Expected a single attempt with a negative retry_count, got %d", attempts)
+	}
+}
@@ -0,0 +1,172 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// File: pkg/aiyou/content.go
+
+package aiyou
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Types de parties de contenu d'un message
+const (
+	ContentTypeText     = "text"
+	ContentTypeImageURL = "image_url"
+	ContentTypeFile     = "file"
+)
+
+// Niveaux de détail d'une image
+const (
+	ImageDetailAuto = "auto"
+	ImageDetailLow  = "low"
+	ImageDetailHigh = "high"
+)
+
+// Tailles maximales des fichiers locaux joints à un message
+const (
+	MaxImageFileSize = 20 << 20 // 20 Mo
+	MaxFileSize      = 32 << 20 // 32 Mo
+)
+
+// supportedImageTypes liste les formats d'image acceptés par AddImageFile
+var supportedImageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/webp": true,
+	"image/gif":  true,
+}
+
+// ImageURL référence une image, par URL publique ou par data URI base64.
+type ImageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"` // auto, low ou high
+}
+
+// FileContent contient un document joint à un message (PDF, texte, ...),
+// soit encodé en data URI, soit référencé par un identifiant de fichier.
+type FileContent struct {
+	Filename string `json:"filename,omitempty"`
+	FileData string `json:"file_data,omitempty"` // data URI base64
+	FileID   string `json:"file_id,omitempty"`
+}
+
+// MarshalJSON conserve le champ text des parties texte, même vide, que
+// l'API exige, tout en l'omettant pour les images et les documents.
+func (p ContentPart) MarshalJSON() ([]byte, error) {
+	type contentPart ContentPart
+	if p.Type != ContentTypeText {
+		return json.Marshal(contentPart(p))
+	}
+	return json.Marshal(struct {
+		contentPart
+		Text string `json:"text"`
+	}{contentPart(p), p.Text})
+}
+
+// NewTextPart crée une partie de contenu texte.
+func NewTextPart(text string) ContentPart {
+	return ContentPart{Type: ContentTypeText, Text: text}
+}
+
+// NewImageURLPart crée une partie image à partir d'une URL ou d'un data URI.
+// detail peut être vide pour laisser le serveur choisir.
+func NewImageURLPart(url, detail string) ContentPart {
+	return ContentPart{Type: ContentTypeImageURL, ImageURL: &ImageURL{URL: url, Detail: detail}}
+}
+
+// NewImageFilePart lit une image locale PNG, JPEG, WebP ou GIF et l'encode en
+// data URI. Le format est détecté à partir du contenu, jamais de l'extension.
+func NewImageFilePart(path, detail string) (ContentPart, error) {
+	data, err := readAttachment(path, MaxImageFileSize)
+	if err != nil {
+		return ContentPart{}, err
+	}
+	mimeType := baseMediaType(http.DetectContentType(data))
+	if !supportedImageTypes[mimeType] {
+		return ContentPart{}, fmt.Errorf("unsupported image format %q for %s", mimeType, path)
+	}
+	return NewImageURLPart(dataURI(mimeType, data), detail), nil
+}
+
+// NewFilePart lit un document local (PDF, texte, ...) et l'encode en data URI.
+// Le type MIME est détecté à partir du contenu, puis de l'extension si le
+// contenu est ambigu (texte brut ou binaire inconnu).
+func NewFilePart(path string) (ContentPart, error) {
+	data, err := readAttachment(path, MaxFileSize)
+	if err != nil {
+		return ContentPart{}, err
+	}
+	mimeType := baseMediaType(http.DetectContentType(data))
+	if mimeType == "application/octet-stream" || mimeType == "text/plain" {
+		if byExt := mime.TypeByExtension(strings.ToLower(filepath.Ext(path))); byExt != "" {
+			mimeType = baseMediaType(byExt)
+		}
+	}
+	return ContentPart{
+		Type: ContentTypeFile,
+		File: &FileContent{Filename: filepath.Base(path), FileData: dataURI(mimeType, data)},
+	}, nil
+}
+
+// NewFileIDPart référence un fichier déjà envoyé au serveur.
+func NewFileIDPart(fileID string) ContentPart {
+	return ContentPart{Type: ContentTypeFile, File: &FileContent{FileID: fileID}}
+}
+
+// readAttachment lit un fichier joint après avoir vérifié sa taille.
+func readAttachment(path string, maxSize int64) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to access file: %w", err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", path)
+	}
+	if info.Size() == 0 {
+		return nil, fmt.Errorf("file %s is empty", path)
+	}
+	if info.Size() > maxSize {
+		return nil, fmt.Errorf("file %s is too large: %d bytes (max %d)", path, info.Size(), maxSize)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	return data, nil
+}
+
+// baseMediaType retire les paramètres (charset, ...) d'un type MIME.
+func baseMediaType(mimeType string) string {
+	if base, _, err := mime.ParseMediaType(mimeType); err == nil {
+		return base
+	}
+	return mimeType
+}
+
+// dataURI encode data en data URI base64.
+func dataURI(mimeType string, data []byte) string {
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
@@ -0,0 +1,160 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package aiyou
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// pngHeader suffit à la détection du type MIME par http.DetectContentType.
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func writeTestFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	return path
+}
+
+func TestContentPartJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		part ContentPart
+		want string
+	}{
+		{"Text", NewTextPart("Hello"), `{"type":"text","text":"Hello"}`},
+		{"Empty text keeps the field", NewTextPart(""), `{"type":"text","text":""}`},
+		{"Image URL", NewImageURLPart("https://example.com/a.png", ImageDetailHigh),
+			`{"type":"image_url","image_url":{"url":"https://example.com/a.png","detail":"high"}}`},
+		{"File ID", NewFileIDPart("file-123"), `{"type":"file","file":{"file_id":"file-123"}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.part)
+			if err != nil {
+				t.Fatalf("Marshal failed: %v", err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, data)
+			}
+
+			var decoded ContentPart
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("Unmarshal failed: %v", err)
+			}
+			if decoded.Type != tt.part.Type || decoded.Text != tt.part.Text {
+				t.Errorf("Round trip mismatch: %+v", decoded)
+			}
+		})
+	}
+}
+
+func TestNewImageFilePart(t *testing.T) {
+	t.Run("PNG is encoded as a data URI", func(t *testing.T) {
+		path := writeTestFile(t, "screenshot.bin", pngHeader)
+		part, err := NewImageFilePart(path, ImageDetailLow)
+		if err != nil {
+			t.Fatalf("NewImageFilePart failed: %v", err)
+		}
+		if part.Type != ContentTypeImageURL || part.ImageURL == nil || part.ImageURL.Detail != ImageDetailLow {
+			t.Fatalf("Unexpected part: %+v", part)
+		}
+		if !strings.HasPrefix(part.ImageURL.URL, "data:image/png;base64,iVBORw0KGgo") {
+			t.Errorf("Unexpected data URI: %s", part.ImageURL.URL)
+		}
+	})
+
+	t.Run("Unsupported format", func(t *testing.T) {
+		path := writeTestFile(t, "image.png", []byte("not an image at all"))
+		if _, err := NewImageFilePart(path, ""); err == nil {
+			t.Error("Expected error for non-image content")
+		}
+	})
+
+	t.Run("Too large", func(t *testing.T) {
+		path := writeTestFile(t, "big.png", pngHeader)
+		if err := os.Truncate(path, MaxImageFileSize+1); err != nil {
+			t.Fatalf("Truncate failed: %v", err)
+		}
+		if _, err := NewImageFilePart(path, ""); err == nil || !strings.Contains(err.Error(), "too large") {
+			t.Errorf("Expected size error, got %v", err)
+		}
+	})
+
+	t.Run("Missing or empty file", func(t *testing.T) {
+		if _, err := NewImageFilePart(filepath.Join(t.TempDir(), "missing.png"), ""); err == nil {
+			t.Error("Expected error for missing file")
+		}
+		if _, err := NewImageFilePart(writeTestFile(t, "empty.png", nil), ""); err == nil {
+			t.Error("Expected error for empty file")
+		}
+	})
+}
+
+func TestNewFilePart(t *testing.T) {
+	path := writeTestFile(t, "report.pdf", []byte("%PDF-1.4\n%test\n"))
+	part, err := NewFilePart(path)
+	if err != nil {
+		t.Fatalf("NewFilePart failed: %v", err)
+	}
+	if part.Type != ContentTypeFile || part.File == nil || part.File.Filename != "report.pdf" {
+		t.Fatalf("Unexpected part: %+v", part)
+	}
+	if !strings.HasPrefix(part.File.FileData, "data:application/pdf;base64,") {
+		t.Errorf("Unexpected data URI: %s", part.File.FileData)
+	}
+}
+
+func TestMessageBuilderFiles(t *testing.T) {
+	logger := NewDefaultLogger(io.Discard)
+
+	builder := NewMessageBuilder("user", logger)
+	msg := builder.
+		AddText("Que montre cette capture ?").
+		AddImageFile(writeTestFile(t, "capture.png", pngHeader)).
+		AddFile(writeTestFile(t, "notes.pdf", []byte("%PDF-1.4\n"))).
+		Build()
+	if err := builder.Err(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectedTypes := []string{ContentTypeText, ContentTypeImageURL, ContentTypeFile}
+	if len(msg.Content) != len(expectedTypes) {
+		t.Fatalf("Expected %d content parts, got %d", len(expectedTypes), len(msg.Content))
+	}
+	for i, expectedType := range expectedTypes {
+		if msg.Content[i].Type != expectedType {
+			t.Errorf("Content part %d: expected type %s, got %s", i, expectedType, msg.Content[i].Type)
+		}
+	}
+
+	builder = NewMessageBuilder("user", logger)
+	msg = builder.AddImageFile(filepath.Join(t.TempDir(), "missing.png")).AddText("Hello").Build()
+	if builder.Err() == nil {
+		t.Error("Expected error for missing image file")
+	}
+	if len(msg.Content) != 1 {
+		t.Errorf("Expected only the text part, got %d parts", len(msg.Content))
+	}
+}
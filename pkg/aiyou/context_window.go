@@ -0,0 +1,461 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// File: pkg/aiyou/context_window.go
+
+package aiyou
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// DefaultReservedCompletionTokens est le budget réservé à la réponse lorsque
+// ni la fenêtre ni la requête (MaxTokens) ne le précisent.
+const DefaultReservedCompletionTokens = 1024
+
+// ErrContextTooLarge est retournée lorsque la requête ne tient pas dans la
+// fenêtre de contexte, même après troncature.
+var ErrContextTooLarge = errors.New("request does not fit in the context window")
+
+// TruncationStrategy définit comment réduire une conversation trop longue.
+type TruncationStrategy int
+
+const (
+	// DropOldest retire les messages les plus anciens, hors messages système.
+	DropOldest TruncationStrategy = iota
+	// KeepSystemAndLastN conserve les messages système et les KeepLast derniers messages.
+	KeepSystemAndLastN
+	// SummarizeOlder remplace les messages les plus anciens par un résumé
+	// obtenu par un appel de completion secondaire.
+	SummarizeOlder
+)
+
+// summaryPrefix introduit le message système contenant le résumé.
+const summaryPrefix = "Summary of the earlier conversation:\n"
+
+// summaryInstructions est la consigne envoyée pour résumer des messages.
+const summaryInstructions = "Summarize the following conversation in a few sentences. " +
+	"Keep the facts, decisions, names and open questions needed to continue it. " +
+	"Reply with the summary only."
+
+// ContextWindow garantit qu'une requête tient dans la fenêtre de contexte du
+// modèle : MaxTokens moins le budget réservé à la réponse. Elle est appliquée
+// avant chaque ChatCompletion avec l'option WithContextWindow, ou
+// explicitement avec Fit.
+type ContextWindow struct {
+	MaxTokens          int                // Taille de la fenêtre du modèle (ModelProperties.MaxTokens)
+	ReservedCompletion int                // Tokens réservés à la réponse, à défaut MaxTokens de la requête
+	Strategy           TruncationStrategy // Stratégie de réduction
+	KeepLast           int                // Messages conservés par KeepSystemAndLastN
+	Tokenizer          Tokenizer          // Compteur de tokens, DefaultTokenizer si nil
+	SummaryAssistantID string             // Assistant utilisé par SummarizeOlder, à défaut celui de la requête
+}
+
+// ContextWindowForModel crée une fenêtre de contexte à partir des propriétés
+// du modèle.
+func ContextWindowForModel(model Model, reservedCompletion int, strategy TruncationStrategy) *ContextWindow {
+	return &ContextWindow{
+		MaxTokens:          model.Properties.MaxTokens,
+		ReservedCompletion: reservedCompletion,
+		Strategy:           strategy,
+	}
+}
+
+// WithContextWindow applies window to every ChatCompletion and
+// ChatCompletionStream request before it is sent.
+func WithContextWindow(window *ContextWindow) ClientOption {
+	return func(c *Client) error {
+		c.contextWindow = window
+		return nil
+	}
+}
+
+// contextWindowBypass marque les requêtes internes (résumés) exemptées de la
+// fenêtre de contexte du client.
+type contextWindowBypass struct{}
+
+// withoutContextWindow retourne un contexte exemptant ses requêtes de la fenêtre.
+func withoutContextWindow(ctx context.Context) context.Context {
+	return context.WithValue(ctx, contextWindowBypass{}, true)
+}
+
+// fitContext applique la fenêtre de contexte du client à req.
+func (c *Client) fitContext(ctx context.Context, req *ChatCompletionRequest) error {
+	if c.contextWindow == nil || ctx.Value(contextWindowBypass{}) != nil {
+		return nil
+	}
+	return c.contextWindow.Fit(ctx, c, req)
+}
+
+// tokenizer retourne le compteur de tokens de la fenêtre.
+func (w *ContextWindow) tokenizer() Tokenizer {
+	if w.Tokenizer == nil {
+		return DefaultTokenizer
+	}
+	return w.Tokenizer
+}
+
+// Budget retourne le nombre de tokens disponibles pour les messages de req :
+// la fenêtre, moins la réponse, le prompt système et la définition des outils.
+func (w *ContextWindow) Budget(req *ChatCompletionRequest) int {
+	reserved := w.ReservedCompletion
+	if reserved == 0 && req.MaxTokens != nil {
+		reserved = *req.MaxTokens
+	}
+	if reserved == 0 {
+		reserved = DefaultReservedCompletionTokens
+	}
+
+	budget := w.MaxTokens - reserved - w.tokenizer().CountTokens(req.PromptSystem)
+	if len(req.Tools) > 0 {
+		if tools, err := json.Marshal(req.Tools); err == nil {
+			budget -= w.tokenizer().CountTokens(string(tools))
+		}
+	}
+	return budget
+}
+
+// Fit réduit req.Messages selon la stratégie de la fenêtre jusqu'à ce que la
+// requête tienne dans le budget. Le dernier message est toujours conservé ;
+// ErrContextTooLarge est retournée s'il ne suffit pas à respecter le budget.
+// client n'est utilisé que par SummarizeOlder.
+func (w *ContextWindow) Fit(ctx context.Context, client *Client, req *ChatCompletionRequest) error {
+	if w.MaxTokens <= 0 {
+		return nil
+	}
+	tokenizer := w.tokenizer()
+	budget := w.Budget(req)
+	total := CountMessageTokens(tokenizer, req.Messages...)
+	if total <= budget {
+		return nil
+	}
+
+	messages := req.Messages
+	switch w.Strategy {
+	case KeepSystemAndLastN:
+		messages = keepLastMessages(messages, w.KeepLast)
+	case SummarizeOlder:
+		if client == nil {
+			return errors.New("a client is required to summarize the conversation")
+		}
+		assistantID := w.SummaryAssistantID
+		if assistantID == "" {
+			assistantID = req.AssistantID
+		}
+		// Budget d'une requête de résumé, sans prompt système ni outils
+		limit := w.Budget(&ChatCompletionRequest{})
+		var err error
+		messages, err = summarizeOlderMessages(ctx, client, assistantID, messages, budget, limit, tokenizer)
+		if err != nil {
+			return err
+		}
+	}
+	messages = dropOldestMessages(messages, budget, tokenizer)
+
+	if fitted := CountMessageTokens(tokenizer, messages...); fitted > budget {
+		return fmt.Errorf("%w: %d tokens for a budget of %d", ErrContextTooLarge, fitted, budget)
+	}
+	if client != nil {
+		client.logger.Debugf("Context window: %d messages (%d tokens) reduced to %d messages for a budget of %d tokens",
+			len(req.Messages), total, len(messages), budget)
+	}
+	req.Messages = messages
+	return nil
+}
+
+// dropOldestMessages retire les messages non système les plus anciens jusqu'à
+// respecter le budget, sans jamais retirer le dernier message. Les réponses
+// d'outils dont l'appel a été retiré le sont aussi.
+func dropOldestMessages(messages []Message, budget int, tokenizer Tokenizer) []Message {
+	counts := make([]int, len(messages))
+	total := 0
+	for i, msg := range messages {
+		counts[i] = CountMessageTokens(tokenizer, msg)
+		total += counts[i]
+	}
+
+	dropped := make([]bool, len(messages))
+	last := len(messages) - 1
+	for i := 0; i < last && total > budget; i++ {
+		if messages[i].Role == RoleSystem {
+			continue
+		}
+		dropped[i] = true
+		total -= counts[i]
+		for i+1 < last && messages[i+1].Role == RoleTool {
+			i++
+			dropped[i] = true
+			total -= counts[i]
+		}
+	}
+
+	kept := make([]Message, 0, len(messages))
+	for i, msg := range messages {
+		if !dropped[i] {
+			kept = append(kept, msg)
+		}
+	}
+	return kept
+}
+
+// keepLastMessages conserve les messages système et les n derniers messages,
+// en écartant les réponses d'outils dont l'appel n'est pas conservé.
+func keepLastMessages(messages []Message, n int) []Message {
+	var nonSystem int
+	for _, msg := range messages {
+		if msg.Role != RoleSystem {
+			nonSystem++
+		}
+	}
+	if n < 1 {
+		n = 1
+	}
+
+	skip := nonSystem - n
+	kept := make([]Message, 0, len(messages))
+	for i, msg := range messages {
+		if msg.Role == RoleSystem {
+			kept = append(kept, msg)
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		if skip == 0 && msg.Role == RoleTool && i < len(messages)-1 {
+			continue // réponse orpheline en tête des messages conservés
+		}
+		skip = -1
+		kept = append(kept, msg)
+	}
+	return kept
+}
+
+// summarizeOlderMessages remplace les messages les plus anciens par un
+// message système de résumé. Les messages récents conservés occupent au plus
+// la moitié du budget, le reste étant laissé au résumé. Chaque requête de
+// résumé tient dans limit tokens ; le résumé est mis en cache sur le client
+// et réutilisé, puis complété, tant que la conversation commence par les
+// messages qu'il couvre.
+func summarizeOlderMessages(ctx context.Context, client *Client, assistantID string, messages []Message, budget, limit int, tokenizer Tokenizer) ([]Message, error) {
+	var system, conversation []Message
+	for _, msg := range messages {
+		if msg.Role == RoleSystem {
+			system = append(system, msg)
+		} else {
+			conversation = append(conversation, msg)
+		}
+	}
+	// Rien à résumer : seuls des messages système dépassent le budget
+	if len(conversation) == 0 {
+		return messages, nil
+	}
+
+	// Messages récents conservés tels quels, dont au moins le dernier
+	cut := len(conversation) - 1
+	used := CountMessageTokens(tokenizer, conversation[cut:]...)
+	for cut > 0 {
+		count := CountMessageTokens(tokenizer, conversation[cut-1])
+		if used+count > budget/2 {
+			break
+		}
+		used += count
+		cut--
+	}
+	// Les réponses d'outils restent avec l'appel qu'elles complètent
+	for cut < len(conversation)-1 && conversation[cut].Role == RoleTool {
+		cut++
+	}
+	if cut == 0 {
+		return messages, nil
+	}
+
+	// Le plus long préfixe déjà résumé n'est pas renvoyé à l'assistant
+	older := conversation[:cut]
+	keys := summaryPrefixKeys(assistantID, older)
+	summary, covered := "", 0
+	for i := len(older); i > 0; i-- {
+		if cached, ok := client.summaries.get(keys[i-1]); ok {
+			summary, covered = cached, i
+			break
+		}
+	}
+	if covered < len(older) {
+		var err error
+		summary, err = summarizeMessages(ctx, client, assistantID, summary, older[covered:], limit, tokenizer)
+		if err != nil {
+			return nil, err
+		}
+		client.summaries.put(keys[len(older)-1], summary)
+	} else {
+		client.logger.Debugf("Reusing cached summary of %d messages", covered)
+	}
+
+	result := make([]Message, 0, len(system)+1+len(conversation)-cut)
+	result = append(result, system...)
+	result = append(result, summaryMessage(summary))
+	return append(result, conversation[cut:]...), nil
+}
+
+// summarizeMessages demande à l'assistant assistantID un résumé de messages
+// complétant le résumé previous. Chaque requête tient dans limit tokens (sans
+// limite si limit <= 0) : les messages sont résumés par tranches, chacune
+// avec le résumé des précédentes.
+func summarizeMessages(ctx context.Context, client *Client, assistantID, previous string, messages []Message, limit int, tokenizer Tokenizer) (string, error) {
+	summary := previous
+	for len(messages) > 0 {
+		n, content := nextSummaryChunk(summary, messages, limit, tokenizer)
+		req := ChatCompletionRequest{
+			AssistantID: assistantID,
+			Messages:    []Message{NewTextMessage(RoleUser, content)},
+		}
+		resp, err := client.ChatCompletion(withoutContextWindow(ctx), req)
+		if err != nil {
+			return "", fmt.Errorf("failed to summarize conversation: %w", err)
+		}
+		if len(resp.Choices) == 0 {
+			return "", errors.New("failed to summarize conversation: no choices in response")
+		}
+		client.logger.Debugf("Summarized %d messages", n)
+		summary = resp.Choices[0].Message.Text()
+		messages = messages[n:]
+	}
+	return summary, nil
+}
+
+// summaryContent retourne la consigne de résumé de messages, complétant le
+// résumé previous.
+func summaryContent(previous string, messages []Message) string {
+	if previous != "" {
+		messages = append([]Message{summaryMessage(previous)}, messages...)
+	}
+	return summaryInstructions + "\n\n" + transcript(messages)
+}
+
+// nextSummaryChunk retourne le nombre de messages en tête de messages résumés
+// par la prochaine requête et le contenu de cette requête, qui tient dans
+// limit tokens. Un message dépassant seul la limite est tronqué.
+func nextSummaryChunk(previous string, messages []Message, limit int, tokenizer Tokenizer) (int, string) {
+	if limit <= 0 {
+		return len(messages), summaryContent(previous, messages)
+	}
+	fits := func(content string) bool {
+		return CountMessageTokens(tokenizer, NewTextMessage(RoleUser, content)) <= limit
+	}
+
+	// Estimation message par message, vérifiée ensuite sur le contenu complet
+	n := 1
+	used := CountMessageTokens(tokenizer, NewTextMessage(RoleUser, summaryContent(previous, messages[:1])))
+	for n < len(messages) {
+		count := tokenizer.CountTokens(transcript(messages[n:n+1])) + 1
+		if used+count > limit {
+			break
+		}
+		used += count
+		n++
+	}
+	content := summaryContent(previous, messages[:n])
+	for n > 1 && !fits(content) {
+		n--
+		content = summaryContent(previous, messages[:n])
+	}
+	if fits(content) {
+		return n, content
+	}
+
+	// Le premier message dépasse seul la limite : son texte est tronqué
+	text := []rune(messages[0].Text())
+	truncated := func(length int) string {
+		return summaryContent(previous, []Message{NewTextMessage(messages[0].Role, string(text[:length]))})
+	}
+	low, high := 0, len(text)
+	for low < high {
+		mid := (low + high + 1) / 2
+		if fits(truncated(mid)) {
+			low = mid
+		} else {
+			high = mid - 1
+		}
+	}
+	return 1, truncated(low)
+}
+
+// summaryCacheSize borne le nombre de résumés conservés par client.
+const summaryCacheSize = 32
+
+// summaryCache conserve les résumés obtenus par SummarizeOlder, indexés par
+// le préfixe de conversation qu'ils couvrent. Un cache nil ne conserve rien.
+type summaryCache struct {
+	mu      sync.Mutex
+	entries map[string]string
+	order   []string
+}
+
+// newSummaryCache crée un cache de résumés vide.
+func newSummaryCache() *summaryCache {
+	return &summaryCache{entries: make(map[string]string)}
+}
+
+// get retourne le résumé du préfixe key.
+func (c *summaryCache) get(key string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	summary, ok := c.entries[key]
+	return summary, ok
+}
+
+// put conserve le résumé du préfixe key, en écartant le plus ancien résumé
+// au-delà de summaryCacheSize.
+func (c *summaryCache) put(key, summary string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok {
+		c.order = append(c.order, key)
+	}
+	c.entries[key] = summary
+	if len(c.order) > summaryCacheSize {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// summaryPrefixKeys retourne la clé de cache de chaque préfixe
+// messages[:i+1] résumé par l'assistant assistantID.
+func summaryPrefixKeys(assistantID string, messages []Message) []string {
+	hash := sha256.New()
+	hash.Write([]byte(assistantID))
+	keys := make([]string, len(messages))
+	for i, msg := range messages {
+		data, _ := json.Marshal(msg)
+		hash.Write([]byte{0})
+		hash.Write(data)
+		keys[i] = hex.EncodeToString(hash.Sum(nil))
+	}
+	return keys
+}
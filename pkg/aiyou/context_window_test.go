@@ -0,0 +1,263 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package aiyou
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// longText retourne un texte d'environ n tokens pour DefaultTokenizer.
+func longText(n int) string {
+	return strings.TrimSpace(strings.Repeat("mot ", n))
+}
+
+func TestDefaultTokenizer(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"Bonjour", 2},
+		{"Bonjour, le monde !", 7},
+		{longText(10), 10},
+	}
+	for _, tt := range tests {
+		if got := DefaultTokenizer.CountTokens(tt.text); got != tt.want {
+			t.Errorf("CountTokens(%q): expected %d, got %d", tt.text, tt.want, got)
+		}
+	}
+
+	msg := NewTextMessage(RoleUser, longText(10))
+	if got := CountMessageTokens(nil, msg); got != messageTokenOverhead+1+10 {
+		t.Errorf("Unexpected message count: %d", got)
+	}
+	image := Message{Role: RoleUser, Content: []ContentPart{NewImageURLPart("https://example.com/a.png", ImageDetailLow)}}
+	if got := CountMessageTokens(nil, image); got != messageTokenOverhead+1+imageLowTokens {
+		t.Errorf("Unexpected image message count: %d", got)
+	}
+
+	words := TokenizerFunc(func(text string) int { return len(strings.Fields(text)) })
+	if got := CountMessageTokens(words, msg); got != messageTokenOverhead+1+10 {
+		t.Errorf("Expected custom tokenizer to be used, got %d", got)
+	}
+}
+
+func TestContextWindowFit(t *testing.T) {
+	toolCall := NewTextMessage(RoleAssistant, "")
+	toolCall.Content = nil
+	toolCall.ToolCalls = []ToolCall{{ID: "call_1", Type: ToolTypeFunction, Function: FunctionCall{Name: "meteo", Arguments: "{}"}}}
+
+	conversation := func() []Message {
+		return []Message{
+			NewTextMessage(RoleSystem, "Sois bref"),
+			NewTextMessage(RoleUser, longText(100)),
+			toolCall,
+			NewToolMessage("call_1", longText(100)),
+			NewTextMessage(RoleAssistant, longText(100)),
+			NewTextMessage(RoleUser, longText(100)),
+		}
+	}
+	roles := func(messages []Message) string {
+		var names []string
+		for _, msg := range messages {
+			names = append(names, msg.Role)
+		}
+		return strings.Join(names, ",")
+	}
+
+	tests := []struct {
+		name   string
+		window ContextWindow
+		want   string
+	}{
+		{"Fits", ContextWindow{MaxTokens: 1000, ReservedCompletion: 100}, "system,user,assistant,tool,assistant,user"},
+		{"Drop oldest with orphan tool result", ContextWindow{MaxTokens: 400, ReservedCompletion: 100}, "system,assistant,user"},
+		{"Keep last N", ContextWindow{MaxTokens: 500, ReservedCompletion: 100, Strategy: KeepSystemAndLastN, KeepLast: 3}, "system,assistant,user"},
+		{"Keep last N then drop", ContextWindow{MaxTokens: 250, ReservedCompletion: 100, Strategy: KeepSystemAndLastN, KeepLast: 2}, "system,user"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := ChatCompletionRequest{Messages: conversation()}
+			if err := tt.window.Fit(context.Background(), nil, &req); err != nil {
+				t.Fatalf("Fit failed: %v", err)
+			}
+			if got := roles(req.Messages); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+			if CountMessageTokens(nil, req.Messages...) > tt.window.Budget(&req) {
+				t.Error("Expected request to fit the budget")
+			}
+		})
+	}
+
+	t.Run("Budget uses request max tokens and system prompt", func(t *testing.T) {
+		maxTokens := 300
+		window := ContextWindowForModel(Model{Properties: ModelProperties{MaxTokens: 1000}}, 0, DropOldest)
+		req := ChatCompletionRequest{MaxTokens: &maxTokens, PromptSystem: longText(50)}
+		if got := window.Budget(&req); got != 650 {
+			t.Errorf("Expected budget of 650, got %d", got)
+		}
+	})
+
+	t.Run("Too large", func(t *testing.T) {
+		window := ContextWindow{MaxTokens: 150, ReservedCompletion: 100}
+		req := ChatCompletionRequest{Messages: conversation()}
+		if err := window.Fit(context.Background(), nil, &req); !errors.Is(err, ErrContextTooLarge) {
+			t.Errorf("Expected ErrContextTooLarge, got %v", err)
+		}
+	})
+
+	t.Run("Summarize system messages only", func(t *testing.T) {
+		client := newTestClient(t, chatTestHandler(func(req ChatCompletionRequest) string {
+			t.Error("Expected no summary request")
+			return chatTestResponse("")
+		}))
+		window := ContextWindow{MaxTokens: 150, ReservedCompletion: 100, Strategy: SummarizeOlder}
+		req := ChatCompletionRequest{Messages: []Message{NewTextMessage(RoleSystem, longText(100))}}
+		if err := window.Fit(context.Background(), client, &req); !errors.Is(err, ErrContextTooLarge) {
+			t.Errorf("Expected ErrContextTooLarge, got %v", err)
+		}
+	})
+}
+
+func TestContextWindowSummarize(t *testing.T) {
+	var requests []ChatCompletionRequest
+	client := newTestClient(t, chatTestHandler(func(req ChatCompletionRequest) string {
+		requests = append(requests, req)
+		if req.AssistantID == "resumeur" {
+			return chatTestResponse("L'utilisateur prépare un voyage à Lyon.")
+		}
+		return chatTestResponse("Bon voyage !")
+	}))
+	WithContextWindow(&ContextWindow{
+		MaxTokens:          500,
+		ReservedCompletion: 100,
+		Strategy:           SummarizeOlder,
+		SummaryAssistantID: "resumeur",
+	})(client)
+
+	messages := []Message{
+		NewTextMessage(RoleUser, longText(100)),
+		NewTextMessage(RoleAssistant, longText(100)),
+		NewTextMessage(RoleUser, longText(100)),
+		NewTextMessage(RoleAssistant, longText(100)),
+		NewTextMessage(RoleUser, "Des conseils ?"),
+	}
+	if _, err := client.ChatCompletion(context.Background(), ChatCompletionRequest{Messages: messages, AssistantID: "287"}); err != nil {
+		t.Fatalf("ChatCompletion failed: %v", err)
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("Expected a summary request then the chat request, got %d requests", len(requests))
+	}
+	if !strings.Contains(requests[0].Messages[0].Text(), "user: mot mot") {
+		t.Errorf("Expected older messages in the summary request, got %q", requests[0].Messages[0].Text())
+	}
+	sent := requests[1].Messages
+	if sent[0].Role != RoleSystem || !strings.Contains(sent[0].Text(), "voyage à Lyon") {
+		t.Errorf("Expected a system summary first, got %+v", sent[0])
+	}
+	if sent[len(sent)-1].Text() != "Des conseils ?" || len(sent) >= len(messages) {
+		t.Errorf("Expected recent messages to be kept, got %d messages", len(sent))
+	}
+}
+
+func TestContextWindowSummarizeInChunks(t *testing.T) {
+	window := &ContextWindow{
+		MaxTokens:          500,
+		ReservedCompletion: 100,
+		Strategy:           SummarizeOlder,
+		SummaryAssistantID: "resumeur",
+	}
+	limit := window.Budget(&ChatCompletionRequest{})
+
+	var summaries []string
+	client := newTestClient(t, chatTestHandler(func(req ChatCompletionRequest) string {
+		if req.AssistantID != "resumeur" {
+			return chatTestResponse("Bon voyage !")
+		}
+		if got := CountMessageTokens(nil, req.Messages...); got > limit {
+			t.Errorf("Expected summary request within %d tokens, got %d", limit, got)
+		}
+		summaries = append(summaries, req.Messages[0].Text())
+		return chatTestResponse("Résumé " + string(rune('A'+len(summaries)-1)))
+	}), WithContextWindow(window))
+
+	topic := func(word string) string { return word + " " + longText(99) }
+	messages := []Message{
+		NewTextMessage(RoleUser, topic("lyon")),
+		NewTextMessage(RoleAssistant, topic("train")),
+		NewTextMessage(RoleUser, topic("hotel")),
+		NewTextMessage(RoleAssistant, topic("musee")),
+		NewTextMessage(RoleUser, topic("restaurant")),
+		NewTextMessage(RoleAssistant, topic("retour")),
+		NewTextMessage(RoleUser, "Des conseils ?"),
+	}
+	ask := func(messages []Message) {
+		t.Helper()
+		if _, err := client.ChatCompletion(context.Background(), ChatCompletionRequest{Messages: messages, AssistantID: "287"}); err != nil {
+			t.Fatalf("ChatCompletion failed: %v", err)
+		}
+	}
+
+	ask(messages)
+	if len(summaries) < 2 {
+		t.Fatalf("Expected the older messages to be summarized in several requests, got %d", len(summaries))
+	}
+	if !strings.Contains(summaries[1], "Résumé A") {
+		t.Errorf("Expected each chunk to extend the previous summary, got %q", summaries[1])
+	}
+
+	t.Run("Summary is cached", func(t *testing.T) {
+		before := len(summaries)
+		ask(messages)
+		if len(summaries) != before {
+			t.Errorf("Expected the cached summary to be reused, got %d new summary requests", len(summaries)-before)
+		}
+	})
+
+	t.Run("Only new messages are summarized", func(t *testing.T) {
+		before := len(summaries)
+		longer := append(append([]Message(nil), messages[:len(messages)-1]...),
+			NewTextMessage(RoleUser, topic("bagages")),
+			NewTextMessage(RoleAssistant, topic("meteo")),
+			NewTextMessage(RoleUser, "Et pour la suite ?"),
+		)
+		ask(longer)
+		added := summaries[before:]
+		if len(added) == 0 {
+			t.Fatal("Expected the new older messages to be summarized")
+		}
+		if strings.Contains(added[0], "lyon") || !strings.Contains(added[0], "Résumé") {
+			t.Errorf("Expected only new messages on top of the cached summary, got %q", added[0])
+		}
+	})
+
+	t.Run("Oversized message is truncated", func(t *testing.T) {
+		before := len(summaries)
+		ask([]Message{
+			NewTextMessage(RoleUser, longText(1000)),
+			NewTextMessage(RoleUser, "Des conseils ?"),
+		})
+		if len(summaries) != before+1 {
+			t.Errorf("Expected a single truncated summary request, got %d", len(summaries)-before)
+		}
+	})
+}
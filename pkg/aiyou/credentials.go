@@ -0,0 +1,383 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// File: pkg/aiyou/credentials.go
+
+package aiyou
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Variables d'environnement lues par EnvCredentialsProvider et la chaîne par défaut
+const (
+	EnvToken     = "AIYOU_TOKEN"
+	EnvEmail     = "AIYOU_EMAIL"
+	EnvPassword  = "AIYOU_PASSWORD"
+	EnvProfile   = "AIYOU_PROFILE"
+	EnvTokenFile = "AIYOU_TOKEN_FILE"
+)
+
+// ErrNoCredentials est retournée par un fournisseur qui n'a trouvé aucun identifiant.
+// Une chaîne passe alors au fournisseur suivant.
+var ErrNoCredentials = errors.New("no credentials found")
+
+// Credentials contient soit un bearer token, soit un couple email/mot de passe.
+// Le token est prioritaire lorsque les deux sont renseignés.
+type Credentials struct {
+	Token    string
+	Email    string
+	Password string
+	Source   string // Nom du fournisseur ayant produit les identifiants
+}
+
+// IsValid indique si les identifiants permettent de s'authentifier.
+func (c Credentials) IsValid() bool {
+	return c.Token != "" || (c.Email != "" && c.Password != "")
+}
+
+// CredentialsProvider fournit les identifiants du client. Retrieve est appelée
+// avant chaque requête, ce qui permet de prendre en compte une rotation.
+type CredentialsProvider interface {
+	Retrieve(ctx context.Context) (Credentials, error)
+}
+
+// StaticCredentialsProvider retourne toujours les mêmes identifiants.
+type StaticCredentialsProvider struct {
+	Credentials Credentials
+}
+
+// Retrieve implémente CredentialsProvider.
+func (p *StaticCredentialsProvider) Retrieve(ctx context.Context) (Credentials, error) {
+	if !p.Credentials.IsValid() {
+		return Credentials{}, ErrNoCredentials
+	}
+	creds := p.Credentials
+	creds.Source = "static"
+	return creds, nil
+}
+
+// EnvCredentialsProvider lit AIYOU_TOKEN, ou AIYOU_EMAIL et AIYOU_PASSWORD.
+type EnvCredentialsProvider struct{}
+
+// Retrieve implémente CredentialsProvider.
+func (p *EnvCredentialsProvider) Retrieve(ctx context.Context) (Credentials, error) {
+	creds := Credentials{
+		Token:    os.Getenv(EnvToken),
+		Email:    os.Getenv(EnvEmail),
+		Password: os.Getenv(EnvPassword),
+		Source:   "environment",
+	}
+	if !creds.IsValid() {
+		return Credentials{}, ErrNoCredentials
+	}
+	return creds, nil
+}
+
+// profileCredentials représente les identifiants d'un profil dans le fichier de profils.
+type profileCredentials struct {
+	Token    string `json:"token"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// profileFile est le format du fichier de profils : les champs de premier niveau
+// forment le profil "default", les autres profils sont nommés sous "profiles".
+type profileFile struct {
+	profileCredentials
+	Profiles map[string]profileCredentials `json:"profiles"`
+}
+
+// ProfileCredentialsProvider lit les identifiants d'un profil nommé dans un
+// fichier JSON du répertoire personnel (par défaut ~/.aiyou.json, celui écrit
+// par la commande config des exemples). Le fichier n'est relu que s'il a changé.
+type ProfileCredentialsProvider struct {
+	Path    string // Chemin du fichier ; ~/.aiyou.json si vide
+	Profile string // Nom du profil ; $AIYOU_PROFILE ou "default" si vide
+
+	cache fileCache
+}
+
+// Retrieve implémente CredentialsProvider.
+func (p *ProfileCredentialsProvider) Retrieve(ctx context.Context) (Credentials, error) {
+	path := p.Path
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return Credentials{}, ErrNoCredentials
+		}
+		path = filepath.Join(home, ".aiyou.json")
+	}
+
+	profile := p.Profile
+	if profile == "" {
+		profile = os.Getenv(EnvProfile)
+	}
+	if profile == "" {
+		profile = "default"
+	}
+
+	data, err := p.cache.read(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Credentials{}, ErrNoCredentials
+	}
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to read profile file: %w", err)
+	}
+
+	var file profileFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return Credentials{}, fmt.Errorf("failed to decode profile file %s: %w", path, err)
+	}
+
+	entry, ok := file.Profiles[profile]
+	if !ok && profile == "default" {
+		entry, ok = file.profileCredentials, true
+	}
+	if !ok {
+		return Credentials{}, fmt.Errorf("profile %q not found in %s", profile, path)
+	}
+
+	creds := Credentials{
+		Token:    entry.Token,
+		Email:    entry.Email,
+		Password: entry.Password,
+		Source:   "profile:" + profile,
+	}
+	if !creds.IsValid() {
+		return Credentials{}, ErrNoCredentials
+	}
+	return creds, nil
+}
+
+// TokenFileCredentialsProvider lit un bearer token dans un fichier, typiquement
+// monté par un orchestrateur qui le renouvelle. Le fichier est relu dès que sa
+// date de modification ou sa taille change.
+type TokenFileCredentialsProvider struct {
+	Path string // Chemin du fichier ; $AIYOU_TOKEN_FILE si vide
+
+	cache fileCache
+}
+
+// Retrieve implémente CredentialsProvider.
+func (p *TokenFileCredentialsProvider) Retrieve(ctx context.Context) (Credentials, error) {
+	path := p.Path
+	if path == "" {
+		path = os.Getenv(EnvTokenFile)
+	}
+	if path == "" {
+		return Credentials{}, ErrNoCredentials
+	}
+
+	data, err := p.cache.read(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Credentials{}, ErrNoCredentials
+	}
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to read token file: %w", err)
+	}
+
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return Credentials{}, ErrNoCredentials
+	}
+	return Credentials{Token: token, Source: "token-file"}, nil
+}
+
+// ChainCredentialsProvider interroge ses fournisseurs dans l'ordre et retourne
+// les premiers identifiants trouvés. Un fournisseur retournant ErrNoCredentials
+// est ignoré ; toute autre erreur interrompt la chaîne.
+type ChainCredentialsProvider struct {
+	Providers []CredentialsProvider
+}
+
+// NewChainCredentialsProvider crée une chaîne à partir des fournisseurs donnés.
+func NewChainCredentialsProvider(providers ...CredentialsProvider) *ChainCredentialsProvider {
+	return &ChainCredentialsProvider{Providers: providers}
+}
+
+// DefaultCredentialsChain retourne la chaîne standard : les fournisseurs
+// explicites fournis, puis les variables d'environnement, puis le profil
+// ~/.aiyou.json, puis le fichier de token désigné par $AIYOU_TOKEN_FILE.
+func DefaultCredentialsChain(explicit ...CredentialsProvider) *ChainCredentialsProvider {
+	providers := append([]CredentialsProvider{}, explicit...)
+	providers = append(providers,
+		&EnvCredentialsProvider{},
+		&ProfileCredentialsProvider{},
+		&TokenFileCredentialsProvider{},
+	)
+	return NewChainCredentialsProvider(providers...)
+}
+
+// Retrieve implémente CredentialsProvider.
+func (p *ChainCredentialsProvider) Retrieve(ctx context.Context) (Credentials, error) {
+	for _, provider := range p.Providers {
+		creds, err := provider.Retrieve(ctx)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		if err != nil {
+			return Credentials{}, err
+		}
+		return creds, nil
+	}
+	return Credentials{}, ErrNoCredentials
+}
+
+// fileCache conserve le contenu d'un fichier et ne le relit que lorsque
+// sa date de modification ou sa taille a changé.
+type fileCache struct {
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+	size    int64
+	data    []byte
+}
+
+func (c *fileCache) read(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.data != nil && c.path == path && c.modTime.Equal(info.ModTime()) && c.size == info.Size() {
+		return c.data, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c.path, c.modTime, c.size, c.data = path, info.ModTime(), info.Size(), data
+	return data, nil
+}
+
+// credentialsAuthenticator adapte un CredentialsProvider à l'interface
+// Authenticator. Les identifiants sont relus avant chaque requête ; lorsqu'ils
+// changent, l'authentificateur sous-jacent (bearer ou JWT) est reconstruit.
+type credentialsAuthenticator struct {
+	provider CredentialsProvider
+	logger   Logger
+
+	mu           sync.Mutex
+	configureJWT func(*JWTAuthenticator)
+	current      Authenticator
+	currentCreds Credentials
+}
+
+func newCredentialsAuthenticator(provider CredentialsProvider, logger Logger) *credentialsAuthenticator {
+	return &credentialsAuthenticator{provider: provider, logger: logger}
+}
+
+// Authenticate implémente Authenticator.
+func (a *credentialsAuthenticator) Authenticate(ctx context.Context) error {
+	creds, err := a.provider.Retrieve(ctx)
+	if err != nil {
+		a.logger.Errorf("Failed to retrieve credentials: %v", err)
+		return fmt.Errorf("failed to retrieve credentials: %w", err)
+	}
+
+	a.mu.Lock()
+	current := a.current
+	if current == nil || !sameCredentials(creds, a.currentCreds) {
+		a.logger.Debugf("Using credentials from %s", creds.Source)
+		if creds.Token != "" {
+			current = NewBearerAuthenticator(creds.Token, a.logger)
+		} else {
+			jwt := NewJWTAuthenticator(creds.Email, creds.Password, "", nil, a.logger)
+			if a.configureJWT != nil {
+				a.configureJWT(jwt)
+			}
+			current = jwt
+		}
+		a.current, a.currentCreds = current, creds
+	}
+	a.mu.Unlock()
+
+	return current.Authenticate(ctx)
+}
+
+// Token implémente Authenticator.
+func (a *credentialsAuthenticator) Token() string {
+	a.mu.Lock()
+	current := a.current
+	a.mu.Unlock()
+	if current == nil {
+		return ""
+	}
+	return current.Token()
+}
+
+// Invalidate implémente RefreshableAuthenticator.
+func (a *credentialsAuthenticator) Invalidate(token string) {
+	a.mu.Lock()
+	current := a.current
+	a.mu.Unlock()
+	if auth, ok := current.(RefreshableAuthenticator); ok {
+		auth.Invalidate(token)
+	}
+}
+
+// SetLogger sets a custom logger for the credentials authenticator
+func (a *credentialsAuthenticator) SetLogger(logger Logger) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.logger = logger
+	switch auth := a.current.(type) {
+	case *JWTAuthenticator:
+		auth.SetLogger(logger)
+	case *BearerAuthenticator:
+		auth.SetLogger(logger)
+	}
+}
+
+// setJWTConfigurer définit la fonction appliquée aux authentificateurs JWT
+// créés, et force leur reconstruction avec la nouvelle configuration.
+func (a *credentialsAuthenticator) setJWTConfigurer(configure func(*JWTAuthenticator)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.configureJWT = configure
+	a.current = nil
+}
+
+func sameCredentials(a, b Credentials) bool {
+	return a.Token == b.Token && a.Email == b.Email && a.Password == b.Password
+}
+
+// WithCredentialsProvider configures the client to retrieve its credentials from provider
+// before each request, e.g. DefaultCredentialsChain(). Explicit WithEmailPassword or
+// WithBearerToken options take precedence over the provider.
+func WithCredentialsProvider(provider CredentialsProvider) ClientOption {
+	return func(c *Client) error {
+		if provider == nil {
+			return fmt.Errorf("credentials provider cannot be nil")
+		}
+		c.credentialsProvider = provider
+		return nil
+	}
+}
@@ -0,0 +1,239 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package aiyou
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// clearCredentialsEnv isole le test des identifiants présents dans l'environnement.
+func clearCredentialsEnv(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	for _, name := range []string{EnvToken, EnvEmail, EnvPassword, EnvProfile, EnvTokenFile} {
+		t.Setenv(name, "")
+	}
+	return home
+}
+
+func TestDefaultCredentialsChain(t *testing.T) {
+	home := clearCredentialsEnv(t)
+	profile := `{"email":"default@example.com","password":"secret",
+		"profiles":{"staging":{"token":"staging-token"}}}`
+	if err := os.WriteFile(filepath.Join(home, ".aiyou.json"), []byte(profile), 0600); err != nil {
+		t.Fatalf("Failed to write profile file: %v", err)
+	}
+
+	t.Run("Profile file default entry", func(t *testing.T) {
+		creds, err := DefaultCredentialsChain().Retrieve(context.Background())
+		if err != nil {
+			t.Fatalf("Retrieve failed: %v", err)
+		}
+		if creds.Email != "default@example.com" || creds.Source != "profile:default" {
+			t.Errorf("Unexpected credentials: %+v", creds)
+		}
+	})
+
+	t.Run("Named profile", func(t *testing.T) {
+		t.Setenv(EnvProfile, "staging")
+		creds, err := DefaultCredentialsChain().Retrieve(context.Background())
+		if err != nil {
+			t.Fatalf("Retrieve failed: %v", err)
+		}
+		if creds.Token != "staging-token" {
+			t.Errorf("Expected staging token, got %+v", creds)
+		}
+	})
+
+	t.Run("Unknown profile is an error", func(t *testing.T) {
+		t.Setenv(EnvProfile, "missing")
+		if _, err := DefaultCredentialsChain().Retrieve(context.Background()); err == nil || errors.Is(err, ErrNoCredentials) {
+			t.Errorf("Expected profile lookup error, got %v", err)
+		}
+	})
+
+	t.Run("Environment overrides profile", func(t *testing.T) {
+		t.Setenv(EnvToken, "env-token")
+		creds, err := DefaultCredentialsChain().Retrieve(context.Background())
+		if err != nil {
+			t.Fatalf("Retrieve failed: %v", err)
+		}
+		if creds.Token != "env-token" || creds.Source != "environment" {
+			t.Errorf("Expected environment credentials, got %+v", creds)
+		}
+	})
+
+	t.Run("Explicit provider overrides environment", func(t *testing.T) {
+		t.Setenv(EnvToken, "env-token")
+		explicit := &StaticCredentialsProvider{Credentials: Credentials{Token: "explicit-token"}}
+		creds, err := DefaultCredentialsChain(explicit).Retrieve(context.Background())
+		if err != nil {
+			t.Fatalf("Retrieve failed: %v", err)
+		}
+		if creds.Token != "explicit-token" {
+			t.Errorf("Expected explicit credentials, got %+v", creds)
+		}
+	})
+
+	t.Run("No credentials", func(t *testing.T) {
+		os.Remove(filepath.Join(home, ".aiyou.json"))
+		_, err := DefaultCredentialsChain().Retrieve(context.Background())
+		if !errors.Is(err, ErrNoCredentials) {
+			t.Errorf("Expected ErrNoCredentials, got %v", err)
+		}
+	})
+}
+
+func TestTokenFileRotation(t *testing.T) {
+	clearCredentialsEnv(t)
+
+	var lastAuth atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastAuth.Store(r.Header.Get("Authorization"))
+		w.Write([]byte(`{"message":"success"}`))
+	}))
+	defer server.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("first-token\n"), 0600); err != nil {
+		t.Fatalf("Failed to write token file: %v", err)
+	}
+	t.Setenv(EnvTokenFile, tokenFile)
+
+	client, err := NewClient(
+		WithCredentialsProvider(DefaultCredentialsChain()),
+		WithBaseURL(server.URL),
+		WithLogger(NewDefaultLogger(io.Discard)),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	request := func() string {
+		resp, err := client.AuthenticatedRequest(context.Background(), "GET", "/test", nil)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		return lastAuth.Load().(string)
+	}
+
+	if got := request(); got != "Bearer first-token" {
+		t.Errorf("Expected first token, got %q", got)
+	}
+
+	if err := os.WriteFile(tokenFile, []byte("second-token\n"), 0600); err != nil {
+		t.Fatalf("Failed to rotate token file: %v", err)
+	}
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(tokenFile, later, later)
+
+	if got := request(); got != "Bearer second-token" {
+		t.Errorf("Expected rotated token, got %q", got)
+	}
+}
+
+func TestWithCredentialsProvider(t *testing.T) {
+	clearCredentialsEnv(t)
+	server, logins := newLoginCountingServer(t, time.Hour, "")
+	defer server.Close()
+
+	provider := &StaticCredentialsProvider{Credentials: Credentials{Email: "test@example.com", Password: "password"}}
+
+	t.Run("Email and password are exchanged for a JWT", func(t *testing.T) {
+		client, err := NewClient(
+			WithCredentialsProvider(provider),
+			WithBaseURL(server.URL),
+			WithLogger(NewDefaultLogger(io.Discard)),
+		)
+		if err != nil {
+			t.Fatalf("Failed to create client: %v", err)
+		}
+
+		before := atomic.LoadInt32(logins)
+		for i := 0; i < 2; i++ {
+			resp, err := client.AuthenticatedRequest(context.Background(), "GET", "/test", nil)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			resp.Body.Close()
+		}
+		if got := atomic.LoadInt32(logins) - before; got != 1 {
+			t.Errorf("Expected a single login for unchanged credentials, got %d", got)
+		}
+	})
+
+	t.Run("Explicit option takes precedence", func(t *testing.T) {
+		client, err := NewClient(
+			WithCredentialsProvider(provider),
+			WithBearerToken("explicit-token"),
+			WithBaseURL(server.URL),
+			WithLogger(NewDefaultLogger(io.Discard)),
+		)
+		if err != nil {
+			t.Fatalf("Failed to create client: %v", err)
+		}
+		if _, ok := client.auth.(*BearerAuthenticator); !ok {
+			t.Errorf("Expected bearer authenticator, got %T", client.auth)
+		}
+	})
+
+	t.Run("Logger is passed to the authenticator", func(t *testing.T) {
+		client, err := NewClient(
+			WithCredentialsProvider(provider),
+			WithBaseURL(server.URL),
+			WithLogger(NewDefaultLogger(io.Discard)),
+		)
+		if err != nil {
+			t.Fatalf("Failed to create client: %v", err)
+		}
+		logger := NewDefaultLogger(io.Discard)
+		if err := WithLogger(logger)(client); err != nil {
+			t.Fatalf("WithLogger failed: %v", err)
+		}
+		auth, ok := client.auth.(*credentialsAuthenticator)
+		if !ok || auth.logger != Logger(logger) {
+			t.Errorf("Expected the credentials authenticator to use the client logger, got %T", client.auth)
+		}
+	})
+
+	t.Run("Missing credentials fail the request", func(t *testing.T) {
+		client, err := NewClient(
+			WithCredentialsProvider(DefaultCredentialsChain()),
+			WithBaseURL(server.URL),
+			WithLogger(NewDefaultLogger(io.Discard)),
+			WithRetry(0, 0),
+		)
+		if err != nil {
+			t.Fatalf("Failed to create client: %v", err)
+		}
+		_, err = client.AuthenticatedRequest(context.Background(), "GET", "/test", nil)
+		if !errors.Is(err, ErrNoCredentials) {
+			t.Errorf("Expected ErrNoCredentials, got %v", err)
+		}
+	})
+}
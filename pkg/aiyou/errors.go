@@ -17,28 +17,97 @@ along with this program.  If not, see <https://www.gnu.org/licenses/>.
 
 package aiyou
 
-import "fmt"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrStreamReadTimeout indique qu'aucune donnée n'a été reçue sur un flux
+// pendant le délai configuré avec WithStreamReadTimeout.
+var ErrStreamReadTimeout = errors.New("stream read timeout")
+
+// ErrStreamTruncated indique qu'un flux s'est terminé avant "data: [DONE]"
+// et sans finish_reason : la réponse est incomplète et la requête peut être rejouée.
+var ErrStreamTruncated = errors.New("stream truncated")
+
+// ErrMalformedChunk indique qu'un chunk du flux n'est pas du JSON valide
+// (retournée uniquement en mode strict, voir WithStrictStreaming).
+var ErrMalformedChunk = errors.New("malformed stream chunk")
 
 // APIError représente une erreur retournée par l'API AI.YOU.
 // Il contient le code de statut HTTP et le message d'erreur.
 type APIError struct {
 	StatusCode int
 	Message    string
+	Type       string // type d'erreur renvoyé par l'API, si présent
+	RetryAfter int    // en secondes, si le serveur a fourni un en-tête Retry-After
 }
 
 func (e *APIError) Error() string {
 	return fmt.Sprintf("API error: %d - %s", e.StatusCode, e.Message)
 }
 
+// errorPayload couvre les formats d'erreur renvoyés par l'API :
+// {"error": {"message": ...}} et {"object": "error", "message": ...}.
+type errorPayload struct {
+	Object  string          `json:"object"`
+	Message string          `json:"message"`
+	Type    string          `json:"type"`
+	Code    json.RawMessage `json:"code"`
+	Error   *errorPayload   `json:"error"`
+}
+
+// parseErrorPayload décode une charge d'erreur JSON. Le booléen est faux
+// si data ne décrit pas une erreur.
+func parseErrorPayload(statusCode int, data []byte) (*APIError, bool) {
+	var payload errorPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, false
+	}
+	if payload.Error != nil {
+		payload = *payload.Error
+	} else if payload.Object != "error" {
+		return nil, false
+	}
+
+	apiErr := &APIError{StatusCode: statusCode, Message: payload.Message, Type: payload.Type}
+	if code, err := strconv.Atoi(string(payload.Code)); err == nil && statusCode == 0 {
+		apiErr.StatusCode = code
+	}
+	return apiErr, true
+}
+
+// newAPIErrorFromBody construit une APIError à partir du corps d'une réponse en erreur,
+// structuré ou non.
+func newAPIErrorFromBody(statusCode int, body []byte) *APIError {
+	if apiErr, ok := parseErrorPayload(statusCode, body); ok {
+		return apiErr
+	}
+	message := strings.TrimSpace(string(body))
+	if message == "" {
+		message = http.StatusText(statusCode)
+	}
+	return &APIError{StatusCode: statusCode, Message: message}
+}
+
 // AuthenticationError représente une erreur d'authentification
 type AuthenticationError struct {
 	Message string
+	Err     error // Erreur d'origine, si disponible
 }
 
 func (e *AuthenticationError) Error() string {
 	return fmt.Sprintf("Authentication error: %s", e.Message)
 }
 
+func (e *AuthenticationError) Unwrap() error {
+	return e.Err
+}
+
 // RateLimitError indique que la limite de taux a été atteinte.
 // RetryAfter indique le nombre de secondes à attendre avant de réessayer.
 type RateLimitError struct {
@@ -0,0 +1,60 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package aiyou
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestClient crée un client dont les requêtes sont servies par handler,
+// authentifié par bearer token et sans logs. Les options opts sont appliquées
+// après celles par défaut et peuvent donc les remplacer.
+func newTestClient(t *testing.T, handler http.Handler, opts ...ClientOption) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	opts = append([]ClientOption{
+		WithBearerToken("test_token"),
+		WithBaseURL(server.URL),
+		WithLogger(NewDefaultLogger(io.Discard)),
+	}, opts...)
+	client, err := NewClient(opts...)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	return client
+}
+
+// chatTestHandler répond aux requêtes de chat completion avec respond(requête).
+func chatTestHandler(respond func(req ChatCompletionRequest) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Write([]byte(respond(req)))
+	})
+}
+
+// chatTestResponse retourne une réponse de chat completion contenant text.
+func chatTestResponse(text string) string {
+	content, _ := json.Marshal(text)
+	return `{"id":"1","object":"chat.completion","choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":` + string(content) + `}}]}`
+}
@@ -0,0 +1,191 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// File: pkg/aiyou/json_output.go
+
+package aiyou
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultJSONRetries est le nombre de nouvelles demandes envoyées au modèle
+// lorsque sa réponse n'est pas un JSON valide.
+const DefaultJSONRetries = 2
+
+// ErrNoJSON est retournée lorsqu'aucun document JSON n'est trouvé dans la réponse.
+var ErrNoJSON = errors.New("no JSON found in response")
+
+// JSONOutputError est retournée par CompleteJSON lorsque le modèle n'a pas
+// produit de JSON valide après toutes les tentatives.
+type JSONOutputError struct {
+	Attempts int    // Nombre de réponses obtenues
+	Raw      string // Texte de la dernière réponse
+	Err      error  // Dernière erreur d'extraction, de validation ou de décodage
+}
+
+func (e *JSONOutputError) Error() string {
+	return fmt.Sprintf("invalid JSON output after %d attempts: %v", e.Attempts, e.Err)
+}
+
+func (e *JSONOutputError) Unwrap() error {
+	return e.Err
+}
+
+// JSONOption configure CompleteJSON.
+type JSONOption func(*jsonOptions)
+
+// jsonOptions contient la configuration de CompleteJSON.
+type jsonOptions struct {
+	retries int
+	schema  *JSONSchema
+}
+
+// WithJSONRetries sets how many times the model is asked again to fix an invalid answer.
+func WithJSONRetries(retries int) JSONOption {
+	return func(o *jsonOptions) {
+		o.retries = retries
+	}
+}
+
+// WithJSONSchema replaces the schema derived from the target type.
+func WithJSONSchema(schema *JSONSchema) JSONOption {
+	return func(o *jsonOptions) {
+		o.schema = schema
+	}
+}
+
+// CompleteJSON envoie req en demandant au modèle une réponse JSON conforme au
+// schéma dérivé de T (voir SchemaFor), puis décode cette réponse dans T.
+//
+// Le JSON est extrait d'un bloc de code ou du texte brut de la réponse et
+// validé par rapport au schéma. En cas d'échec, l'erreur est renvoyée au
+// modèle pour qu'il corrige sa réponse, jusqu'à DefaultJSONRetries fois par
+// défaut (voir WithJSONRetries) ;
+// une *JSONOutputError est retournée si aucune réponse n'est valide.
+func CompleteJSON[T any](ctx context.Context, client *Client, req ChatCompletionRequest, opts ...JSONOption) (T, error) {
+	var result T
+	options := jsonOptions{retries: DefaultJSONRetries}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.schema == nil {
+		options.schema = SchemaFor(result)
+	}
+	if options.retries < 0 {
+		options.retries = 0
+	}
+
+	schema, err := json.MarshalIndent(options.schema, "", "  ")
+	if err != nil {
+		return result, fmt.Errorf("failed to encode JSON schema: %w", err)
+	}
+	req.PromptSystem = joinPrompts(req.PromptSystem, jsonInstructions(schema))
+	req.Messages = append([]Message(nil), req.Messages...)
+
+	for attempt := 1; ; attempt++ {
+		resp, err := client.ChatCompletion(ctx, req)
+		if err != nil {
+			return result, err
+		}
+		if len(resp.Choices) == 0 {
+			return result, errors.New("no choices in response")
+		}
+		reply := resp.Choices[0].Message
+		raw := reply.Text()
+
+		var value T
+		err = decodeJSONOutput(raw, options.schema, &value)
+		if err == nil {
+			return value, nil
+		}
+		if attempt > options.retries {
+			return result, &JSONOutputError{Attempts: attempt, Raw: raw, Err: err}
+		}
+
+		client.logger.Warnf("Invalid JSON output (attempt %d): %v", attempt, err)
+		if reply.Role == "" {
+			reply.Role = RoleAssistant
+		}
+		req.Messages = append(req.Messages, reply, NewTextMessage(RoleUser, fmt.Sprintf(
+			"Your previous answer is invalid: %v. Reply again with only a JSON document that matches the schema.", err)))
+	}
+}
+
+// jsonInstructions retourne les consignes de format envoyées au modèle.
+func jsonInstructions(schema []byte) string {
+	return "Reply only with a JSON document, without any comment, that matches this JSON schema:\n" + string(schema)
+}
+
+// joinPrompts ajoute suffix au prompt système existant.
+func joinPrompts(prompt, suffix string) string {
+	if strings.TrimSpace(prompt) == "" {
+		return suffix
+	}
+	return prompt + "\n\n" + suffix
+}
+
+// decodeJSONOutput extrait le JSON de text, le valide et le décode dans v.
+func decodeJSONOutput(text string, schema *JSONSchema, v interface{}) error {
+	data, err := ExtractJSON(text)
+	if err != nil {
+		return err
+	}
+	if err := schema.Validate(data); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to decode JSON: %w", err)
+	}
+	return nil
+}
+
+// fencedBlock repère les blocs de code Markdown, avec ou sans langage.
+var fencedBlock = regexp.MustCompile("(?s)```[a-zA-Z0-9_-]*[ \t]*\r?\n(.*?)```")
+
+// ExtractJSON retourne le premier document JSON trouvé dans text : le contenu
+// d'un bloc de code (```json ... ```), le texte entier, ou le premier objet ou
+// tableau présent dans le texte.
+func ExtractJSON(text string) ([]byte, error) {
+	for _, match := range fencedBlock.FindAllStringSubmatch(text, -1) {
+		if block := strings.TrimSpace(match[1]); json.Valid([]byte(block)) {
+			return []byte(block), nil
+		}
+	}
+
+	trimmed := strings.TrimSpace(text)
+	if json.Valid([]byte(trimmed)) {
+		return []byte(trimmed), nil
+	}
+
+	for i := 0; i < len(text); i++ {
+		if text[i] != '{' && text[i] != '[' {
+			continue
+		}
+		var value json.RawMessage
+		if err := json.NewDecoder(strings.NewReader(text[i:])).Decode(&value); err == nil {
+			return bytes.TrimSpace(value), nil
+		}
+	}
+	return nil, ErrNoJSON
+}
@@ -0,0 +1,159 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package aiyou
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type jsonTestInvoice struct {
+	Number string  `json:"number"`
+	Total  float64 `json:"total"`
+	Status string  `json:"status" enum:"paid,unpaid"`
+	Lines  []struct {
+		Label    string `json:"label"`
+		Quantity int    `json:"quantity"`
+	} `json:"lines"`
+	Note *string `json:"note"`
+}
+
+func TestExtractJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"Raw JSON", ` {"a":1} `, `{"a":1}`},
+		{"Fenced block", "Voici le résultat :\n```json\n{\"a\":1}\n```\nBonne journée", `{"a":1}`},
+		{"Fence without language", "```\n[1,2]\n```", `[1,2]`},
+		{"Embedded in text", `Le résultat est {"a":{"b":[1]}} comme demandé.`, `{"a":{"b":[1]}}`},
+		{"Skips invalid braces", `Réponse {incomplète} puis {"a":1}`, `{"a":1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := ExtractJSON(tt.input)
+			if err != nil || string(data) != tt.want {
+				t.Errorf("Expected %s, got %s (%v)", tt.want, data, err)
+			}
+		})
+	}
+
+	if _, err := ExtractJSON("Pas de JSON ici"); !errors.Is(err, ErrNoJSON) {
+		t.Errorf("Expected ErrNoJSON, got %v", err)
+	}
+}
+
+func TestJSONSchemaValidate(t *testing.T) {
+	schema := SchemaFor(jsonTestInvoice{})
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{"Valid", `{"number":"F-1","total":12.5,"status":"paid","lines":[{"label":"x","quantity":2}],"note":null}`, ""},
+		{"Missing optional property", `{"number":"F-1","total":12.5,"status":"paid","lines":[]}`, ""},
+		{"Missing required", `{"total":12.5,"status":"paid","lines":[]}`, `missing required property "number"`},
+		{"Wrong type", `{"number":1,"total":12.5,"status":"paid","lines":[]}`, "$.number: expected string"},
+		{"Enum", `{"number":"F-1","total":12.5,"status":"late","lines":[]}`, `$.status: "late" is not one of paid, unpaid`},
+		{"Nested integer", `{"number":"F-1","total":1,"status":"paid","lines":[{"label":"x","quantity":1.5}]}`, "$.lines[0].quantity: 1.5 is not an integer"},
+		{"Required null", `{"number":null,"total":1,"status":"paid","lines":[]}`, "$.number: expected string, got null"},
+		{"Null slice", `{"number":"F-1","total":1,"status":"paid","lines":null}`, ""},
+		{"Missing slice", `{"number":"F-1","total":1,"status":"paid"}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := schema.Validate([]byte(tt.input))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	// Une valeur Go encodée doit respecter son propre schéma
+	data, _ := json.Marshal(jsonTestInvoice{Number: "F-1", Status: "paid"})
+	if err := schema.Validate(data); err != nil {
+		t.Errorf("Expected encoded invoice %s to be valid, got %v", data, err)
+	}
+}
+
+func TestCompleteJSON(t *testing.T) {
+	t.Run("Re-prompts until valid", func(t *testing.T) {
+		replies := []string{
+			"Je ne peux pas répondre en JSON.",
+			"```json\n{\"number\":\"F-1\",\"total\":\"12.5\",\"status\":\"paid\",\"lines\":[]}\n```",
+			"```json\n{\"number\":\"F-1\",\"total\":12.5,\"status\":\"paid\",\"lines\":[{\"label\":\"x\",\"quantity\":2}]}\n```",
+		}
+		var requests []ChatCompletionRequest
+		client := newTestClient(t, chatTestHandler(func(req ChatCompletionRequest) string {
+			requests = append(requests, req)
+			return chatTestResponse(replies[len(requests)-1])
+		}))
+
+		invoice, err := CompleteJSON[jsonTestInvoice](context.Background(), client, ChatCompletionRequest{
+			Messages:     []Message{NewTextMessage(RoleUser, "Extrais la facture")},
+			AssistantID:  "287",
+			PromptSystem: "Tu es comptable",
+		})
+		if err != nil {
+			t.Fatalf("CompleteJSON failed: %v", err)
+		}
+		if invoice.Number != "F-1" || invoice.Total != 12.5 || len(invoice.Lines) != 1 || invoice.Lines[0].Quantity != 2 {
+			t.Errorf("Unexpected invoice: %+v", invoice)
+		}
+
+		if len(requests) != 3 {
+			t.Fatalf("Expected 3 requests, got %d", len(requests))
+		}
+		if !strings.HasPrefix(requests[0].PromptSystem, "Tu es comptable") || !strings.Contains(requests[0].PromptSystem, `"status"`) {
+			t.Errorf("Expected schema instructions in system prompt, got %q", requests[0].PromptSystem)
+		}
+		last := requests[2].Messages
+		if len(last) != 5 || last[1].Role != RoleAssistant || !strings.Contains(last[4].Text(), "$.total: expected number") {
+			t.Errorf("Expected validation errors to be sent back, got %+v", last)
+		}
+	})
+
+	t.Run("Typed error after retries", func(t *testing.T) {
+		calls := 0
+		client := newTestClient(t, chatTestHandler(func(req ChatCompletionRequest) string {
+			calls++
+			return chatTestResponse("toujours pas de JSON")
+		}))
+
+		_, err := CompleteJSON[jsonTestInvoice](context.Background(), client, ChatCompletionRequest{
+			Messages:    []Message{NewTextMessage(RoleUser, "Extrais la facture")},
+			AssistantID: "287",
+		}, WithJSONRetries(1))
+		var outputErr *JSONOutputError
+		if !errors.As(err, &outputErr) || outputErr.Attempts != 2 || outputErr.Raw != "toujours pas de JSON" || !errors.Is(err, ErrNoJSON) {
+			t.Errorf("Expected JSONOutputError after 2 attempts, got %v", err)
+		}
+		if calls != 2 {
+			t.Errorf("Expected 2 calls, got %d", calls)
+		}
+	})
+}
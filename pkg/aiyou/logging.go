@@ -25,6 +25,7 @@ import (
 	"io"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
 )
@@ -133,6 +134,22 @@ func (l *defaultLogger) Errorf(format string, args ...interface{}) {
 	l.log(ERROR, format, args...)
 }
 
+// ParseLogLevel converts a level name such as "debug" or "WARN" to a LogLevel
+func ParseLogLevel(name string) (LogLevel, error) {
+	switch strings.ToUpper(strings.TrimSpace(name)) {
+	case "DEBUG":
+		return DEBUG, nil
+	case "INFO":
+		return INFO, nil
+	case "WARN", "WARNING":
+		return WARN, nil
+	case "ERROR":
+		return ERROR, nil
+	default:
+		return INFO, fmt.Errorf("unknown log level: %q", name)
+	}
+}
+
 // String returns the string representation of a LogLevel
 func (l LogLevel) String() string {
 	switch l {
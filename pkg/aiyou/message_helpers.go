@@ -13,6 +13,7 @@ package aiyou
 type MessageBuilder struct {
 	message Message
 	logger  Logger
+	err     error // Première erreur rencontrée lors de l'ajout d'un fichier
 }
 
 // NewMessageBuilder creates a new MessageBuilder with the specified role.
@@ -29,23 +30,70 @@ func NewMessageBuilder(role string, logger Logger) *MessageBuilder {
 // AddText adds a text content part to the message.
 func (mb *MessageBuilder) AddText(text string) *MessageBuilder {
 	mb.logger.Debugf("Adding text content: %s", MaskSensitiveInfo(text))
-	mb.message.Content = append(mb.message.Content, ContentPart{
-		Type: "text",
-		Text: text,
-	})
+	mb.message.Content = append(mb.message.Content, NewTextPart(text))
 	return mb
 }
 
-// AddImage adds an image content part to the message.
+// AddImage adds an image_url content part to the message.
 func (mb *MessageBuilder) AddImage(imageURL string) *MessageBuilder {
+	return mb.AddImageURL(imageURL, "")
+}
+
+// AddImageURL adds an image_url content part with the given detail level
+// (ImageDetailAuto, ImageDetailLow or ImageDetailHigh, empty for the default).
+func (mb *MessageBuilder) AddImageURL(imageURL, detail string) *MessageBuilder {
 	mb.logger.Debugf("Adding image content: %s", MaskSensitiveInfo(imageURL))
-	mb.message.Content = append(mb.message.Content, ContentPart{
-		Type: "image",
-		Text: imageURL,
-	})
+	mb.message.Content = append(mb.message.Content, NewImageURLPart(imageURL, detail))
+	return mb
+}
+
+// AddImageFile adds a local PNG, JPEG, WebP or GIF image encoded as a base64
+// data URI. Errors are reported by Err.
+func (mb *MessageBuilder) AddImageFile(path string) *MessageBuilder {
+	mb.logger.Debugf("Adding image file: %s", path)
+	return mb.addPart(NewImageFilePart(path, ""))
+}
+
+// AddFile adds a local document, such as a PDF, encoded as a base64 data URI.
+// Errors are reported by Err.
+func (mb *MessageBuilder) AddFile(path string) *MessageBuilder {
+	mb.logger.Debugf("Adding file: %s", path)
+	return mb.addPart(NewFilePart(path))
+}
+
+// addPart ajoute une partie construite à partir d'un fichier, ou mémorise
+// la première erreur rencontrée.
+func (mb *MessageBuilder) addPart(part ContentPart, err error) *MessageBuilder {
+	if err != nil {
+		mb.logger.Errorf("Failed to add content part: %v", err)
+		if mb.err == nil {
+			mb.err = err
+		}
+		return mb
+	}
+	mb.message.Content = append(mb.message.Content, part)
+	return mb
+}
+
+// AddToolCall adds a tool call to an assistant message, as returned by the model.
+func (mb *MessageBuilder) AddToolCall(call ToolCall) *MessageBuilder {
+	mb.logger.Debugf("Adding tool call: %s", call.Function.Name)
+	call.Index = nil
+	mb.message.ToolCalls = append(mb.message.ToolCalls, call)
+	return mb
+}
+
+// SetToolCallID sets the tool call answered by a message with the tool role.
+func (mb *MessageBuilder) SetToolCallID(toolCallID string) *MessageBuilder {
+	mb.message.ToolCallID = toolCallID
 	return mb
 }
 
+// Err returns the first error encountered while adding files, if any.
+func (mb *MessageBuilder) Err() error {
+	return mb.err
+}
+
 // Build returns the constructed Message.
 func (mb *MessageBuilder) Build() Message {
 	mb.logger.Infof("Building message with %d content parts", len(mb.message.Content))
@@ -57,25 +105,25 @@ func (mb *MessageBuilder) Build() Message {
 // NewTextMessage creates a new Message with a single text content part.
 func NewTextMessage(role, text string) Message {
 	return Message{
-		Role: role,
-		Content: []ContentPart{
-			{
-				Type: "text",
-				Text: text,
-			},
-		},
+		Role:    role,
+		Content: []ContentPart{NewTextPart(text)},
 	}
 }
 
-// NewImageMessage creates a new Message with a single image content part.
+// NewImageMessage creates a new Message with a single image_url content part.
 func NewImageMessage(role, imageURL string) Message {
 	return Message{
-		Role: role,
-		Content: []ContentPart{
-			{
-				Type: "image",
-				Text: imageURL,
-			},
-		},
+		Role:    role,
+		Content: []ContentPart{NewImageURLPart(imageURL, "")},
+	}
+}
+
+// NewToolMessage creates a message with the tool role carrying the result
+// of the tool call toolCallID.
+func NewToolMessage(toolCallID, content string) Message {
+	return Message{
+		Role:       RoleTool,
+		Content:    []ContentPart{NewTextPart(content)},
+		ToolCallID: toolCallID,
 	}
 }
@@ -46,7 +46,7 @@ func TestMessageBuilder(t *testing.T) {
 			t.Errorf("Expected 3 content parts, got %d", len(msg.Content))
 		}
 
-		expectedTypes := []string{"text", "image", "text"}
+		expectedTypes := []string{"text", "image_url", "text"}
 		for i, expectedType := range expectedTypes {
 			if msg.Content[i].Type != expectedType {
 				t.Errorf("Content part %d: expected type %s, got %s",
@@ -78,8 +78,11 @@ func TestHelperFunctions(t *testing.T) {
 		if len(msg.Content) != 1 {
 			t.Errorf("Expected 1 content part, got %d", len(msg.Content))
 		}
-		if msg.Content[0].Type != "image" {
-			t.Errorf("Expected type 'image', got %s", msg.Content[0].Type)
+		if msg.Content[0].Type != "image_url" {
+			t.Errorf("Expected type 'image_url', got %s", msg.Content[0].Type)
+		}
+		if msg.Content[0].ImageURL == nil || msg.Content[0].ImageURL.URL != "https://example.com/image.jpg" {
+			t.Errorf("Expected image URL to be set, got %+v", msg.Content[0].ImageURL)
 		}
 	})
 }
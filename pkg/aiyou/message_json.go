@@ -0,0 +1,240 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// File: pkg/aiyou/message_json.go
+
+package aiyou
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Text returns the concatenation of the message text parts.
+func (m Message) Text() string {
+	var sb strings.Builder
+	for _, part := range m.Content {
+		if part.Type == ContentTypeText {
+			sb.WriteString(part.Text)
+		}
+	}
+	return sb.String()
+}
+
+// MarshalJSON encode le contenu sous forme de tableau de parties et
+// réinjecte les champs inconnus conservés dans Extra.
+func (m Message) MarshalJSON() ([]byte, error) {
+	type message Message
+	return marshalWithExtra(message(m), m.Extra)
+}
+
+// UnmarshalJSON accepte un contenu sous forme de chaîne ou de tableau de
+// parties, et conserve les champs inconnus dans Extra.
+func (m *Message) UnmarshalJSON(data []byte) error {
+	type message Message
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	// Le contenu, chaîne ou tableau de parties, est décodé à part
+	content, err := decodeContent(fields["content"])
+	if err != nil {
+		return err
+	}
+	delete(fields, "content")
+
+	var decoded message
+	extra, err := decodeFields(fields, &decoded)
+	if err != nil {
+		return err
+	}
+	*m = Message(decoded)
+	m.Content = content
+	m.Extra = extra
+	return nil
+}
+
+// MarshalJSON réinjecte les champs inconnus conservés dans Extra.
+func (c Choice) MarshalJSON() ([]byte, error) {
+	type choice Choice
+	return marshalWithExtra(choice(c), c.Extra)
+}
+
+// UnmarshalJSON conserve les champs inconnus dans Extra.
+func (c *Choice) UnmarshalJSON(data []byte) error {
+	type choice Choice
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	var decoded choice
+	extra, err := decodeFields(fields, &decoded)
+	if err != nil {
+		return err
+	}
+	*c = Choice(decoded)
+	c.Extra = extra
+	return nil
+}
+
+// MarshalJSON réinjecte les champs inconnus conservés dans Extra.
+func (r ChatCompletionResponse) MarshalJSON() ([]byte, error) {
+	type response ChatCompletionResponse
+	return marshalWithExtra(response(r), r.Extra)
+}
+
+// UnmarshalJSON conserve les champs inconnus dans Extra.
+func (r *ChatCompletionResponse) UnmarshalJSON(data []byte) error {
+	type response ChatCompletionResponse
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	var decoded response
+	extra, err := decodeFields(fields, &decoded)
+	if err != nil {
+		return err
+	}
+	*r = ChatCompletionResponse(decoded)
+	r.Extra = extra
+	return nil
+}
+
+// decodeContent décode le champ content d'un message : null, chaîne de
+// caractères ou tableau de parties.
+func decodeContent(data json.RawMessage) ([]ContentPart, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return nil, nil
+	}
+
+	switch data[0] {
+	case '"':
+		var text string
+		if err := json.Unmarshal(data, &text); err != nil {
+			return nil, err
+		}
+		return []ContentPart{NewTextPart(text)}, nil
+	case '[':
+		var parts []ContentPart
+		if err := json.Unmarshal(data, &parts); err != nil {
+			return nil, err
+		}
+		return parts, nil
+	default:
+		return nil, fmt.Errorf("invalid message content: expected string or array, got %.20s", data)
+	}
+}
+
+// marshalWithExtra encode v puis y ajoute les champs de extra absents de v.
+func marshalWithExtra(v interface{}, extra map[string]json.RawMessage) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(extra) == 0 {
+		return data, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for name, value := range extra {
+		if _, ok := fields[name]; !ok {
+			fields[name] = value
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// decodeFields décode les champs JSON fields dans la structure pointée par v
+// et retourne ceux qui ne correspondent à aucun de ses champs, ou nil s'il
+// n'y en a pas. Chaque valeur n'est décodée qu'une fois. Comme avec
+// encoding/json, un nom exact prime sur un nom de casse différente.
+func decodeFields(fields map[string]json.RawMessage, v interface{}) (map[string]json.RawMessage, error) {
+	target := reflect.ValueOf(v).Elem()
+	known := structJSONFields(target.Type())
+	decoded := make([]bool, target.NumField())
+
+	for name, value := range fields {
+		if index, ok := known.exact[name]; ok {
+			if err := json.Unmarshal(value, target.Field(index).Addr().Interface()); err != nil {
+				return nil, fmt.Errorf("failed to decode field %q: %w", name, err)
+			}
+			decoded[index] = true
+		}
+	}
+
+	var extra map[string]json.RawMessage
+	for name, value := range fields {
+		if _, ok := known.exact[name]; ok {
+			continue
+		}
+		if index, ok := known.fold[strings.ToLower(name)]; ok {
+			if !decoded[index] {
+				if err := json.Unmarshal(value, target.Field(index).Addr().Interface()); err != nil {
+					return nil, fmt.Errorf("failed to decode field %q: %w", name, err)
+				}
+				decoded[index] = true
+			}
+			continue
+		}
+		if extra == nil {
+			extra = make(map[string]json.RawMessage)
+		}
+		extra[name] = value
+	}
+	return extra, nil
+}
+
+// jsonFields associe les noms JSON des champs exportés d'une structure à
+// leur index.
+type jsonFields struct {
+	exact map[string]int
+	fold  map[string]int // noms en minuscules
+}
+
+// knownFields met en cache les champs JSON par type.
+var knownFields sync.Map // map[reflect.Type]*jsonFields
+
+// structJSONFields retourne les champs JSON exportés de t.
+func structJSONFields(t reflect.Type) *jsonFields {
+	if fields, ok := knownFields.Load(t); ok {
+		return fields.(*jsonFields)
+	}
+
+	fields := &jsonFields{exact: make(map[string]int), fold: make(map[string]int)}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields.exact[name] = i
+		fields.fold[strings.ToLower(name)] = i
+	}
+	knownFields.Store(t, fields)
+	return fields
+}
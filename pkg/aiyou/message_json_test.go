@@ -0,0 +1,131 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package aiyou
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMessageUnmarshalContent(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		parts    int
+		wantText string
+		wantErr  bool
+	}{
+		{"String content", `{"role":"assistant","content":"Bonjour"}`, 1, "Bonjour", false},
+		{"Parts content", `{"role":"assistant","content":[{"type":"text","text":"Bon"},{"type":"image_url","image_url":{"url":"https://example.com/a.png"}},{"type":"text","text":"jour"}]}`, 3, "Bonjour", false},
+		{"Null content", `{"role":"assistant","content":null}`, 0, "", false},
+		{"Missing content", `{"role":"assistant"}`, 0, "", false},
+		{"Invalid content", `{"role":"assistant","content":42}`, 0, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var msg Message
+			err := json.Unmarshal([]byte(tt.input), &msg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if msg.Role != "assistant" || len(msg.Content) != tt.parts {
+				t.Errorf("Unexpected message: %+v", msg)
+			}
+			if msg.Text() != tt.wantText {
+				t.Errorf("Expected text %q, got %q", tt.wantText, msg.Text())
+			}
+		})
+	}
+}
+
+func TestExtraFieldsRoundTrip(t *testing.T) {
+	input := `{"id":"cmpl-1","object":"chat.completion","created":1700000000,"model":"test-model",` +
+		`"system_fingerprint":"fp_1",` +
+		`"choices":[{"index":0,"logprobs":null,"finish_reason":"stop",` +
+		`"message":{"role":"assistant","content":"Hi","refusal":null,"annotations":[]}}]}`
+
+	var resp ChatCompletionResponse
+	if err := json.Unmarshal([]byte(input), &resp); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if resp.ID != "cmpl-1" || len(resp.Choices) != 1 || resp.Choices[0].Message.Text() != "Hi" {
+		t.Fatalf("Unexpected response: %+v", resp)
+	}
+	if string(resp.Extra["system_fingerprint"]) != `"fp_1"` || len(resp.Extra) != 1 {
+		t.Errorf("Unexpected response extra: %v", resp.Extra)
+	}
+	if _, ok := resp.Choices[0].Extra["logprobs"]; !ok || len(resp.Choices[0].Extra) != 1 {
+		t.Errorf("Unexpected choice extra: %v", resp.Choices[0].Extra)
+	}
+	if len(resp.Choices[0].Message.Extra) != 2 {
+		t.Errorf("Unexpected message extra: %v", resp.Choices[0].Message.Extra)
+	}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var fields map[string]interface{}
+	json.Unmarshal(data, &fields)
+	if fields["system_fingerprint"] != "fp_1" {
+		t.Errorf("Expected system_fingerprint to be preserved, got %s", data)
+	}
+	choice := fields["choices"].([]interface{})[0].(map[string]interface{})
+	if _, ok := choice["logprobs"]; !ok {
+		t.Errorf("Expected logprobs to be preserved, got %s", data)
+	}
+	message := choice["message"].(map[string]interface{})
+	if _, ok := message["annotations"]; !ok {
+		t.Errorf("Expected annotations to be preserved, got %s", data)
+	}
+	if _, ok := message["content"].([]interface{}); !ok {
+		t.Errorf("Expected content to be encoded as parts, got %s", data)
+	}
+}
+
+func TestMessageWithoutExtra(t *testing.T) {
+	data, err := json.Marshal(NewTextMessage("user", "Hello"))
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	want := `{"role":"user","content":[{"type":"text","text":"Hello"}]}`
+	if string(data) != want {
+		t.Errorf("Expected %s, got %s", want, data)
+	}
+}
+
+func TestDecodeFields(t *testing.T) {
+	var choice Choice
+	input := `{"Index":2,"index":1,"FINISH_REASON":"stop","logprobs":null}`
+	if err := json.Unmarshal([]byte(input), &choice); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if choice.Index != 1 || choice.FinishReason != "stop" {
+		t.Errorf("Expected exact names to win and other cases to match, got %+v", choice)
+	}
+	if len(choice.Extra) != 1 || choice.Extra["logprobs"] == nil {
+		t.Errorf("Expected only unknown fields in extra, got %v", choice.Extra)
+	}
+
+	if err := json.Unmarshal([]byte(`{"index":"zero"}`), &choice); err == nil {
+		t.Error("Expected error for a known field of the wrong type")
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// File: pkg/aiyou/middleware.go
+
+package aiyou
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// RoundTripperFunc adapte une fonction ordinaire en http.RoundTripper.
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+// RoundTrip implémente http.RoundTripper.
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Middleware enveloppe le transport HTTP du client afin d'intercepter chaque
+// requête sortante : appels API, login JWT et envois multipart. Chaque
+// tentative d'un retry traverse à nouveau la chaîne. Comme pour tout
+// http.RoundTripper, un middleware qui modifie la requête doit d'abord la
+// cloner avec req.Clone.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// WithMiddleware ajoute des middlewares à la chaîne du client. Le premier
+// middleware fourni est le plus externe : il voit la requête en premier et
+// la réponse en dernier. Plusieurs appels s'ajoutent dans l'ordre.
+func WithMiddleware(middlewares ...Middleware) ClientOption {
+	return func(c *Client) error {
+		for _, mw := range middlewares {
+			if mw == nil {
+				return fmt.Errorf("middleware cannot be nil")
+			}
+		}
+		c.middlewares = append(c.middlewares, middlewares...)
+		return nil
+	}
+}
+
+// HeaderMiddleware retourne un middleware qui ajoute les en-têtes fournis à
+// chaque requête, sans écraser ceux déjà positionnés par le client.
+func HeaderMiddleware(headers http.Header) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			for name, values := range headers {
+				if req.Header.Get(name) != "" {
+					continue
+				}
+				for _, value := range values {
+					req.Header.Add(name, value)
+				}
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// chainMiddlewares applique les middlewares autour de base, le premier
+// de la liste devenant l'enveloppe la plus externe.
+func chainMiddlewares(base http.RoundTripper, middlewares []Middleware) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		base = middlewares[i](base)
+	}
+	return base
+}
@@ -0,0 +1,167 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package aiyou
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingMiddleware note le nom du middleware et le chemin de chaque requête.
+func recordingMiddleware(name string, mu *sync.Mutex, calls *[]string) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			mu.Lock()
+			*calls = append(*calls, name+" "+req.URL.Path)
+			mu.Unlock()
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+func newMiddlewareTestServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/login":
+			json.NewEncoder(w).Encode(LoginResponse{
+				Token:     "test_token",
+				ExpiresAt: time.Now().Add(time.Hour),
+			})
+		case "/api/v1/audio/transcriptions":
+			w.Write([]byte(`{"transcription":"ok"}`))
+		default:
+			if r.Header.Get("X-Trace-Id") != "trace-1" {
+				t.Errorf("Expected X-Trace-Id header on %s", r.URL.Path)
+			}
+			w.Write([]byte(`{"message":"success"}`))
+		}
+	}))
+}
+
+func TestMiddlewareChain(t *testing.T) {
+	server := newMiddlewareTestServer(t)
+	defer server.Close()
+
+	var mu sync.Mutex
+	var calls []string
+
+	client, err := NewClient(
+		WithEmailPassword("test@example.com", "password"),
+		WithBaseURL(server.URL),
+		WithLogger(NewDefaultLogger(io.Discard)),
+		WithMiddleware(
+			recordingMiddleware("outer", &mu, &calls),
+			recordingMiddleware("inner", &mu, &calls),
+		),
+		WithMiddleware(HeaderMiddleware(http.Header{"X-Trace-Id": {"trace-1"}})),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	t.Run("Login and API calls go through the chain in order", func(t *testing.T) {
+		resp, err := client.AuthenticatedRequest(context.Background(), "GET", "/test", nil)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+
+		expected := []string{"outer /api/login", "inner /api/login", "outer /test", "inner /test"}
+		if len(calls) != len(expected) {
+			t.Fatalf("Expected calls %v, got %v", expected, calls)
+		}
+		for i := range expected {
+			if calls[i] != expected[i] {
+				t.Errorf("Call %d: expected %q, got %q", i, expected[i], calls[i])
+			}
+		}
+	})
+
+	t.Run("Multipart upload goes through the chain", func(t *testing.T) {
+		calls = nil
+		audioFile := filepath.Join(t.TempDir(), "sample.mp3")
+		if err := os.WriteFile(audioFile, make([]byte, 128), 0644); err != nil {
+			t.Fatalf("Failed to create audio file: %v", err)
+		}
+
+		if _, err := client.TranscribeAudioFile(context.Background(), audioFile, nil); err != nil {
+			t.Fatalf("TranscribeAudioFile failed: %v", err)
+		}
+		if len(calls) != 2 || calls[0] != "outer /api/v1/audio/transcriptions" {
+			t.Errorf("Expected upload to be intercepted, got %v", calls)
+		}
+	})
+}
+
+func TestMiddlewareFaultInjection(t *testing.T) {
+	server := newMiddlewareTestServer(t)
+	defer server.Close()
+
+	var mu sync.Mutex
+	injected := 0
+	faulty := func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if req.URL.Path == "/test" && injected == 0 {
+				injected++
+				return nil, errors.New("injected failure")
+			}
+			return next.RoundTrip(req)
+		})
+	}
+
+	client, err := NewClient(
+		WithBearerToken("test_token"),
+		WithBaseURL(server.URL),
+		WithLogger(NewDefaultLogger(io.Discard)),
+		WithRetry(2, 10*time.Millisecond),
+		WithMiddleware(HeaderMiddleware(http.Header{"X-Trace-Id": {"trace-1"}}), faulty),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	resp, err := client.AuthenticatedRequest(context.Background(), "GET", "/test", nil)
+	if err != nil {
+		t.Fatalf("Expected injected failure to be retried, got %v", err)
+	}
+	resp.Body.Close()
+
+	if injected != 1 {
+		t.Errorf("Expected one injected failure, got %d", injected)
+	}
+}
+
+func TestWithMiddlewareRejectsNil(t *testing.T) {
+	_, err := NewClient(
+		WithBearerToken("test_token"),
+		WithMiddleware(nil),
+	)
+	if err == nil {
+		t.Error("Expected error for nil middleware")
+	}
+}
@@ -37,9 +37,9 @@ type RateLimiter struct {
 
 // RateLimiterConfig contient les options de configuration
 type RateLimiterConfig struct {
-	RequestsPerSecond float64
-	BurstSize         int
-	WaitTimeout       time.Duration
+	RequestsPerSecond float64       `yaml:"requests_per_second"`
+	BurstSize         int           `yaml:"burst_size"`
+	WaitTimeout       time.Duration `yaml:"wait_timeout"`
 }
 
 // NewRateLimiter crée un nouveau rate limiter
@@ -0,0 +1,143 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// File: pkg/aiyou/request.go
+
+package aiyou
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// requestBody décrit le contenu d'une requête pouvant être rejoué à l'identique.
+// Chaque tentative (retry, ré-authentification, fallback) obtient un nouveau
+// lecteur via getBody, ce qui garantit que les mêmes octets sont renvoyés.
+type requestBody struct {
+	contentType string
+	length      int64 // -1 si la taille n'est pas connue à l'avance
+	getBody     func() (io.ReadCloser, error)
+}
+
+// newBytesBody crée un corps rejouable à partir d'une tranche d'octets.
+func newBytesBody(data []byte, contentType string) *requestBody {
+	return &requestBody{
+		contentType: contentType,
+		length:      int64(len(data)),
+		getBody: func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(data)), nil
+		},
+	}
+}
+
+// newReaderBody lit entièrement r une seule fois afin de pouvoir le rejouer.
+// Un lecteur nil donne un corps nil (requête sans contenu).
+func newReaderBody(r io.Reader, contentType string) (*requestBody, error) {
+	if r == nil {
+		return nil, nil
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	return newBytesBody(data, contentType), nil
+}
+
+// newHTTPRequest construit une requête HTTP dont le corps peut être rejoué
+// par la couche transport (GetBody) comme par la logique de retry.
+func (c *Client) newHTTPRequest(ctx context.Context, method, path string, body *requestBody) (*http.Request, error) {
+	if body == nil {
+		return http.NewRequestWithContext(ctx, method, c.baseURL+path, nil)
+	}
+
+	reader, err := body.getBody()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open request body: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+	req.GetBody = body.getBody
+	req.ContentLength = body.length
+	if body.contentType != "" {
+		req.Header.Set("Content-Type", body.contentType)
+	}
+	return req, nil
+}
+
+// formField représente un champ texte d'un formulaire multipart.
+type formField struct {
+	name  string
+	value string
+}
+
+// newMultipartFileBody crée un corps multipart rejouable contenant le fichier
+// filePath suivi des champs fournis. Le fichier est rouvert et le formulaire
+// réécrit en streaming à chaque tentative, avec une frontière fixe afin que
+// les octets envoyés soient identiques d'une tentative à l'autre.
+func newMultipartFileBody(fieldName, filePath string, fields []formField) *requestBody {
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+
+	return &requestBody{
+		contentType: "multipart/form-data; boundary=" + boundary,
+		length:      -1,
+		getBody: func() (io.ReadCloser, error) {
+			file, err := os.Open(filePath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open file: %w", err)
+			}
+
+			pr, pw := io.Pipe()
+			go func() {
+				defer file.Close()
+				writer := multipart.NewWriter(pw)
+				if err := writer.SetBoundary(boundary); err != nil {
+					pw.CloseWithError(err)
+					return
+				}
+
+				part, err := writer.CreateFormFile(fieldName, filepath.Base(filePath))
+				if err != nil {
+					pw.CloseWithError(err)
+					return
+				}
+				if _, err := io.Copy(part, file); err != nil {
+					pw.CloseWithError(err)
+					return
+				}
+				for _, field := range fields {
+					if err := writer.WriteField(field.name, field.value); err != nil {
+						pw.CloseWithError(err)
+						return
+					}
+				}
+				pw.CloseWithError(writer.Close())
+			}()
+
+			return pr, nil
+		},
+	}
+}
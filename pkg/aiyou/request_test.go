@@ -0,0 +1,179 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package aiyou
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// replayServer enregistre le corps de chaque tentative et répond 429 aux
+// premières requêtes sur path, ou coupe la connexion si dropConnection est vrai.
+type replayServer struct {
+	mu             sync.Mutex
+	bodies         [][]byte
+	failures       int
+	dropConnection bool
+}
+
+func (s *replayServer) handler(t *testing.T, path string, success string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/login" {
+			json.NewEncoder(w).Encode(LoginResponse{
+				Token:     "test_token",
+				ExpiresAt: time.Now().Add(time.Hour),
+			})
+			return
+		}
+		if r.URL.Path != path {
+			http.NotFound(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("Failed to read request body: %v", err)
+		}
+
+		s.mu.Lock()
+		s.bodies = append(s.bodies, body)
+		attempt := len(s.bodies)
+		s.mu.Unlock()
+
+		if attempt <= s.failures {
+			if s.dropConnection {
+				conn, _, err := w.(http.Hijacker).Hijack()
+				if err != nil {
+					t.Fatalf("Failed to hijack connection: %v", err)
+				}
+				conn.Close()
+				return
+			}
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(success))
+	}
+}
+
+func (s *replayServer) assertIdenticalBodies(t *testing.T, want int) {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.bodies) != want {
+		t.Fatalf("Expected %d attempts, got %d", want, len(s.bodies))
+	}
+	if len(s.bodies[0]) == 0 {
+		t.Fatal("Expected non-empty body on first attempt")
+	}
+	for i, body := range s.bodies[1:] {
+		if !bytes.Equal(body, s.bodies[0]) {
+			t.Errorf("Attempt %d sent a different body:\nfirst: %q\ngot:   %q", i+2, s.bodies[0], body)
+		}
+	}
+}
+
+// replayTestOptions authentifient le client par JWT et autorisent trois nouvelles tentatives.
+var replayTestOptions = []ClientOption{
+	WithEmailPassword("test@example.com", "password"),
+	WithRetry(3, 10*time.Millisecond),
+}
+
+func TestRetriedChatCompletionResendsBody(t *testing.T) {
+	srv := &replayServer{failures: 2}
+	client := newTestClient(t, srv.handler(t, "/api/v1/chat/completions",
+		`{"id":"chat-1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":[{"type":"text","text":"ok"}]}}]}`), replayTestOptions...)
+	resp, err := client.ChatCompletion(context.Background(), ChatCompletionRequest{
+		Messages:    []Message{NewTextMessage("user", "Hello")},
+		AssistantID: "287",
+	})
+	if err != nil {
+		t.Fatalf("ChatCompletion failed: %v", err)
+	}
+	if resp.ID != "chat-1" {
+		t.Errorf("Expected response ID chat-1, got %s", resp.ID)
+	}
+
+	srv.assertIdenticalBodies(t, 3)
+}
+
+func TestRetriedSaveConversationResendsBody(t *testing.T) {
+	srv := &replayServer{failures: 1}
+	client := newTestClient(t, srv.handler(t, "/api/v1/save", `{"id":"thread-1","object":"thread"}`), replayTestOptions...)
+	resp, err := client.SaveConversation(context.Background(), SaveConversationRequest{
+		AssistantID:  "287",
+		Conversation: "Test conversation",
+		FirstMessage: "Hello",
+	})
+	if err != nil {
+		t.Fatalf("SaveConversation failed: %v", err)
+	}
+	if resp.ID != "thread-1" {
+		t.Errorf("Expected thread ID thread-1, got %s", resp.ID)
+	}
+
+	srv.assertIdenticalBodies(t, 2)
+}
+
+func TestRetryAfterNetworkErrorResendsBody(t *testing.T) {
+	srv := &replayServer{failures: 1, dropConnection: true}
+	client := newTestClient(t, srv.handler(t, "/api/v1/save", `{"id":"thread-1"}`), replayTestOptions...)
+	payload := []byte(`{"assistantId":"287","conversation":"net"}`)
+	resp, err := client.AuthenticatedRequest(context.Background(), "POST", "/api/v1/save", bytes.NewReader(payload))
+	if err != nil {
+		t.Fatalf("AuthenticatedRequest failed: %v", err)
+	}
+	resp.Body.Close()
+
+	srv.assertIdenticalBodies(t, 2)
+	if !bytes.Equal(srv.bodies[1], payload) {
+		t.Errorf("Expected replayed body %q, got %q", payload, srv.bodies[1])
+	}
+}
+
+func TestRetriedAudioUploadResendsMultipart(t *testing.T) {
+	srv := &replayServer{failures: 1}
+	audioFile := filepath.Join(t.TempDir(), "sample.mp3")
+	if err := os.WriteFile(audioFile, bytes.Repeat([]byte("audio"), 1024), 0644); err != nil {
+		t.Fatalf("Failed to create audio file: %v", err)
+	}
+
+	client := newTestClient(t, srv.handler(t, "/api/v1/audio/transcriptions", `{"transcription":"bonjour"}`), replayTestOptions...)
+	resp, err := client.TranscribeAudioFile(context.Background(), audioFile, &AudioTranscriptionRequest{Language: "fr"})
+	if err != nil {
+		t.Fatalf("TranscribeAudioFile failed: %v", err)
+	}
+	if resp.Transcription != "bonjour" {
+		t.Errorf("Expected transcription 'bonjour', got %q", resp.Transcription)
+	}
+
+	srv.assertIdenticalBodies(t, 2)
+	if !bytes.Contains(srv.bodies[1], []byte("audioaudio")) {
+		t.Error("Expected replayed multipart body to contain the audio file")
+	}
+}
@@ -19,54 +19,266 @@ package aiyou
 
 import (
 	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// RetryAttempt décrit l'état d'une opération qui vient d'échouer.
+type RetryAttempt struct {
+	Attempt       int           // Numéro de la tentative échouée (1 pour la première)
+	Err           error         // Erreur retournée par la tentative
+	Elapsed       time.Duration // Temps écoulé depuis le début de la première tentative
+	PreviousDelay time.Duration // Dernier délai d'attente appliqué (0 avant le premier retry)
+}
+
+// RetryPolicy décide si une opération échouée doit être retentée et après quel délai.
+type RetryPolicy interface {
+	// NextDelay retourne le délai à attendre avant la prochaine tentative,
+	// et false si l'opération ne doit plus être retentée.
+	NextDelay(attempt RetryAttempt) (time.Duration, bool)
+}
+
+// JitterMode définit la façon dont l'aléa est appliqué aux délais de backoff.
+type JitterMode int
+
+const (
+	// NoJitter utilise les délais exponentiels exacts
+	NoJitter JitterMode = iota
+	// FullJitter tire un délai uniforme entre 0 et le délai exponentiel
+	FullJitter
+	// DecorrelatedJitter tire un délai entre InitialDelay et trois fois le délai précédent
+	DecorrelatedJitter
+)
+
+// ExponentialBackoff est la RetryPolicy intégrée : backoff exponentiel avec
+// jitter optionnel, plafond par délai et durée totale maximale. Le délai
+// indiqué par le serveur (en-tête Retry-After) est respecté sauf si
+// IgnoreRetryAfter est vrai ; il peut dépasser MaxDelay mais reste borné
+// par MaxElapsedTime.
+type ExponentialBackoff struct {
+	MaxRetries       int                  // Nombre maximum de retries (hors première tentative)
+	InitialDelay     time.Duration        // Délai avant le premier retry
+	MaxDelay         time.Duration        // Plafond d'un délai calculé (0 = pas de plafond)
+	Multiplier       float64              // Facteur de croissance (0 = 2)
+	Jitter           JitterMode           // Stratégie d'aléa
+	MaxElapsedTime   time.Duration        // Durée totale au-delà de laquelle on abandonne (0 = illimitée)
+	IgnoreRetryAfter bool                 // Ignorer l'en-tête Retry-After du serveur
+	Retryable        func(err error) bool // Classification des erreurs (nil = isRetryableError)
+}
+
+// DefaultRetryPolicy retourne la politique utilisée par défaut par le client :
+// 3 retries, délai initial d'une seconde doublé à chaque tentative.
+func DefaultRetryPolicy() *ExponentialBackoff {
+	return &ExponentialBackoff{
+		MaxRetries:   3,
+		InitialDelay: time.Second,
+		Multiplier:   2,
+	}
+}
+
+// NextDelay implémente RetryPolicy.
+func (b *ExponentialBackoff) NextDelay(attempt RetryAttempt) (time.Duration, bool) {
+	retryable := b.Retryable
+	if retryable == nil {
+		retryable = isRetryableError
+	}
+	if !retryable(attempt.Err) || attempt.Attempt > b.MaxRetries {
+		return 0, false
+	}
+
+	delay := b.backoff(attempt)
+	if !b.IgnoreRetryAfter {
+		if serverDelay := retryAfterFromError(attempt.Err); serverDelay > delay {
+			delay = serverDelay
+		}
+	}
+
+	if b.MaxElapsedTime > 0 && attempt.Elapsed+delay > b.MaxElapsedTime {
+		return 0, false
+	}
+	return delay, true
+}
+
+// backoff calcule le délai exponentiel, plafonné et éventuellement randomisé.
+func (b *ExponentialBackoff) backoff(attempt RetryAttempt) time.Duration {
+	multiplier := b.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+
+	if b.Jitter == DecorrelatedJitter {
+		upper := attempt.PreviousDelay * 3
+		if upper < b.InitialDelay {
+			upper = b.InitialDelay
+		}
+		return b.capDelay(randomBetween(b.InitialDelay, upper))
+	}
+
+	delay := float64(b.InitialDelay)
+	for i := 1; i < attempt.Attempt; i++ {
+		delay *= multiplier
+		if b.MaxDelay > 0 && delay >= float64(b.MaxDelay) {
+			break
+		}
+	}
+	capped := b.capDelay(time.Duration(delay))
+
+	if b.Jitter == FullJitter {
+		return randomBetween(0, capped)
+	}
+	return capped
+}
+
+func (b *ExponentialBackoff) capDelay(delay time.Duration) time.Duration {
+	if b.MaxDelay > 0 && delay > b.MaxDelay {
+		return b.MaxDelay
+	}
+	return delay
+}
+
+// randomBetween retourne une durée aléatoire dans l'intervalle [lower, upper].
+func randomBetween(lower, upper time.Duration) time.Duration {
+	if upper <= lower {
+		return lower
+	}
+	return lower + time.Duration(rand.Int64N(int64(upper-lower)+1))
+}
+
+type retryPolicyKey struct{}
+
+// ContextWithRetryPolicy retourne un contexte dont les requêtes utiliseront
+// policy à la place de la politique configurée sur le client.
+func ContextWithRetryPolicy(ctx context.Context, policy RetryPolicy) context.Context {
+	return context.WithValue(ctx, retryPolicyKey{}, policy)
+}
+
+// retryPolicyFromContext retourne la politique portée par ctx, ou fallback.
+func retryPolicyFromContext(ctx context.Context, fallback RetryPolicy) RetryPolicy {
+	if policy, ok := ctx.Value(retryPolicyKey{}).(RetryPolicy); ok && policy != nil {
+		return policy
+	}
+	return fallback
+}
+
 // retryOperation exécute une opération avec une logique de retry.
 // Elle réessaie l'opération jusqu'à ce qu'elle réussisse, que le nombre maximum
 // de tentatives soit atteint, ou que le contexte expire.
 func retryOperation(ctx context.Context, logger Logger, maxRetries int, initialDelay time.Duration, operation func() error) error {
-    var err error
-    delay := initialDelay
-
-    for attempt := 0; attempt <= maxRetries; attempt++ {
-        logger.Debugf("Attempt %d of %d", attempt+1, maxRetries+1)
-        
-        err = operation()
-        if err == nil {
-            logger.Debugf("Operation successful on attempt %d", attempt+1)
-            return nil
-        }
-
-        if !isRetryableError(err) {
-            logger.Errorf("Non-retryable error encountered: %v", err)
-            return err
-        }
-
-        select {
-        case <-ctx.Done():
-            logger.Warnf("Context cancelled, stopping retries")
-            return ctx.Err()
-        default:
-            if attempt < maxRetries {
-                logger.Infof("Retrying after %v", delay)
-                time.Sleep(delay)
-                delay *= 2 // exponential backoff
-            }
-        }
-    }
-
-    logger.Errorf("Max retries reached, last error: %v", err)
-    return err
+	policy := &ExponentialBackoff{
+		MaxRetries:   maxRetries,
+		InitialDelay: initialDelay,
+		Multiplier:   2,
+	}
+	return retryWithPolicy(ctx, logger, policy, operation)
+}
+
+// retryWithPolicy exécute operation en suivant policy. L'attente entre deux
+// tentatives est interrompue dès que le contexte est annulé.
+func retryWithPolicy(ctx context.Context, logger Logger, policy RetryPolicy, operation func() error) error {
+	start := time.Now()
+	var previousDelay time.Duration
+
+	for attempt := 1; ; attempt++ {
+		logger.Debugf("Attempt %d", attempt)
+
+		err := operation()
+		if err == nil {
+			logger.Debugf("Operation successful on attempt %d", attempt)
+			return nil
+		}
+
+		delay, retry := policy.NextDelay(RetryAttempt{
+			Attempt:       attempt,
+			Err:           err,
+			Elapsed:       time.Since(start),
+			PreviousDelay: previousDelay,
+		})
+		if !retry {
+			if isRetryableError(err) {
+				logger.Errorf("Max retries reached, last error: %v", err)
+			} else {
+				logger.Errorf("Non-retryable error encountered: %v", err)
+			}
+			return err
+		}
+
+		logger.Infof("Retrying after %v", delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			logger.Warnf("Context cancelled, stopping retries")
+			return ctx.Err()
+		case <-timer.C:
+		}
+		previousDelay = delay
+	}
 }
 
 // isRetryableError détermine si une erreur peut être retentée.
-// Actuellement, seules les erreurs de type NetworkError et RateLimitError sont considérées comme retryables.
+// Les erreurs réseau, les limitations de débit et les erreurs 502/503/504
+// renvoyées par le serveur sont considérées comme retryables.
 func isRetryableError(err error) bool {
-    switch err.(type) {
-    case *NetworkError, *RateLimitError:
-        return true
-    default:
-        return false
-    }
+	var netErr *NetworkError
+	var rateErr *RateLimitError
+	var apiErr *APIError
+	switch {
+	case errors.As(err, &netErr), errors.As(err, &rateErr):
+		return true
+	case errors.As(err, &apiErr):
+		return isRetryableStatus(apiErr.StatusCode)
+	default:
+		return false
+	}
+}
+
+// isRetryableStatus indique si un code HTTP correspond à une indisponibilité transitoire.
+func isRetryableStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// retryAfterFromError extrait le délai demandé par le serveur, s'il y en a un.
+func retryAfterFromError(err error) time.Duration {
+	var rateErr *RateLimitError
+	if errors.As(err, &rateErr) && !rateErr.IsClientSide {
+		return time.Duration(rateErr.RetryAfter) * time.Second
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return time.Duration(apiErr.RetryAfter) * time.Second
+	}
+	return 0
+}
+
+// parseRetryAfter interprète la valeur d'un en-tête Retry-After, exprimée soit
+// en secondes soit sous forme de date HTTP. Le résultat est arrondi à la seconde
+// supérieure ; 0 est retourné si l'en-tête est absent ou invalide.
+func parseRetryAfter(value string, now time.Time) int {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return seconds
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		wait := date.Sub(now)
+		if wait <= 0 {
+			return 0
+		}
+		return int((wait + time.Second - 1) / time.Second)
+	}
+	return 0
 }
@@ -20,6 +20,9 @@ import (
 	"context"
 	"errors"
 	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -93,3 +96,185 @@ func TestRetryOperation(t *testing.T) {
 		}
 	})
 }
+
+func TestExponentialBackoff(t *testing.T) {
+	networkErr := &NetworkError{Err: errors.New("connection reset")}
+
+	t.Run("Doubling delays", func(t *testing.T) {
+		policy := &ExponentialBackoff{MaxRetries: 3, InitialDelay: 100 * time.Millisecond}
+		expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond}
+		for i, want := range expected {
+			delay, retry := policy.NextDelay(RetryAttempt{Attempt: i + 1, Err: networkErr})
+			if !retry {
+				t.Fatalf("Attempt %d: expected retry", i+1)
+			}
+			if delay != want {
+				t.Errorf("Attempt %d: expected delay %v, got %v", i+1, want, delay)
+			}
+		}
+		if _, retry := policy.NextDelay(RetryAttempt{Attempt: 4, Err: networkErr}); retry {
+			t.Error("Expected no retry once MaxRetries is reached")
+		}
+	})
+
+	t.Run("MaxDelay caps delays", func(t *testing.T) {
+		policy := &ExponentialBackoff{MaxRetries: 10, InitialDelay: time.Second, MaxDelay: 3 * time.Second}
+		delay, _ := policy.NextDelay(RetryAttempt{Attempt: 8, Err: networkErr})
+		if delay != 3*time.Second {
+			t.Errorf("Expected capped delay of 3s, got %v", delay)
+		}
+	})
+
+	t.Run("Full jitter stays within bounds", func(t *testing.T) {
+		policy := &ExponentialBackoff{MaxRetries: 5, InitialDelay: 100 * time.Millisecond, Jitter: FullJitter}
+		for i := 0; i < 100; i++ {
+			delay, _ := policy.NextDelay(RetryAttempt{Attempt: 3, Err: networkErr})
+			if delay < 0 || delay > 400*time.Millisecond {
+				t.Fatalf("Full jitter delay out of bounds: %v", delay)
+			}
+		}
+	})
+
+	t.Run("Decorrelated jitter stays within bounds", func(t *testing.T) {
+		policy := &ExponentialBackoff{
+			MaxRetries:   5,
+			InitialDelay: 100 * time.Millisecond,
+			MaxDelay:     time.Second,
+			Jitter:       DecorrelatedJitter,
+		}
+		for i := 0; i < 100; i++ {
+			delay, _ := policy.NextDelay(RetryAttempt{Attempt: 2, Err: networkErr, PreviousDelay: 200 * time.Millisecond})
+			if delay < 100*time.Millisecond || delay > 600*time.Millisecond {
+				t.Fatalf("Decorrelated jitter delay out of bounds: %v", delay)
+			}
+		}
+	})
+
+	t.Run("Max elapsed time stops retries", func(t *testing.T) {
+		policy := &ExponentialBackoff{MaxRetries: 10, InitialDelay: time.Second, MaxElapsedTime: 5 * time.Second}
+		if _, retry := policy.NextDelay(RetryAttempt{Attempt: 1, Err: networkErr, Elapsed: 4500 * time.Millisecond}); retry {
+			t.Error("Expected no retry beyond MaxElapsedTime")
+		}
+	})
+
+	t.Run("Retry-After is honored", func(t *testing.T) {
+		policy := &ExponentialBackoff{MaxRetries: 3, InitialDelay: 10 * time.Millisecond}
+		delay, retry := policy.NextDelay(RetryAttempt{Attempt: 1, Err: &RateLimitError{RetryAfter: 7}})
+		if !retry || delay != 7*time.Second {
+			t.Errorf("Expected retry after 7s, got %v (retry=%v)", delay, retry)
+		}
+
+		policy.IgnoreRetryAfter = true
+		delay, _ = policy.NextDelay(RetryAttempt{Attempt: 1, Err: &RateLimitError{RetryAfter: 7}})
+		if delay != 10*time.Millisecond {
+			t.Errorf("Expected Retry-After to be ignored, got %v", delay)
+		}
+	})
+
+	t.Run("Gateway errors are retryable", func(t *testing.T) {
+		policy := DefaultRetryPolicy()
+		for _, status := range []int{502, 503, 504} {
+			if _, retry := policy.NextDelay(RetryAttempt{Attempt: 1, Err: &APIError{StatusCode: status}}); !retry {
+				t.Errorf("Expected status %d to be retried", status)
+			}
+		}
+		if _, retry := policy.NextDelay(RetryAttempt{Attempt: 1, Err: &APIError{StatusCode: 500}}); retry {
+			t.Error("Expected status 500 not to be retried")
+		}
+	})
+}
+
+func TestRetryCancelledDuringSleep(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	policy := &ExponentialBackoff{MaxRetries: 3, InitialDelay: 10 * time.Second}
+	start := time.Now()
+	err := retryWithPolicy(ctx, NewDefaultLogger(io.Discard), policy, func() error {
+		return &NetworkError{Err: errors.New("connection failed")}
+	})
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Retry sleep ignored context cancellation, took %v", elapsed)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		value string
+		want  int
+	}{
+		{"", 0},
+		{"120", 120},
+		{"-5", 0},
+		{"invalid", 0},
+		{now.Add(30 * time.Second).Format(http.TimeFormat), 30},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+	}
+
+	for _, tc := range testCases {
+		if got := parseRetryAfter(tc.value, now); got != tc.want {
+			t.Errorf("parseRetryAfter(%q) = %d, want %d", tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestClientRetriesServiceUnavailable(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"message":"success"}`))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(
+		WithBaseURL(server.URL),
+		WithBearerToken("test_token"),
+		WithLogger(NewDefaultLogger(io.Discard)),
+		WithRetryPolicy(&ExponentialBackoff{MaxRetries: 2, InitialDelay: 10 * time.Millisecond}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	t.Run("Retry-After delays the retry", func(t *testing.T) {
+		start := time.Now()
+		resp, err := client.AuthenticatedRequest(context.Background(), "GET", "/test", nil)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+
+		if elapsed := time.Since(start); elapsed < time.Second {
+			t.Errorf("Expected retry to wait for Retry-After, took %v", elapsed)
+		}
+		if got := atomic.LoadInt32(&calls); got != 2 {
+			t.Errorf("Expected 2 calls, got %d", got)
+		}
+	})
+
+	t.Run("Context policy overrides client policy", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+		ctx := ContextWithRetryPolicy(context.Background(), &ExponentialBackoff{MaxRetries: 0})
+		_, err := client.AuthenticatedRequest(ctx, "GET", "/test", nil)
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("Expected 503 APIError, got %v", err)
+		}
+		if apiErr.RetryAfter != 1 {
+			t.Errorf("Expected RetryAfter of 1 second, got %d", apiErr.RetryAfter)
+		}
+		if got := atomic.LoadInt32(&calls); got != 1 {
+			t.Errorf("Expected a single call, got %d", got)
+		}
+	})
+}
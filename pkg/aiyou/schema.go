@@ -0,0 +1,292 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// File: pkg/aiyou/schema.go
+
+package aiyou
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// JSONSchema est le sous-ensemble de JSON Schema utilisé pour décrire les
+// arguments des outils et les réponses structurées.
+type JSONSchema struct {
+	Type                 string                 `json:"type,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	Enum                 []string               `json:"enum,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	AdditionalProperties *JSONSchema            `json:"additionalProperties,omitempty"`
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// SchemaFor génère le schéma JSON du type de v, généralement une structure.
+//
+// Les noms des propriétés suivent les tags json. Les champs sans omitempty
+// sont requis, sauf ceux qu'encoding/json peut encoder en null (pointeurs,
+// slices, maps et interfaces). Le tag description documente un
+// champ et le tag enum liste ses valeurs autorisées, séparées par des virgules :
+//
+//	type WeatherArgs struct {
+//		City string `json:"city" description:"Nom de la ville"`
+//		Unit string `json:"unit,omitempty" enum:"celsius,fahrenheit"`
+//	}
+func SchemaFor(v interface{}) *JSONSchema {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return &JSONSchema{}
+	}
+	return schemaForType(t, make(map[reflect.Type]bool))
+}
+
+// schemaForType génère le schéma de t. visiting protège des types récursifs,
+// dont les occurrences imbriquées sont décrites comme de simples objets.
+func schemaForType(t reflect.Type, visiting map[reflect.Type]bool) *JSONSchema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &JSONSchema{Type: "string", Format: "date-time"}
+	case t == rawMessageType:
+		return &JSONSchema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &JSONSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &JSONSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{Type: "number"}
+	case reflect.String:
+		return &JSONSchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &JSONSchema{Type: "string"} // []byte est encodé en base64
+		}
+		return &JSONSchema{Type: "array", Items: schemaForType(t.Elem(), visiting)}
+	case reflect.Map:
+		return &JSONSchema{Type: "object", AdditionalProperties: schemaForType(t.Elem(), visiting)}
+	case reflect.Struct:
+		if visiting[t] {
+			return &JSONSchema{Type: "object"}
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+
+		schema := &JSONSchema{Type: "object", Properties: make(map[string]*JSONSchema)}
+		addStructFields(schema, t, visiting)
+		return schema
+	default:
+		// interface{} et types non représentables : toute valeur est acceptée
+		return &JSONSchema{}
+	}
+}
+
+// addStructFields ajoute les champs de t aux propriétés de schema, en
+// aplatissant les structures embarquées comme le fait encoding/json.
+func addStructFields(schema *JSONSchema, t reflect.Type, visiting map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				// Une structure embarquant son propre type (type T struct{ *T })
+				// n'apporte aucun champ de plus : ses champs sont déjà décrits
+				if !visiting[embedded] {
+					visiting[embedded] = true
+					addStructFields(schema, embedded, visiting)
+					delete(visiting, embedded)
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := schemaForType(field.Type, visiting)
+		if description := field.Tag.Get("description"); description != "" {
+			property.Description = description
+		}
+		if enum := field.Tag.Get("enum"); enum != "" {
+			property.Enum = strings.Split(enum, ",")
+		}
+		schema.Properties[name] = property
+
+		optional := strings.Contains(","+options+",", ",omitempty,") || nillable(field.Type)
+		if !optional {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
+
+// nillable indique si une valeur de type t peut être encodée en null.
+func nillable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Interface:
+		return true
+	}
+	return false
+}
+
+// Validate vérifie que le document JSON data respecte le schéma. Les
+// propriétés facultatives peuvent valoir null. L'erreur indique le chemin de
+// la première valeur invalide, par exemple $.items[2].name.
+func (s *JSONSchema) Validate(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	return s.validateValue(value, "$")
+}
+
+// validateValue vérifie récursivement value par rapport au schéma.
+func (s *JSONSchema) validateValue(value interface{}, path string) error {
+	if s == nil || s.Type == "" {
+		return nil
+	}
+
+	switch s.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected object, got %s", path, jsonTypeName(value))
+		}
+		for _, name := range s.Required {
+			if _, ok := object[name]; !ok {
+				return fmt.Errorf("%s: missing required property %q", path, name)
+			}
+		}
+		for name, property := range object {
+			schema, known := s.Properties[name]
+			if !known {
+				schema = s.AdditionalProperties
+			}
+			if property == nil && !s.isRequired(name) {
+				continue
+			}
+			if err := schema.validateValue(property, path+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected array, got %s", path, jsonTypeName(value))
+		}
+		for i, item := range items {
+			if err := s.Items.validateValue(item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: expected string, got %s", path, jsonTypeName(value))
+		}
+		if len(s.Enum) > 0 && !containsString(s.Enum, text) {
+			return fmt.Errorf("%s: %q is not one of %s", path, text, strings.Join(s.Enum, ", "))
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, text); err != nil {
+				return fmt.Errorf("%s: %q is not a RFC 3339 date-time", path, text)
+			}
+		}
+	case "integer":
+		number, ok := value.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s: expected integer, got %s", path, jsonTypeName(value))
+		}
+		if _, err := number.Int64(); err != nil {
+			return fmt.Errorf("%s: %s is not an integer", path, number)
+		}
+	case "number":
+		if _, ok := value.(json.Number); !ok {
+			return fmt.Errorf("%s: expected number, got %s", path, jsonTypeName(value))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: expected boolean, got %s", path, jsonTypeName(value))
+		}
+	}
+	return nil
+}
+
+// isRequired indique si la propriété name est requise.
+func (s *JSONSchema) isRequired(name string) bool {
+	return containsString(s.Required, name)
+}
+
+// jsonTypeName retourne le nom du type JSON d'une valeur décodée.
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// containsString indique si values contient value.
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
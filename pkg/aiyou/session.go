@@ -0,0 +1,419 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// File: pkg/aiyou/session.go
+
+package aiyou
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Session conserve l'historique d'une conversation multi-tours avec un
+// assistant, ainsi que son prompt système et son thread. Chaque tour envoie
+// l'historique complet puis y ajoute la question et la réponse.
+//
+// Avec un Summarizer (WithSummarizer), les messages les plus anciens sont
+// régulièrement condensés en un résumé envoyé comme message système. Après
+// un tour en streaming, le résumé est calculé en arrière-plan.
+//
+// Une Session peut être partagée entre goroutines, mais les tours d'une même
+// conversation doivent être envoyés l'un après l'autre.
+type Session struct {
+	mu           sync.Mutex
+	client       *Client
+	assistantID  string
+	systemPrompt string
+	threadID     string
+	modelName    string
+	messages     []Message
+	chatOptions  []ChatOption
+	summarizer   *Summarizer
+	summary      string
+	firstMessage string
+
+	condensing bool           // un résumé en arrière-plan est en cours
+	background sync.WaitGroup // résumés en arrière-plan
+}
+
+// SessionOption configure une Session.
+type SessionOption func(*Session)
+
+// WithSystemPrompt sets the system prompt sent with every turn.
+func WithSystemPrompt(prompt string) SessionOption {
+	return func(s *Session) {
+		s.systemPrompt = prompt
+	}
+}
+
+// WithSessionThreadID attaches the session to an existing conversation thread.
+func WithSessionThreadID(threadID string) SessionOption {
+	return func(s *Session) {
+		s.threadID = threadID
+	}
+}
+
+// WithHistory starts the session with existing messages.
+func WithHistory(messages ...Message) SessionOption {
+	return func(s *Session) {
+		s.messages = append([]Message(nil), messages...)
+	}
+}
+
+// WithSessionModel sets the model name recorded when the session is saved.
+func WithSessionModel(modelName string) SessionOption {
+	return func(s *Session) {
+		s.modelName = modelName
+	}
+}
+
+// WithSessionChatOptions sets chat options (model, temperature, ...) applied
+// to every turn.
+func WithSessionChatOptions(opts ...ChatOption) SessionOption {
+	return func(s *Session) {
+		s.chatOptions = append(s.chatOptions, opts...)
+	}
+}
+
+// WithSummarizer condenses older messages into a rolling summary once the
+// history grows past the summarizer threshold.
+func WithSummarizer(summarizer *Summarizer) SessionOption {
+	return func(s *Session) {
+		s.summarizer = summarizer
+	}
+}
+
+// WithSessionSummary starts the session with the summary of earlier messages.
+func WithSessionSummary(summary string) SessionOption {
+	return func(s *Session) {
+		s.summary = summary
+	}
+}
+
+// NewSession crée une session de conversation avec l'assistant assistantID.
+func NewSession(client *Client, assistantID string, opts ...SessionOption) *Session {
+	session := &Session{
+		client:      client,
+		assistantID: assistantID,
+	}
+	for _, opt := range opts {
+		opt(session)
+	}
+	return session
+}
+
+// RestoreSession recrée une session à partir d'une conversation sauvegardée
+// par Session.Save, y compris le résumé des messages anciens.
+func RestoreSession(ctx context.Context, client *Client, threadID string, opts ...SessionOption) (*Session, error) {
+	thread, err := client.GetConversation(ctx, threadID)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := decodeSessionContent(thread.AssistantContentJson)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &Session{
+		client:       client,
+		assistantID:  thread.AssistantIdOpenAi,
+		threadID:     thread.ID,
+		messages:     content.Messages,
+		summary:      content.Summary,
+		firstMessage: thread.FirstMessage,
+	}
+	if thread.AssistantModel != nil {
+		session.modelName = *thread.AssistantModel
+	}
+	for _, opt := range opts {
+		opt(session)
+	}
+	client.logger.Infof("Restored session %s with %d messages", session.threadID, len(session.messages))
+	return session, nil
+}
+
+// Send envoie un message texte de l'utilisateur et retourne la réponse.
+func (s *Session) Send(ctx context.Context, text string) (*ChatCompletionResponse, error) {
+	return s.SendMessage(ctx, NewTextMessage(RoleUser, text))
+}
+
+// SendMessage envoie msg avec l'historique de la session. En cas de succès,
+// msg et la réponse de l'assistant sont ajoutés à l'historique ; en cas
+// d'erreur, l'historique n'est pas modifié.
+func (s *Session) SendMessage(ctx context.Context, msg Message) (*ChatCompletionResponse, error) {
+	resp, err := s.client.ChatCompletion(ctx, s.request(msg))
+	if err != nil {
+		return nil, err
+	}
+	if err := s.commit(msg, resp); err != nil {
+		return nil, err
+	}
+	s.condense(ctx)
+	return resp, nil
+}
+
+// Stream envoie un message texte de l'utilisateur en mode streaming.
+func (s *Session) Stream(ctx context.Context, text string) (*StreamReader, error) {
+	return s.StreamMessage(ctx, NewTextMessage(RoleUser, text))
+}
+
+// StreamMessage envoie msg avec l'historique de la session en mode streaming.
+// msg et la réponse reconstituée sont ajoutés à l'historique lorsque le flux
+// a été lu jusqu'à sa fin ; un flux fermé avant ou interrompu par une erreur
+// laisse l'historique inchangé. Un éventuel résumé est ensuite calculé en
+// arrière-plan, sans retarder la lecture de la fin du flux ni dépendre de
+// l'annulation de ctx.
+func (s *Session) StreamMessage(ctx context.Context, msg Message) (*StreamReader, error) {
+	req := s.request(msg)
+	req.Stream = true
+	stream, err := s.client.ChatCompletionStream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	acc := NewStreamAccumulator()
+	stream.onChunk = acc.Add
+	stream.onComplete = func() {
+		if err := s.commit(msg, acc.Response()); err != nil {
+			s.client.logger.Errorf("Failed to record streamed reply: %v", err)
+			return
+		}
+		s.condenseAsync(context.WithoutCancel(ctx))
+	}
+	return stream, nil
+}
+
+// request construit la requête d'un tour à partir de l'historique.
+func (s *Session) request(msg Message) ChatCompletionRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages := make([]Message, 0, len(s.messages)+2)
+	if s.summary != "" {
+		messages = append(messages, summaryMessage(s.summary))
+	}
+	messages = append(messages, s.messages...)
+	messages = append(messages, msg)
+
+	req := ChatCompletionRequest{
+		Messages:     messages,
+		AssistantID:  s.assistantID,
+		PromptSystem: s.systemPrompt,
+		ThreadId:     s.threadID,
+	}
+	for _, opt := range s.chatOptions {
+		opt(&req)
+	}
+	return req
+}
+
+// commit ajoute msg et la réponse de l'assistant à l'historique.
+func (s *Session) commit(msg Message, resp *ChatCompletionResponse) error {
+	if resp == nil || len(resp.Choices) == 0 {
+		return errors.New("no choices in response")
+	}
+	reply := resp.Choices[0].Message
+	if reply.Role == "" {
+		reply.Role = RoleAssistant
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, msg, reply)
+	if s.firstMessage == "" && msg.Role == RoleUser {
+		s.firstMessage = msg.Text()
+	}
+	return nil
+}
+
+// condense résume les messages anciens lorsque la session a un Summarizer.
+// Un échec est seulement journalisé : l'historique complet reste utilisé et
+// le résumé sera retenté au tour suivant.
+func (s *Session) condense(ctx context.Context) {
+	if s.summarizer == nil {
+		return
+	}
+	s.mu.Lock()
+	summary, messages := s.summary, append([]Message(nil), s.messages...)
+	s.mu.Unlock()
+
+	condensed, recent, err := s.summarizer.Condense(ctx, summary, messages)
+	if err != nil {
+		s.client.logger.Warnf("Failed to summarize session history: %v", err)
+		return
+	}
+	if len(recent) == len(messages) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.summary != summary || len(s.messages) < len(messages) {
+		return // historique réinitialisé pendant le résumé
+	}
+	// Les messages ajoutés pendant le résumé sont conservés
+	s.messages = append(recent, s.messages[len(messages):]...)
+	s.summary = condensed
+}
+
+// condenseAsync lance condense en arrière-plan, sauf si un résumé y est déjà
+// en cours : le tour suivant le relancera si nécessaire.
+func (s *Session) condenseAsync(ctx context.Context) {
+	if s.summarizer == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.condensing {
+		s.mu.Unlock()
+		return
+	}
+	s.condensing = true
+	s.mu.Unlock()
+
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		s.condense(ctx)
+		s.mu.Lock()
+		s.condensing = false
+		s.mu.Unlock()
+	}()
+}
+
+// Messages retourne une copie de l'historique.
+func (s *Session) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Append ajoute des messages à l'historique sans les envoyer.
+func (s *Session) Append(messages ...Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, messages...)
+}
+
+// Reset vide l'historique et son résumé et détache la session de son thread.
+func (s *Session) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = nil
+	s.summary = ""
+	s.firstMessage = ""
+	s.threadID = ""
+}
+
+// Summary retourne le résumé des messages anciens, vide tant qu'aucun
+// résumé n'a été calculé.
+func (s *Session) Summary() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.summary
+}
+
+// ThreadID retourne l'identifiant du thread de la session, vide tant que
+// la session n'a pas été sauvegardée ou restaurée.
+func (s *Session) ThreadID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.threadID
+}
+
+// SystemPrompt retourne le prompt système de la session.
+func (s *Session) SystemPrompt() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.systemPrompt
+}
+
+// SetSystemPrompt remplace le prompt système envoyé aux tours suivants.
+func (s *Session) SetSystemPrompt(prompt string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.systemPrompt = prompt
+}
+
+// Save sauvegarde la conversation avec SaveConversation. L'historique et son
+// résumé sont stockés dans ContentJson ; la première sauvegarde crée un
+// thread dont l'identifiant est ensuite réutilisé.
+func (s *Session) Save(ctx context.Context) (*SaveConversationResponse, error) {
+	s.mu.Lock()
+	content := sessionContent{
+		Summary:  s.summary,
+		Messages: append([]Message(nil), s.messages...),
+	}
+	req := SaveConversationRequest{
+		AssistantID:    s.assistantID,
+		ThreadID:       s.threadID,
+		ModelName:      s.modelName,
+		FirstMessage:   s.firstMessage,
+		IsNewAppThread: s.threadID == "",
+	}
+	s.mu.Unlock()
+
+	if len(content.Messages) == 0 {
+		return nil, errors.New("cannot save an empty session")
+	}
+	contentJSON, err := json.Marshal(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal session messages: %w", err)
+	}
+	req.ContentJson = string(contentJSON)
+	transcriptMessages := content.Messages
+	if content.Summary != "" {
+		transcriptMessages = append([]Message{summaryMessage(content.Summary)}, transcriptMessages...)
+	}
+	req.Conversation = transcript(transcriptMessages)
+	if req.FirstMessage == "" {
+		for _, msg := range content.Messages {
+			if msg.Role == RoleUser {
+				req.FirstMessage = msg.Text()
+				break
+			}
+		}
+	}
+
+	resp, err := s.client.SaveConversation(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if s.threadID == "" {
+		s.threadID = resp.ID
+	}
+	s.mu.Unlock()
+	return resp, nil
+}
+
+// transcript retourne le texte de la conversation, un message par ligne.
+func transcript(messages []Message) string {
+	var sb strings.Builder
+	for _, msg := range messages {
+		if text := msg.Text(); text != "" {
+			fmt.Fprintf(&sb, "%s: %s\n", msg.Role, text)
+		}
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
@@ -0,0 +1,186 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package aiyou
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// sessionTestServer simule les endpoints de chat et de sauvegarde des conversations.
+type sessionTestServer struct {
+	requests []ChatCompletionRequest
+	saved    []SaveConversationRequest
+	failChat bool
+}
+
+func (s *sessionTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/api/v1/chat/completions":
+		var req ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		s.requests = append(s.requests, req)
+		if s.failChat {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"message":"boom"}`))
+			return
+		}
+		answer := fmt.Sprintf("Réponse %d", len(s.requests))
+		if req.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, "data: {\"id\":\"1\",\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":%q}}]}\n\n", answer)
+			fmt.Fprintf(w, "data: {\"id\":\"1\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n")
+			fmt.Fprintf(w, "data: [DONE]\n\n")
+			return
+		}
+		w.Write([]byte(chatTestResponse(answer)))
+	case "/api/v1/save":
+		var req SaveConversationRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		s.saved = append(s.saved, req)
+		w.Write([]byte(`{"id":"thread-1","object":"thread","createdAt":1700000000}`))
+	case "/api/v1/user/threads":
+		last := s.saved[len(s.saved)-1]
+		json.NewEncoder(w).Encode(UserThreadsOutput{Threads: []ConversationThread{{
+			ID:                   "thread-1",
+			AssistantIdOpenAi:    last.AssistantID,
+			AssistantContentJson: last.ContentJson,
+			FirstMessage:         last.FirstMessage,
+		}}})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestSessionTurns(t *testing.T) {
+	server := &sessionTestServer{}
+	client := newTestClient(t, server)
+	session := NewSession(client, "287", WithSystemPrompt("Sois bref"), WithSessionChatOptions(WithTemperature(0.2)))
+	ctx := context.Background()
+
+	if _, err := session.Send(ctx, "Bonjour"); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	stream, err := session.Stream(ctx, "Et ensuite ?")
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if len(session.Messages()) != 2 {
+		t.Error("Expected history to be updated only once the stream is read")
+	}
+	var text strings.Builder
+	for {
+		chunk, err := stream.ReadChunk()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("ReadChunk failed: %v", err)
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta != nil {
+			text.WriteString(chunk.Choices[0].Delta.Content)
+		}
+	}
+	stream.Close()
+
+	if _, err := session.Send(ctx, "Merci"); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	history := session.Messages()
+	expected := []struct{ role, text string }{
+		{RoleUser, "Bonjour"}, {RoleAssistant, "Réponse 1"},
+		{RoleUser, "Et ensuite ?"}, {RoleAssistant, "Réponse 2"},
+		{RoleUser, "Merci"}, {RoleAssistant, "Réponse 3"},
+	}
+	if len(history) != len(expected) {
+		t.Fatalf("Expected %d messages, got %d", len(expected), len(history))
+	}
+	for i, want := range expected {
+		if history[i].Role != want.role || history[i].Text() != want.text {
+			t.Errorf("Message %d: expected %s %q, got %s %q", i, want.role, want.text, history[i].Role, history[i].Text())
+		}
+	}
+
+	last := server.requests[2]
+	if len(last.Messages) != 5 || last.PromptSystem != "Sois bref" || last.Temperature == nil || *last.Temperature != 0.2 {
+		t.Errorf("Expected full history with session settings, got %+v", last)
+	}
+	if !server.requests[1].Stream {
+		t.Error("Expected second turn to be streamed")
+	}
+
+	server.failChat = true
+	if _, err := session.Send(ctx, "Encore"); err == nil {
+		t.Error("Expected error")
+	}
+	if len(session.Messages()) != 6 {
+		t.Error("Expected history to be unchanged after a failed turn")
+	}
+}
+
+func TestSessionSaveRestore(t *testing.T) {
+	server := &sessionTestServer{}
+	client := newTestClient(t, server)
+	ctx := context.Background()
+
+	session := NewSession(client, "287", WithSessionModel("mistral-small"))
+	if _, err := session.Save(ctx); err == nil {
+		t.Error("Expected error when saving an empty session")
+	}
+	session.Send(ctx, "Bonjour")
+
+	if _, err := session.Save(ctx); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	saved := server.saved[0]
+	if saved.AssistantID != "287" || saved.FirstMessage != "Bonjour" || !saved.IsNewAppThread || saved.ModelName != "mistral-small" {
+		t.Errorf("Unexpected save request: %+v", saved)
+	}
+	if saved.Conversation != "user: Bonjour\nassistant: Réponse 1" {
+		t.Errorf("Unexpected conversation transcript: %q", saved.Conversation)
+	}
+	if session.ThreadID() != "thread-1" {
+		t.Errorf("Expected thread ID to be set after save, got %q", session.ThreadID())
+	}
+
+	session.Send(ctx, "Suite")
+	session.Save(ctx)
+	if server.saved[1].ThreadID != "thread-1" || server.saved[1].IsNewAppThread {
+		t.Errorf("Expected second save to reuse the thread, got %+v", server.saved[1])
+	}
+
+	restored, err := RestoreSession(ctx, client, "thread-1", WithSystemPrompt("Sois bref"))
+	if err != nil {
+		t.Fatalf("RestoreSession failed: %v", err)
+	}
+	if restored.ThreadID() != "thread-1" || len(restored.Messages()) != 4 || restored.SystemPrompt() != "Sois bref" {
+		t.Fatalf("Unexpected restored session: %+v", restored.Messages())
+	}
+
+	restored.Send(ctx, "On reprend")
+	last := server.requests[len(server.requests)-1]
+	if last.ThreadId != "thread-1" || last.AssistantID != "287" || len(last.Messages) != 5 {
+		t.Errorf("Expected restored context to be sent, got %+v", last)
+	}
+}
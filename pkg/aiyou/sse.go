@@ -0,0 +1,146 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// File: pkg/aiyou/sse.go
+
+package aiyou
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StreamEvent est un événement Server-Sent Events décodé.
+type StreamEvent struct {
+	Event string        // Type de l'événement ("message" par défaut)
+	ID    string        // Dernier identifiant d'événement reçu
+	Data  []byte        // Lignes "data" jointes par "\n"
+	Retry time.Duration // Délai de reconnexion demandé, si présent
+}
+
+// IsDone indique si l'événement marque la fin du flux ("data: [DONE]").
+func (e *StreamEvent) IsDone() bool {
+	return string(bytes.TrimSpace(e.Data)) == "[DONE]"
+}
+
+// sseDecoder découpe un flux text/event-stream en événements, selon la
+// spécification HTML Server-Sent Events : fins de ligne CRLF, LF ou CR,
+// commentaires, champs event/data/id/retry et données multi-lignes.
+type sseDecoder struct {
+	reader *bufio.Reader
+	lastID string
+	skipLF bool // la ligne précédente s'est terminée par CR
+}
+
+func newSSEDecoder(r io.Reader) *sseDecoder {
+	return &sseDecoder{reader: bufio.NewReader(r)}
+}
+
+// Next retourne le prochain événement portant des données. Les événements
+// sans données (heartbeats, commentaires seuls) sont ignorés.
+func (d *sseDecoder) Next() (*StreamEvent, error) {
+	var event StreamEvent
+	var data bytes.Buffer
+	hasData := false
+
+	for {
+		line, err := d.readLine()
+		if err != nil {
+			// Un flux terminé sans ligne vide finale livre tout de même son dernier événement
+			if err == io.EOF && hasData {
+				return d.dispatch(&event, &data), nil
+			}
+			return nil, err
+		}
+
+		if len(line) == 0 {
+			if hasData {
+				return d.dispatch(&event, &data), nil
+			}
+			event = StreamEvent{}
+			continue
+		}
+		if line[0] == ':' {
+			continue // commentaire ou heartbeat
+		}
+
+		field, value, found := strings.Cut(line, ":")
+		if found {
+			value = strings.TrimPrefix(value, " ")
+		}
+
+		switch field {
+		case "event":
+			event.Event = value
+		case "data":
+			if hasData {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+			hasData = true
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				d.lastID = value
+			}
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+				event.Retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+}
+
+func (d *sseDecoder) dispatch(event *StreamEvent, data *bytes.Buffer) *StreamEvent {
+	if event.Event == "" {
+		event.Event = "message"
+	}
+	event.ID = d.lastID
+	event.Data = data.Bytes()
+	return event
+}
+
+// readLine lit une ligne terminée par CRLF, LF ou CR, sans son terminateur.
+func (d *sseDecoder) readLine() (string, error) {
+	var line []byte
+	for {
+		b, err := d.reader.ReadByte()
+		if err != nil {
+			if err == io.EOF && len(line) > 0 {
+				return string(line), nil
+			}
+			return "", err
+		}
+		if d.skipLF {
+			d.skipLF = false
+			if b == '\n' {
+				continue
+			}
+		}
+		switch b {
+		case '\n':
+			return string(line), nil
+		case '\r':
+			d.skipLF = true
+			return string(line), nil
+		}
+		line = append(line, b)
+	}
+}
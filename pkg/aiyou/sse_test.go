@@ -0,0 +1,300 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package aiyou
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestStreamReader(stream string) *StreamReader {
+	return NewStreamReader(io.NopCloser(strings.NewReader(stream)), NewDefaultLogger(io.Discard))
+}
+
+func TestSSEDecoder(t *testing.T) {
+	stream := ": heartbeat\r\n" +
+		"retry: 1500\r\n" +
+		"\r\n" +
+		"event: delta\r\n" +
+		"id: 1\r\n" +
+		"data: first line\r\n" +
+		"data:second line\r\n" +
+		"\r\n" +
+		"data: cr only\r\r" +
+		"id: 2\n" +
+		"unknown: field\n" +
+		"data: last"
+
+	decoder := newSSEDecoder(strings.NewReader(stream))
+
+	event, err := decoder.Next()
+	if err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+	if event.Event != "delta" || event.ID != "1" || string(event.Data) != "first line\nsecond line" {
+		t.Errorf("Unexpected first event: %+v (data %q)", event, event.Data)
+	}
+
+	event, err = decoder.Next()
+	if err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+	if event.Event != "message" || event.ID != "1" || string(event.Data) != "cr only" {
+		t.Errorf("Unexpected second event: %+v (data %q)", event, event.Data)
+	}
+
+	event, err = decoder.Next()
+	if err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+	if event.ID != "2" || string(event.Data) != "last" {
+		t.Errorf("Expected unterminated last event to be dispatched, got %+v", event)
+	}
+
+	if _, err := decoder.Next(); err != io.EOF {
+		t.Errorf("Expected io.EOF, got %v", err)
+	}
+}
+
+func TestSSEDecoderRetry(t *testing.T) {
+	decoder := newSSEDecoder(strings.NewReader("retry: 250\ndata: x\n\n"))
+	event, err := decoder.Next()
+	if err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+	if event.Retry != 250*time.Millisecond {
+		t.Errorf("Expected retry of 250ms, got %v", event.Retry)
+	}
+}
+
+func TestStreamReaderEvents(t *testing.T) {
+	chunk := `{"id":"1","choices":[{"index":0,"delta":{"content":"Hi"}}]}`
+
+	t.Run("data: [DONE] ends the stream", func(t *testing.T) {
+		sr := newTestStreamReader("data: " + chunk + "\n\ndata: [DONE]\n\ndata: " + chunk + "\n\n")
+		if _, err := sr.ReadChunk(); err != nil {
+			t.Fatalf("Expected chunk, got %v", err)
+		}
+		if _, err := sr.ReadChunk(); err != io.EOF {
+			t.Errorf("Expected io.EOF at [DONE], got %v", err)
+		}
+		if _, err := sr.ReadChunk(); err != io.EOF {
+			t.Errorf("Expected io.EOF after [DONE], got %v", err)
+		}
+	})
+
+	t.Run("Error event is returned as APIError", func(t *testing.T) {
+		sr := newTestStreamReader("data: " + chunk + "\n\n" +
+			"event: error\ndata: {\"error\":{\"message\":\"model overloaded\",\"type\":\"server_error\",\"code\":503}}\n\n")
+		if _, err := sr.ReadChunk(); err != nil {
+			t.Fatalf("Expected chunk, got %v", err)
+		}
+		_, err := sr.ReadChunk()
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("Expected *APIError, got %v", err)
+		}
+		if apiErr.StatusCode != 503 || apiErr.Message != "model overloaded" || apiErr.Type != "server_error" {
+			t.Errorf("Unexpected error: %+v", apiErr)
+		}
+	})
+
+	t.Run("Noisy stream does not grow the stack", func(t *testing.T) {
+		noise := strings.Repeat(": keep-alive\n\n\n", 200000)
+		sr := newTestStreamReader(noise + "data: not json\n\n" + "data: " + chunk + "\n\n")
+		got, err := sr.ReadChunk()
+		if err != nil {
+			t.Fatalf("Expected chunk after noise, got %v", err)
+		}
+		if got.Choices[0].Delta.Content != "Hi" {
+			t.Errorf("Unexpected chunk: %+v", got)
+		}
+	})
+
+	t.Run("Event type and ID are exposed", func(t *testing.T) {
+		sr := newTestStreamReader("event: chunk\nid: evt-42\ndata: " + chunk + "\n\n")
+		event, err := sr.ReadEvent()
+		if err != nil {
+			t.Fatalf("ReadEvent failed: %v", err)
+		}
+		if event.Event != "chunk" || sr.LastEventID() != "evt-42" {
+			t.Errorf("Unexpected event: %+v", event)
+		}
+	})
+}
+
+func TestStreamReaderTypedErrors(t *testing.T) {
+	chunk := `{"id":"1","choices":[{"index":0,"delta":{"content":"Hi"}}]}`
+	final := `{"id":"1","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`
+
+	t.Run("Error object in data", func(t *testing.T) {
+		sr := newTestStreamReader("data: " + chunk + "\n\n" +
+			`data: {"object":"error","message":"context length exceeded","type":"BadRequestError","code":400}` + "\n\n")
+		if _, err := sr.ReadChunk(); err != nil {
+			t.Fatalf("Expected chunk, got %v", err)
+		}
+		_, err := sr.ReadChunk()
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("Expected *APIError, got %v", err)
+		}
+		if apiErr.Message != "context length exceeded" || apiErr.Type != "BadRequestError" {
+			t.Errorf("Unexpected error: %+v", apiErr)
+		}
+	})
+
+	t.Run("Malformed chunk is skipped by default", func(t *testing.T) {
+		sr := newTestStreamReader("data: {broken\n\ndata: " + chunk + "\n\ndata: [DONE]\n\n")
+		if _, err := sr.ReadChunk(); err != nil {
+			t.Errorf("Expected malformed chunk to be skipped, got %v", err)
+		}
+	})
+
+	t.Run("Malformed chunk fails in strict mode", func(t *testing.T) {
+		sr := newTestStreamReader("data: {broken\n\ndata: " + chunk + "\n\n")
+		sr.SetStrict(true)
+		if _, err := sr.ReadChunk(); !errors.Is(err, ErrMalformedChunk) {
+			t.Errorf("Expected ErrMalformedChunk, got %v", err)
+		}
+	})
+
+	t.Run("EOF without DONE or finish_reason is truncation", func(t *testing.T) {
+		sr := newTestStreamReader("data: " + chunk + "\n\n")
+		if _, err := sr.ReadChunk(); err != nil {
+			t.Fatalf("Expected chunk, got %v", err)
+		}
+		if _, err := sr.ReadChunk(); !errors.Is(err, ErrStreamTruncated) {
+			t.Errorf("Expected ErrStreamTruncated, got %v", err)
+		}
+	})
+
+	t.Run("EOF after finish_reason is a normal end", func(t *testing.T) {
+		sr := newTestStreamReader("data: " + chunk + "\n\ndata: " + final + "\n\n")
+		for i := 0; i < 2; i++ {
+			if _, err := sr.ReadChunk(); err != nil {
+				t.Fatalf("Expected chunk, got %v", err)
+			}
+		}
+		if _, err := sr.ReadChunk(); err != io.EOF {
+			t.Errorf("Expected io.EOF, got %v", err)
+		}
+	})
+}
+
+func TestStreamReaderChunks(t *testing.T) {
+	chunk := `{"id":"1","choices":[{"index":0,"delta":{"content":"Hi"}}]}`
+
+	t.Run("Chunks then error", func(t *testing.T) {
+		sr := newTestStreamReader("data: " + chunk + "\n\ndata: " + chunk + "\n\n")
+		var chunks int
+		var last error
+		for result := range sr.Chunks(context.Background()) {
+			if result.Err != nil {
+				last = result.Err
+				continue
+			}
+			chunks++
+		}
+		if chunks != 2 || !errors.Is(last, ErrStreamTruncated) {
+			t.Errorf("Expected 2 chunks and ErrStreamTruncated, got %d and %v", chunks, last)
+		}
+	})
+}
+
+func TestStreamClosedOnContextCancel(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"id\":\"1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hi\"}}]}\n\n"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client, err := NewClient(
+		WithBearerToken("test_token"),
+		WithBaseURL(server.URL),
+		WithLogger(NewDefaultLogger(io.Discard)),
+		WithStreamReadTimeout(0),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := client.ChatCompletionStream(ctx, ChatCompletionRequest{
+		Messages:    []Message{NewTextMessage("user", "Hello")},
+		AssistantID: "287",
+	})
+	if err != nil {
+		t.Fatalf("ChatCompletionStream failed: %v", err)
+	}
+
+	results := stream.Chunks(ctx)
+	if result := <-results; result.Err != nil {
+		t.Fatalf("Expected first chunk, got %v", result.Err)
+	}
+
+	cancel()
+	select {
+	case _, ok := <-results:
+		if ok {
+			for range results {
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected channel to be closed after cancellation")
+	}
+
+	if _, err := stream.ReadChunk(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled after cancellation, got %v", err)
+	}
+}
+
+func TestStreamReaderUsage(t *testing.T) {
+	sr := newTestStreamReader(`data: {"id":"1","choices":[{"index":0,"delta":{"content":"Hi"}}],"usage":{"prompt_tokens":5,"completion_tokens":1,"total_tokens":6}}` + "\n\n" +
+		`data: {"id":"1","choices":[],"usage":{"prompt_tokens":5,"completion_tokens":2,"total_tokens":7}}` + "\n\n" +
+		"data: [DONE]\n\n")
+
+	if sr.Usage() != nil {
+		t.Error("Expected no usage before reading")
+	}
+	if _, err := sr.ReadChunk(); err != nil {
+		t.Fatalf("Expected chunk, got %v", err)
+	}
+	if usage := sr.Usage(); usage == nil || usage.TotalTokens != 6 {
+		t.Errorf("Expected running usage of 6 tokens, got %+v", usage)
+	}
+	for {
+		if _, err := sr.ReadChunk(); err != nil {
+			break
+		}
+	}
+	if usage := sr.Usage(); usage == nil || usage.TotalTokens != 7 {
+		t.Errorf("Expected final usage of 7 tokens, got %+v", usage)
+	}
+}
@@ -0,0 +1,76 @@
+//go:build go1.23
+
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// File: pkg/aiyou/stream_iter.go
+
+package aiyou
+
+import (
+	"io"
+	"iter"
+)
+
+// All returns an iterator over the chunks of the stream:
+//
+//	for chunk, err := range stream.All() {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+//
+// The iteration stops after the first error, and io.EOF is never yielded.
+// The stream is closed when the iteration ends, including on break.
+func (sr *StreamReader) All() iter.Seq2[*ChatCompletionResponse, error] {
+	return func(yield func(*ChatCompletionResponse, error) bool) {
+		defer sr.Close()
+		for {
+			chunk, err := sr.ReadChunk()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(chunk, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Deltas returns an iterator over the non-empty text deltas of the first
+// choice, with the same error and closing behaviour as All.
+func (sr *StreamReader) Deltas() iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		for chunk, err := range sr.All() {
+			if err != nil {
+				yield("", err)
+				return
+			}
+			if len(chunk.Choices) == 0 || chunk.Choices[0].Delta == nil || chunk.Choices[0].Delta.Content == "" {
+				continue
+			}
+			if !yield(chunk.Choices[0].Delta.Content, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,104 @@
+//go:build go1.23
+
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package aiyou
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// trackingCloser signale la fermeture du flux sous-jacent.
+type trackingCloser struct {
+	io.Reader
+	closed bool
+}
+
+func (c *trackingCloser) Close() error {
+	c.closed = true
+	return nil
+}
+
+const iterTestStream = "data: {\"id\":\"1\",\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\"}}]}\n\n" +
+	"data: {\"id\":\"1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hel\"}}]}\n\n" +
+	"data: {\"id\":\"1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"lo\"}}]}\n\n" +
+	"data: [DONE]\n\n"
+
+func TestStreamReaderAll(t *testing.T) {
+	body := &trackingCloser{Reader: strings.NewReader(iterTestStream)}
+	sr := NewStreamReader(body, NewDefaultLogger(io.Discard))
+
+	count := 0
+	for chunk, err := range sr.All() {
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if chunk.ID != "1" {
+			t.Errorf("Unexpected chunk: %+v", chunk)
+		}
+		count++
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 chunks, got %d", count)
+	}
+	if !body.closed {
+		t.Error("Expected stream to be closed after iteration")
+	}
+}
+
+func TestStreamReaderDeltas(t *testing.T) {
+	t.Run("Text deltas only", func(t *testing.T) {
+		sr := NewStreamReader(io.NopCloser(strings.NewReader(iterTestStream)), NewDefaultLogger(io.Discard))
+		var text strings.Builder
+		for delta, err := range sr.Deltas() {
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			text.WriteString(delta)
+		}
+		if text.String() != "Hello" {
+			t.Errorf("Expected %q, got %q", "Hello", text.String())
+		}
+	})
+
+	t.Run("Break closes the stream", func(t *testing.T) {
+		body := &trackingCloser{Reader: strings.NewReader(iterTestStream)}
+		sr := NewStreamReader(body, NewDefaultLogger(io.Discard))
+		for range sr.Deltas() {
+			break
+		}
+		if !body.closed {
+			t.Error("Expected stream to be closed on break")
+		}
+	})
+
+	t.Run("Errors are yielded", func(t *testing.T) {
+		truncated := strings.TrimSuffix(iterTestStream, "data: [DONE]\n\n")
+		sr := NewStreamReader(io.NopCloser(strings.NewReader(truncated)), NewDefaultLogger(io.Discard))
+		var last error
+		for _, err := range sr.Deltas() {
+			last = err
+		}
+		if !errors.Is(last, ErrStreamTruncated) {
+			t.Errorf("Expected ErrStreamTruncated, got %v", last)
+		}
+	})
+}
@@ -0,0 +1,154 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// File: pkg/aiyou/summarizer.go
+
+package aiyou
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Valeurs par défaut du résumé glissant
+const (
+	DefaultSummaryThreshold  = 40 // Nombre de messages déclenchant un résumé
+	DefaultSummaryKeepRecent = 10 // Messages récents conservés tels quels
+)
+
+// Summarizer condense les messages les plus anciens d'une longue conversation
+// en un résumé, obtenu auprès d'un assistant dédié. Le résumé précédent est
+// repris dans chaque nouveau résumé, qui couvre ainsi toute la conversation.
+type Summarizer struct {
+	client      *Client
+	assistantID string
+	threshold   int
+	keepRecent  int
+}
+
+// SummarizerOption configure un Summarizer.
+type SummarizerOption func(*Summarizer)
+
+// WithSummaryThreshold sets the number of messages above which older
+// messages are summarized.
+func WithSummaryThreshold(messages int) SummarizerOption {
+	return func(z *Summarizer) {
+		z.threshold = messages
+	}
+}
+
+// WithSummaryKeepRecent sets the number of recent messages kept verbatim
+// when older messages are summarized.
+func WithSummaryKeepRecent(messages int) SummarizerOption {
+	return func(z *Summarizer) {
+		z.keepRecent = messages
+	}
+}
+
+// NewSummarizer crée un Summarizer utilisant l'assistant assistantID.
+func NewSummarizer(client *Client, assistantID string, opts ...SummarizerOption) *Summarizer {
+	z := &Summarizer{
+		client:      client,
+		assistantID: assistantID,
+		threshold:   DefaultSummaryThreshold,
+		keepRecent:  DefaultSummaryKeepRecent,
+	}
+	for _, opt := range opts {
+		opt(z)
+	}
+	if z.keepRecent < 1 {
+		z.keepRecent = 1
+	}
+	if z.threshold <= z.keepRecent {
+		z.threshold = z.keepRecent + 1
+	}
+	return z
+}
+
+// Summarize retourne un résumé de messages, complétant le résumé previous.
+// Avec une fenêtre de contexte sur le client (WithContextWindow), les
+// messages sont résumés par tranches tenant dans la fenêtre.
+func (z *Summarizer) Summarize(ctx context.Context, previous string, messages []Message) (string, error) {
+	limit, tokenizer := 0, DefaultTokenizer
+	if window := z.client.contextWindow; window != nil && window.MaxTokens > 0 {
+		limit, tokenizer = window.Budget(&ChatCompletionRequest{}), window.tokenizer()
+	}
+	return summarizeMessages(ctx, z.client, z.assistantID, previous, messages, limit, tokenizer)
+}
+
+// Condense résume les messages les plus anciens lorsque la conversation
+// dépasse le seuil. Il retourne le nouveau résumé et les messages récents
+// conservés, ou summary et messages inchangés sous le seuil.
+func (z *Summarizer) Condense(ctx context.Context, summary string, messages []Message) (string, []Message, error) {
+	cut := z.cutIndex(messages)
+	if cut == 0 {
+		return summary, messages, nil
+	}
+	condensed, err := z.Summarize(ctx, summary, messages[:cut])
+	if err != nil {
+		return summary, messages, err
+	}
+	z.client.logger.Infof("Condensed %d messages into the conversation summary", cut)
+	return condensed, append([]Message(nil), messages[cut:]...), nil
+}
+
+// cutIndex retourne le nombre de messages anciens à résumer, 0 sous le seuil.
+// Les réponses d'outils sont résumées avec l'appel qu'elles complètent.
+func (z *Summarizer) cutIndex(messages []Message) int {
+	if len(messages) <= z.threshold {
+		return 0
+	}
+	cut := len(messages) - z.keepRecent
+	for cut < len(messages)-1 && messages[cut].Role == RoleTool {
+		cut++
+	}
+	return cut
+}
+
+// summaryMessage retourne le message système portant le résumé summary.
+func summaryMessage(summary string) Message {
+	return NewTextMessage(RoleSystem, summaryPrefix+summary)
+}
+
+// sessionContent est le contenu d'une session sauvegardé dans
+// SaveConversationRequest.ContentJson.
+type sessionContent struct {
+	Summary  string    `json:"summary,omitempty"`
+	Messages []Message `json:"messages"`
+}
+
+// decodeSessionContent décode le contenu sauvegardé d'une session. Les
+// sauvegardes antérieures au résumé ne contiennent que le tableau des messages.
+func decodeSessionContent(data string) (sessionContent, error) {
+	var content sessionContent
+	data = strings.TrimSpace(data)
+	switch {
+	case data == "":
+		return content, nil
+	case strings.HasPrefix(data, "["):
+		if err := json.Unmarshal([]byte(data), &content.Messages); err != nil {
+			return content, fmt.Errorf("failed to decode conversation messages: %w", err)
+		}
+	default:
+		if err := json.Unmarshal([]byte(data), &content); err != nil {
+			return content, fmt.Errorf("failed to decode conversation content: %w", err)
+		}
+	}
+	return content, nil
+}
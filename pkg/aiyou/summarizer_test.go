@@ -0,0 +1,190 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package aiyou
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSummarizerCondense(t *testing.T) {
+	var requests []ChatCompletionRequest
+	client := newTestClient(t, chatTestHandler(func(req ChatCompletionRequest) string {
+		requests = append(requests, req)
+		return chatTestResponse("Nouveau résumé")
+	}))
+	summarizer := NewSummarizer(client, "resumeur", WithSummaryThreshold(4), WithSummaryKeepRecent(2))
+	ctx := context.Background()
+
+	short := []Message{NewTextMessage(RoleUser, "Bonjour"), NewTextMessage(RoleAssistant, "Salut")}
+	summary, recent, err := summarizer.Condense(ctx, "", short)
+	if err != nil || summary != "" || len(recent) != 2 || len(requests) != 0 {
+		t.Fatalf("Expected no summary under the threshold, got %q %v (%v)", summary, recent, err)
+	}
+
+	toolCall := NewTextMessage(RoleAssistant, "")
+	toolCall.ToolCalls = []ToolCall{{ID: "call_1", Type: ToolTypeFunction, Function: FunctionCall{Name: "meteo", Arguments: "{}"}}}
+	long := []Message{
+		NewTextMessage(RoleUser, "Bonjour"),
+		NewTextMessage(RoleAssistant, "Salut"),
+		NewTextMessage(RoleUser, "Quel temps fait-il ?"),
+		toolCall,
+		NewToolMessage("call_1", "Soleil"),
+		NewTextMessage(RoleAssistant, "Il fait beau"),
+	}
+	summary, recent, err = summarizer.Condense(ctx, "Ancien résumé", long)
+	if err != nil {
+		t.Fatalf("Condense failed: %v", err)
+	}
+	if summary != "Nouveau résumé" || len(recent) != 1 || recent[0].Text() != "Il fait beau" {
+		t.Errorf("Expected tool result to be summarized with its call, got %q %+v", summary, recent)
+	}
+	prompt := requests[0].Messages[0].Text()
+	if requests[0].AssistantID != "resumeur" || !strings.Contains(prompt, "Ancien résumé") || !strings.Contains(prompt, "user: Quel temps fait-il ?") {
+		t.Errorf("Unexpected summary request: %+v", requests[0])
+	}
+}
+
+func TestSessionRollingSummary(t *testing.T) {
+	server := &sessionTestServer{}
+	client := newTestClient(t, server)
+	ctx := context.Background()
+	summarizer := NewSummarizer(client, "resumeur", WithSummaryThreshold(4), WithSummaryKeepRecent(2))
+	session := NewSession(client, "287", WithSummarizer(summarizer))
+
+	for _, text := range []string{"Bonjour", "Mon routeur est en panne", "Il clignote"} {
+		if _, err := session.Send(ctx, text); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+	}
+	// 3 tours puis la requête de résumé (réponse numéro 4 du serveur)
+	if len(server.requests) != 4 || server.requests[3].AssistantID != "resumeur" {
+		t.Fatalf("Expected a summary request after the third turn, got %d requests", len(server.requests))
+	}
+	if session.Summary() != "Réponse 4" || len(session.Messages()) != 2 {
+		t.Fatalf("Unexpected session state: %q %+v", session.Summary(), session.Messages())
+	}
+
+	session.Send(ctx, "Et maintenant ?")
+	sent := server.requests[4].Messages
+	if len(sent) != 4 || sent[0].Role != RoleSystem || !strings.HasSuffix(sent[0].Text(), "Réponse 4") {
+		t.Errorf("Expected summary to be sent first, got %+v", sent)
+	}
+
+	if _, err := session.Save(ctx); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	saved := server.saved[0]
+	if saved.FirstMessage != "Bonjour" || !strings.Contains(saved.ContentJson, `"summary":"Réponse 4"`) {
+		t.Errorf("Unexpected save request: %+v", saved)
+	}
+
+	restored, err := RestoreSession(ctx, client, session.ThreadID())
+	if err != nil {
+		t.Fatalf("RestoreSession failed: %v", err)
+	}
+	if restored.Summary() != "Réponse 4" || len(restored.Messages()) != 4 {
+		t.Fatalf("Expected summary to be rehydrated, got %q with %d messages", restored.Summary(), len(restored.Messages()))
+	}
+	restored.Send(ctx, "On reprend")
+	last := server.requests[len(server.requests)-1]
+	if last.Messages[0].Role != RoleSystem || !strings.HasSuffix(last.Messages[0].Text(), "Réponse 4") {
+		t.Errorf("Expected rehydrated summary to be sent, got %+v", last.Messages[0])
+	}
+}
+
+func TestSessionStreamSummaryInBackground(t *testing.T) {
+	release := make(chan struct{})
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.AssistantID == "resumeur" {
+			<-release
+			w.Write([]byte(chatTestResponse("Résumé")))
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "data: {\"id\":\"1\",\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"Réponse\"},\"finish_reason\":\"stop\"}]}\n\n")
+		fmt.Fprintf(w, "data: [DONE]\n\n")
+	}))
+	// Débloque le résumé avant l'arrêt du serveur, y compris en cas d'échec
+	releaseSummary := sync.OnceFunc(func() { close(release) })
+	t.Cleanup(releaseSummary)
+	summarizer := NewSummarizer(client, "resumeur", WithSummaryThreshold(2), WithSummaryKeepRecent(1))
+	session := NewSession(client, "287", WithSummarizer(summarizer))
+	session.Append(NewTextMessage(RoleUser, "Bonjour"), NewTextMessage(RoleAssistant, "Bonjour !"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := session.Stream(ctx, "Mon routeur est en panne")
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	read := make(chan error, 1)
+	go func() {
+		for {
+			if _, err := stream.ReadChunk(); err != nil {
+				if err == io.EOF {
+					err = nil
+				}
+				read <- err
+				return
+			}
+		}
+	}()
+	select {
+	case err := <-read:
+		if err != nil {
+			t.Fatalf("ReadChunk failed: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the end of the stream not to wait for the summary")
+	}
+	stream.Close()
+	cancel()
+
+	if len(session.Messages()) != 4 {
+		t.Errorf("Expected the turn to be recorded at the end of the stream, got %d messages", len(session.Messages()))
+	}
+	releaseSummary()
+	session.background.Wait()
+	if session.Summary() != "Résumé" || len(session.Messages()) != 1 {
+		t.Errorf("Expected the history to be summarized after the caller's ctx ended, got %q with %d messages", session.Summary(), len(session.Messages()))
+	}
+}
+
+func TestDecodeSessionContent(t *testing.T) {
+	legacy, err := decodeSessionContent(`[{"role":"user","content":"Bonjour"}]`)
+	if err != nil || legacy.Summary != "" || len(legacy.Messages) != 1 || legacy.Messages[0].Text() != "Bonjour" {
+		t.Errorf("Expected legacy message array to be decoded, got %+v (%v)", legacy, err)
+	}
+
+	content, err := decodeSessionContent(`{"summary":"Résumé","messages":[{"role":"user","content":"Suite"}]}`)
+	if err != nil || content.Summary != "Résumé" || len(content.Messages) != 1 {
+		t.Errorf("Unexpected content: %+v (%v)", content, err)
+	}
+
+	if _, err := decodeSessionContent(`{"messages":`); err == nil {
+		t.Error("Expected error for invalid content")
+	}
+}
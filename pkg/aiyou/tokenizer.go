@@ -0,0 +1,105 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// File: pkg/aiyou/tokenizer.go
+
+package aiyou
+
+import (
+	"unicode"
+)
+
+// Coûts forfaitaires utilisés par l'estimation du nombre de tokens
+const (
+	messageTokenOverhead = 4    // rôle et délimiteurs d'un message
+	imageTokens          = 765  // image en détail élevé
+	imageLowTokens       = 85   // image en détail faible
+	fileTokens           = 1000 // document joint, dont le contenu n'est pas analysé
+)
+
+// Tokenizer compte les tokens d'un texte. Une implémentation exacte pour le
+// modèle utilisé peut remplacer l'estimation par défaut.
+type Tokenizer interface {
+	CountTokens(text string) int
+}
+
+// TokenizerFunc adapte une fonction en Tokenizer.
+type TokenizerFunc func(text string) int
+
+// CountTokens appelle f(text).
+func (f TokenizerFunc) CountTokens(text string) int {
+	return f(text)
+}
+
+// DefaultTokenizer estime le nombre de tokens sans dépendance au modèle :
+// environ un token pour quatre caractères de chaque mot et un token par signe
+// de ponctuation. L'estimation est volontairement un peu pessimiste.
+var DefaultTokenizer Tokenizer = TokenizerFunc(estimateTokens)
+
+// estimateTokens implémente DefaultTokenizer.
+func estimateTokens(text string) int {
+	tokens, word := 0, 0
+	flush := func() {
+		tokens += (word + 3) / 4
+		word = 0
+	}
+	for _, r := range text {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word++
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			flush()
+			tokens++
+		}
+	}
+	flush()
+	return tokens
+}
+
+// CountMessageTokens estime le nombre de tokens de messages avec tokenizer,
+// ou DefaultTokenizer si tokenizer est nil. Les images et les documents
+// joints sont comptés forfaitairement.
+func CountMessageTokens(tokenizer Tokenizer, messages ...Message) int {
+	if tokenizer == nil {
+		tokenizer = DefaultTokenizer
+	}
+
+	total := 0
+	for _, msg := range messages {
+		total += messageTokenOverhead + tokenizer.CountTokens(msg.Role)
+		for _, part := range msg.Content {
+			switch part.Type {
+			case ContentTypeText:
+				total += tokenizer.CountTokens(part.Text)
+			case ContentTypeImageURL:
+				if part.ImageURL != nil && part.ImageURL.Detail == ImageDetailLow {
+					total += imageLowTokens
+				} else {
+					total += imageTokens
+				}
+			case ContentTypeFile:
+				total += fileTokens
+			}
+		}
+		for _, call := range msg.ToolCalls {
+			total += tokenizer.CountTokens(call.Function.Name) + tokenizer.CountTokens(call.Function.Arguments)
+		}
+	}
+	return total
+}
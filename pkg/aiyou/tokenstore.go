@@ -0,0 +1,197 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// File: pkg/aiyou/tokenstore.go
+
+package aiyou
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StoredToken est un token JWT mis en cache avec sa date d'expiration.
+type StoredToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// TokenStore persiste les tokens JWT entre deux exécutions afin d'éviter
+// un appel à /api/login à chaque démarrage.
+type TokenStore interface {
+	// Load retourne le token associé à key, ou nil s'il n'y en a pas.
+	Load(key string) (*StoredToken, error)
+	// Save enregistre le token associé à key.
+	Save(key string, token StoredToken) error
+	// Delete supprime le token associé à key, s'il existe.
+	Delete(key string) error
+}
+
+// TokenCacheKey construit la clé de cache d'un token à partir de l'URL de base
+// de l'API et de l'email de l'utilisateur.
+func TokenCacheKey(baseURL, email string) string {
+	return strings.TrimRight(baseURL, "/") + "|" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// MemoryTokenStore conserve les tokens en mémoire, pour la durée du processus.
+type MemoryTokenStore struct {
+	mu     sync.RWMutex
+	tokens map[string]StoredToken
+}
+
+// NewMemoryTokenStore crée un TokenStore en mémoire.
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{tokens: make(map[string]StoredToken)}
+}
+
+// Load implémente TokenStore.
+func (s *MemoryTokenStore) Load(key string) (*StoredToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	token, ok := s.tokens[key]
+	if !ok {
+		return nil, nil
+	}
+	return &token, nil
+}
+
+// Save implémente TokenStore.
+func (s *MemoryTokenStore) Save(key string, token StoredToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[key] = token
+	return nil
+}
+
+// Delete implémente TokenStore.
+func (s *MemoryTokenStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, key)
+	return nil
+}
+
+// FileTokenStore conserve chaque token dans un fichier JSON lisible par le seul
+// utilisateur courant (permissions 0600, répertoire 0700). Le nom du fichier est
+// dérivé d'un hash de la clé afin de ne pas exposer l'email sur le disque.
+type FileTokenStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// DefaultTokenCacheDir retourne le répertoire de cache par défaut,
+// sous le répertoire de configuration de l'utilisateur.
+func DefaultTokenCacheDir() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate user config dir: %w", err)
+	}
+	return filepath.Join(configDir, "aiyou", "tokens"), nil
+}
+
+// NewFileTokenStore crée un TokenStore fichier dans dir,
+// ou dans DefaultTokenCacheDir si dir est vide.
+func NewFileTokenStore(dir string) (*FileTokenStore, error) {
+	if dir == "" {
+		var err error
+		if dir, err = DefaultTokenCacheDir(); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create token cache dir: %w", err)
+	}
+	return &FileTokenStore{dir: dir}, nil
+}
+
+func (s *FileTokenStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// Load implémente TokenStore.
+func (s *FileTokenStore) Load(key string) (*StoredToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cached token: %w", err)
+	}
+
+	var token StoredToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, fmt.Errorf("failed to decode cached token: %w", err)
+	}
+	return &token, nil
+}
+
+// Save implémente TokenStore. Le fichier est écrit de manière atomique.
+func (s *FileTokenStore) Save(key string, token StoredToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("failed to encode token: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(s.dir, ".token-*")
+	if err != nil {
+		return fmt.Errorf("failed to create token file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set token file permissions: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write token file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write token file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path(key)); err != nil {
+		return fmt.Errorf("failed to save token file: %w", err)
+	}
+	return nil
+}
+
+// Delete implémente TokenStore.
+func (s *FileTokenStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete cached token: %w", err)
+	}
+	return nil
+}
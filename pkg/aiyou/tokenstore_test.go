@@ -0,0 +1,186 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package aiyou
+
+import (
+	"context"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTokenStores(t *testing.T) {
+	fileStore, err := NewFileTokenStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create file store: %v", err)
+	}
+
+	stores := map[string]TokenStore{
+		"Memory": NewMemoryTokenStore(),
+		"File":   fileStore,
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			key := TokenCacheKey("https://ai.example.com/", "User@Example.com")
+
+			token, err := store.Load(key)
+			if err != nil || token != nil {
+				t.Fatalf("Expected empty store, got %v, %v", token, err)
+			}
+
+			expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+			if err := store.Save(key, StoredToken{Token: "jwt", ExpiresAt: expiry}); err != nil {
+				t.Fatalf("Save failed: %v", err)
+			}
+
+			token, err = store.Load(key)
+			if err != nil || token == nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+			if token.Token != "jwt" || !token.ExpiresAt.Equal(expiry) {
+				t.Errorf("Unexpected token loaded: %+v", token)
+			}
+
+			if err := store.Delete(key); err != nil {
+				t.Fatalf("Delete failed: %v", err)
+			}
+			if token, _ := store.Load(key); token != nil {
+				t.Error("Expected token to be deleted")
+			}
+		})
+	}
+}
+
+func TestFileTokenStorePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix permissions not supported on Windows")
+	}
+
+	store, err := NewFileTokenStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create file store: %v", err)
+	}
+	key := TokenCacheKey("https://ai.example.com", "user@example.com")
+	if err := store.Save(key, StoredToken{Token: "jwt", ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	info, err := os.Stat(store.path(key))
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("Expected permissions 0600, got %o", perm)
+	}
+	if strings.Contains(store.path(key), "example.com") {
+		t.Error("Expected token file name not to expose the key")
+	}
+}
+
+func TestJWTAuthenticatorTokenCache(t *testing.T) {
+	server, logins := newLoginCountingServer(t, time.Hour, "")
+	defer server.Close()
+
+	key := TokenCacheKey(server.URL, "test@example.com")
+
+	t.Run("Valid cached token skips login", func(t *testing.T) {
+		store := NewMemoryTokenStore()
+		store.Save(key, StoredToken{Token: "cached", ExpiresAt: time.Now().Add(time.Hour)})
+
+		auth := NewJWTAuthenticator("test@example.com", "password", server.URL, server.Client(), nil)
+		auth.SetTokenStore(store)
+		before := atomic.LoadInt32(logins)
+
+		if err := auth.Authenticate(context.Background()); err != nil {
+			t.Fatalf("Authentication failed: %v", err)
+		}
+		if auth.Token() != "cached" {
+			t.Errorf("Expected cached token, got %q", auth.Token())
+		}
+		if atomic.LoadInt32(logins) != before {
+			t.Error("Expected no login with a valid cached token")
+		}
+	})
+
+	t.Run("Expired cached token triggers login and is replaced", func(t *testing.T) {
+		store := NewMemoryTokenStore()
+		store.Save(key, StoredToken{Token: "stale", ExpiresAt: time.Now().Add(-time.Minute)})
+
+		auth := NewJWTAuthenticator("test@example.com", "password", server.URL, server.Client(), nil)
+		auth.SetTokenStore(store)
+
+		if err := auth.Authenticate(context.Background()); err != nil {
+			t.Fatalf("Authentication failed: %v", err)
+		}
+		cached, _ := store.Load(key)
+		if cached == nil || cached.Token != auth.Token() || cached.Token == "stale" {
+			t.Errorf("Expected fresh token to be cached, got %+v", cached)
+		}
+	})
+
+	t.Run("Client shares cache across instances", func(t *testing.T) {
+		store, err := NewFileTokenStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("Failed to create file store: %v", err)
+		}
+
+		for i := 0; i < 2; i++ {
+			before := atomic.LoadInt32(logins)
+			client, err := NewClient(
+				WithEmailPassword("test@example.com", "password"),
+				WithBaseURL(server.URL),
+				WithLogger(NewDefaultLogger(io.Discard)),
+				WithTokenStore(store),
+			)
+			if err != nil {
+				t.Fatalf("Failed to create client: %v", err)
+			}
+			resp, err := client.AuthenticatedRequest(context.Background(), "GET", "/test", nil)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			resp.Body.Close()
+
+			logged := atomic.LoadInt32(logins) - before
+			if i == 0 && logged != 1 {
+				t.Errorf("Expected first client to log in, got %d logins", logged)
+			}
+			if i == 1 && logged != 0 {
+				t.Errorf("Expected second client to reuse cached token, got %d logins", logged)
+			}
+		}
+	})
+
+	t.Run("Invalidated token is removed from cache", func(t *testing.T) {
+		store := NewMemoryTokenStore()
+		auth := NewJWTAuthenticator("test@example.com", "password", server.URL, server.Client(), nil)
+		auth.SetTokenStore(store)
+		if err := auth.Authenticate(context.Background()); err != nil {
+			t.Fatalf("Authentication failed: %v", err)
+		}
+
+		auth.Invalidate(auth.Token())
+		if cached, _ := store.Load(key); cached != nil {
+			t.Errorf("Expected cached token to be deleted, got %+v", cached)
+		}
+	})
+}
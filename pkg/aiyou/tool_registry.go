@@ -0,0 +1,152 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// File: pkg/aiyou/tool_registry.go
+
+package aiyou
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrUnknownTool est retournée lorsque le modèle appelle un outil non enregistré.
+var ErrUnknownTool = errors.New("unknown tool")
+
+// ToolHandler exécute un outil à partir de ses arguments JSON et retourne le
+// contenu du message de rôle tool renvoyé au modèle.
+type ToolHandler func(ctx context.Context, arguments json.RawMessage) (string, error)
+
+// registeredTool associe la définition d'un outil à son implémentation.
+type registeredTool struct {
+	definition FunctionDefinition
+	handler    ToolHandler
+}
+
+// ToolRegistry associe des noms d'outils à des fonctions Go. Il fournit les
+// définitions à envoyer dans ChatCompletionRequest.Tools et exécute les
+// appels demandés par le modèle. Il peut être utilisé par plusieurs goroutines.
+type ToolRegistry struct {
+	mu    sync.RWMutex
+	tools map[string]*registeredTool
+}
+
+// NewToolRegistry crée un registre d'outils vide.
+func NewToolRegistry() *ToolRegistry {
+	return &ToolRegistry{tools: make(map[string]*registeredTool)}
+}
+
+// Register enregistre un outil décrit par definition. Un outil du même nom
+// est remplacé.
+func (r *ToolRegistry) Register(definition FunctionDefinition, handler ToolHandler) error {
+	if definition.Name == "" {
+		return errors.New("tool name is required")
+	}
+	if handler == nil {
+		return fmt.Errorf("tool %s has no handler", definition.Name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tools[definition.Name] = &registeredTool{definition: definition, handler: handler}
+	return nil
+}
+
+// RegisterFunc enregistre fn comme outil. Le schéma des arguments est généré
+// à partir du type Args (voir SchemaFor) et les arguments JSON reçus sont
+// décodés dans une valeur de ce type. Le résultat est envoyé tel quel s'il
+// s'agit d'une chaîne, encodé en JSON sinon.
+func RegisterFunc[Args, Result any](r *ToolRegistry, name, description string, fn func(ctx context.Context, args Args) (Result, error)) error {
+	var zero Args
+	definition := FunctionDefinition{
+		Name:        name,
+		Description: description,
+		Parameters:  SchemaFor(zero),
+	}
+
+	return r.Register(definition, func(ctx context.Context, arguments json.RawMessage) (string, error) {
+		var args Args
+		if len(strings.TrimSpace(string(arguments))) > 0 {
+			if err := json.Unmarshal(arguments, &args); err != nil {
+				return "", fmt.Errorf("failed to decode arguments of tool %s: %w", name, err)
+			}
+		}
+
+		result, err := fn(ctx, args)
+		if err != nil {
+			return "", err
+		}
+		if text, ok := interface{}(result).(string); ok {
+			return text, nil
+		}
+		data, err := json.Marshal(result)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode result of tool %s: %w", name, err)
+		}
+		return string(data), nil
+	})
+}
+
+// Unregister retire l'outil name du registre.
+func (r *ToolRegistry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tools, name)
+}
+
+// Tools retourne les définitions des outils enregistrés, triées par nom.
+func (r *ToolRegistry) Tools() []Tool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tools := make([]Tool, 0, len(r.tools))
+	for _, tool := range r.tools {
+		tools = append(tools, Tool{Type: ToolTypeFunction, Function: tool.definition})
+	}
+	sort.Slice(tools, func(i, j int) bool {
+		return tools[i].Function.Name < tools[j].Function.Name
+	})
+	return tools
+}
+
+// Call exécute l'appel d'outil call et retourne le résultat de l'outil.
+// Une erreur enveloppant ErrUnknownTool est retournée si l'outil n'est pas enregistré.
+func (r *ToolRegistry) Call(ctx context.Context, call ToolCall) (string, error) {
+	r.mu.RLock()
+	tool, ok := r.tools[call.Function.Name]
+	r.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownTool, call.Function.Name)
+	}
+	return tool.handler(ctx, json.RawMessage(call.Function.Arguments))
+}
+
+// Execute exécute call et retourne le message de rôle tool à renvoyer au
+// modèle. Une erreur de l'outil est transmise au modèle dans ce message, afin
+// qu'il puisse corriger son appel ; elle est aussi retournée à l'appelant.
+func (r *ToolRegistry) Execute(ctx context.Context, call ToolCall) (Message, error) {
+	result, err := r.Call(ctx, call)
+	if err != nil {
+		result = "Error: " + err.Error()
+	}
+	return NewToolMessage(call.ID, result), err
+}
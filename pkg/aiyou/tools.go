@@ -0,0 +1,216 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// File: pkg/aiyou/tools.go
+
+package aiyou
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Rôles des messages d'une conversation
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+)
+
+// Type des outils et des appels d'outils (seules les fonctions sont supportées)
+const ToolTypeFunction = "function"
+
+// Modes de choix d'outil
+const (
+	ToolChoiceAuto     = "auto"     // Le modèle décide d'appeler ou non un outil
+	ToolChoiceNone     = "none"     // Aucun outil n'est appelé
+	ToolChoiceRequired = "required" // Le modèle doit appeler au moins un outil
+)
+
+// FinishReasonToolCalls est la raison de fin d'une réponse demandant des appels d'outils.
+const FinishReasonToolCalls = "tool_calls"
+
+// Tool décrit un outil que le modèle peut appeler.
+type Tool struct {
+	Type     string             `json:"type"` // Toujours "function"
+	Function FunctionDefinition `json:"function"`
+}
+
+// FunctionDefinition décrit une fonction appelable par le modèle.
+type FunctionDefinition struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Parameters  interface{} `json:"parameters,omitempty"` // Schéma JSON des arguments (*JSONSchema, json.RawMessage, map, ...)
+	Strict      bool        `json:"strict,omitempty"`
+}
+
+// NewFunctionTool crée un outil de type fonction.
+func NewFunctionTool(name, description string, parameters interface{}) Tool {
+	return Tool{
+		Type:     ToolTypeFunction,
+		Function: FunctionDefinition{Name: name, Description: description, Parameters: parameters},
+	}
+}
+
+// ToolCall représente un appel d'outil demandé par le modèle. En streaming,
+// Index identifie l'appel auquel se rattache chaque fragment.
+type ToolCall struct {
+	Index    *int         `json:"index,omitempty"` // Position de l'appel (deltas de streaming uniquement)
+	ID       string       `json:"id,omitempty"`
+	Type     string       `json:"type,omitempty"`
+	Function FunctionCall `json:"function"`
+}
+
+// FunctionCall contient le nom de la fonction appelée et ses arguments JSON.
+type FunctionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
+}
+
+// ToolChoice contrôle l'appel des outils : un mode (auto, none, required)
+// ou une fonction imposée.
+type ToolChoice struct {
+	Mode     string // auto, none ou required ; ignoré si Function est renseigné
+	Function string // Nom de la fonction à appeler obligatoirement
+}
+
+// NewToolChoice crée un choix d'outil à partir d'un mode (ToolChoiceAuto, ...).
+func NewToolChoice(mode string) *ToolChoice {
+	return &ToolChoice{Mode: mode}
+}
+
+// ToolChoiceFunction impose l'appel de la fonction name.
+func ToolChoiceFunction(name string) *ToolChoice {
+	return &ToolChoice{Function: name}
+}
+
+// toolChoiceFunction est la forme JSON d'une fonction imposée.
+type toolChoiceFunction struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name string `json:"name"`
+	} `json:"function"`
+}
+
+// MarshalJSON encode le mode sous forme de chaîne, ou la fonction imposée
+// sous forme d'objet.
+func (tc ToolChoice) MarshalJSON() ([]byte, error) {
+	if tc.Function == "" {
+		return json.Marshal(tc.Mode)
+	}
+	var choice toolChoiceFunction
+	choice.Type = ToolTypeFunction
+	choice.Function.Name = tc.Function
+	return json.Marshal(choice)
+}
+
+// UnmarshalJSON accepte les deux formes produites par MarshalJSON.
+func (tc *ToolChoice) UnmarshalJSON(data []byte) error {
+	var mode string
+	if err := json.Unmarshal(data, &mode); err == nil {
+		*tc = ToolChoice{Mode: mode}
+		return nil
+	}
+	var choice toolChoiceFunction
+	if err := json.Unmarshal(data, &choice); err != nil {
+		return fmt.Errorf("invalid tool_choice: %w", err)
+	}
+	*tc = ToolChoice{Function: choice.Function.Name}
+	return nil
+}
+
+// toolCallAssembler reconstitue les appels d'outils complets à partir des
+// fragments reçus dans les deltas d'un flux : l'identifiant et le nom arrivent
+// dans le premier fragment, les arguments sont concaténés au fil des suivants.
+type toolCallAssembler struct {
+	calls map[int]*ToolCall
+	last  int // index du dernier appel, pour les fragments sans index
+}
+
+// add intègre les fragments d'appels d'un delta.
+func (a *toolCallAssembler) add(fragments []ToolCall) {
+	for _, fragment := range fragments {
+		if a.calls == nil {
+			a.calls = make(map[int]*ToolCall)
+			a.last = -1
+		}
+
+		index := a.last
+		switch {
+		case fragment.Index != nil:
+			index = *fragment.Index
+		case fragment.ID != "":
+			// Sans index, un nouvel identifiant marque un nouvel appel
+			index = a.indexOf(fragment.ID)
+		case index < 0:
+			index = 0
+		}
+		a.last = index
+
+		call, ok := a.calls[index]
+		if !ok {
+			call = &ToolCall{Type: ToolTypeFunction}
+			a.calls[index] = call
+		}
+		if fragment.ID != "" {
+			call.ID = fragment.ID
+		}
+		if fragment.Type != "" {
+			call.Type = fragment.Type
+		}
+		if fragment.Function.Name != "" {
+			call.Function.Name = fragment.Function.Name
+		}
+		call.Function.Arguments += fragment.Function.Arguments
+	}
+}
+
+// indexOf retourne l'index de l'appel id, ou un nouvel index s'il est inconnu.
+func (a *toolCallAssembler) indexOf(id string) int {
+	next := 0
+	for index, call := range a.calls {
+		if call.ID == id {
+			return index
+		}
+		if index >= next {
+			next = index + 1
+		}
+	}
+	return next
+}
+
+// toolCalls retourne les appels reconstitués, dans l'ordre de leur index.
+func (a *toolCallAssembler) toolCalls() []ToolCall {
+	if len(a.calls) == 0 {
+		return nil
+	}
+	indexes := make([]int, 0, len(a.calls))
+	for index := range a.calls {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	calls := make([]ToolCall, 0, len(indexes))
+	for _, index := range indexes {
+		call := *a.calls[index]
+		call.Index = nil
+		calls = append(calls, call)
+	}
+	return calls
+}
@@ -0,0 +1,242 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package aiyou
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const toolCallTestStream = `data: {"id":"1","choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":""}}]}}]}
+
+data: {"id":"1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]}}]}
+
+data: {"id":"1","choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_2","type":"function","function":{"name":"get_time","arguments":"{}"}}]}}]}
+
+data: {"id":"1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\"}"}}]},"finish_reason":"tool_calls"}]}
+
+data: [DONE]
+
+`
+
+func checkToolCalls(t *testing.T, calls []ToolCall) {
+	t.Helper()
+	if len(calls) != 2 {
+		t.Fatalf("Expected 2 tool calls, got %+v", calls)
+	}
+	if calls[0].ID != "call_1" || calls[0].Function.Name != "get_weather" || calls[0].Function.Arguments != `{"city":"Paris"}` {
+		t.Errorf("Unexpected first tool call: %+v", calls[0])
+	}
+	if calls[1].ID != "call_2" || calls[1].Function.Name != "get_time" || calls[1].Function.Arguments != "{}" {
+		t.Errorf("Unexpected second tool call: %+v", calls[1])
+	}
+	for _, call := range calls {
+		if call.Index != nil || call.Type != ToolTypeFunction {
+			t.Errorf("Unexpected assembled tool call: %+v", call)
+		}
+	}
+}
+
+func TestStreamToolCalls(t *testing.T) {
+	t.Run("Stream reader", func(t *testing.T) {
+		sr := newTestStreamReader(toolCallTestStream)
+		for {
+			_, err := sr.ReadChunk()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("ReadChunk failed: %v", err)
+			}
+		}
+		checkToolCalls(t, sr.ToolCalls())
+	})
+
+	t.Run("Accumulator", func(t *testing.T) {
+		resp, err := newTestStreamReader(toolCallTestStream).Accumulate()
+		if err != nil {
+			t.Fatalf("Accumulate failed: %v", err)
+		}
+		choice := resp.Choices[0]
+		if choice.FinishReason != FinishReasonToolCalls || choice.Message.Content != nil {
+			t.Errorf("Unexpected choice: %+v", choice)
+		}
+		checkToolCalls(t, choice.Message.ToolCalls)
+	})
+
+	t.Run("Fragments without index", func(t *testing.T) {
+		var a toolCallAssembler
+		a.add([]ToolCall{{ID: "a", Function: FunctionCall{Name: "f", Arguments: `{"x":`}}})
+		a.add([]ToolCall{{Function: FunctionCall{Arguments: `1}`}}})
+		a.add([]ToolCall{{ID: "b", Function: FunctionCall{Name: "g", Arguments: `{}`}}})
+		calls := a.toolCalls()
+		if len(calls) != 2 || calls[0].Function.Arguments != `{"x":1}` || calls[1].ID != "b" {
+			t.Errorf("Unexpected tool calls: %+v", calls)
+		}
+	})
+}
+
+func TestToolChoiceJSON(t *testing.T) {
+	tests := []struct {
+		choice *ToolChoice
+		want   string
+	}{
+		{NewToolChoice(ToolChoiceAuto), `"auto"`},
+		{NewToolChoice(ToolChoiceRequired), `"required"`},
+		{ToolChoiceFunction("get_weather"), `{"type":"function","function":{"name":"get_weather"}}`},
+	}
+	for _, tt := range tests {
+		data, err := json.Marshal(tt.choice)
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		if string(data) != tt.want {
+			t.Errorf("Expected %s, got %s", tt.want, data)
+		}
+		var decoded ToolChoice
+		if err := json.Unmarshal(data, &decoded); err != nil || decoded != *tt.choice {
+			t.Errorf("Round trip of %s failed: %+v, %v", data, decoded, err)
+		}
+	}
+}
+
+func TestToolMessagesJSON(t *testing.T) {
+	input := `{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]}`
+	var msg Message
+	if err := json.Unmarshal([]byte(input), &msg); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if len(msg.ToolCalls) != 1 || msg.ToolCalls[0].Function.Name != "get_weather" || msg.Extra != nil {
+		t.Errorf("Unexpected message: %+v", msg)
+	}
+
+	data, err := json.Marshal(NewToolMessage("call_1", "18°C"))
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	want := `{"role":"tool","content":[{"type":"text","text":"18°C"}],"tool_call_id":"call_1"}`
+	if string(data) != want {
+		t.Errorf("Expected %s, got %s", want, data)
+	}
+
+	built := NewMessageBuilder(RoleTool, NewDefaultLogger(io.Discard)).SetToolCallID("call_1").AddText("18°C").Build()
+	if !reflect.DeepEqual(built, NewToolMessage("call_1", "18°C")) {
+		t.Errorf("Builder and NewToolMessage differ: %+v", built)
+	}
+
+	req := ChatCompletionRequest{Messages: []Message{{Role: RoleTool, Content: []ContentPart{NewTextPart("x")}}}}
+	if err := req.Validate(); err == nil {
+		t.Error("Expected validation error for tool message without tool_call_id")
+	}
+}
+
+type weatherArgs struct {
+	City     string   `json:"city" description:"Nom de la ville"`
+	Unit     string   `json:"unit,omitempty" enum:"celsius,fahrenheit"`
+	Days     *int     `json:"days"`
+	Tags     []string `json:"tags,omitempty"`
+	internal string
+}
+
+func TestSchemaFor(t *testing.T) {
+	schema := SchemaFor(weatherArgs{})
+	data, err := json.Marshal(schema)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	want := `{"type":"object","properties":{` +
+		`"city":{"type":"string","description":"Nom de la ville"},` +
+		`"days":{"type":"integer"},` +
+		`"tags":{"type":"array","items":{"type":"string"}},` +
+		`"unit":{"type":"string","enum":["celsius","fahrenheit"]}},` +
+		`"required":["city"]}`
+	if string(data) != want {
+		t.Errorf("Expected %s\ngot      %s", want, data)
+	}
+
+	type node struct {
+		Name     string  `json:"name"`
+		Children []*node `json:"children"`
+	}
+	recursive := SchemaFor(node{})
+	if recursive.Properties["children"].Items.Type != "object" {
+		t.Errorf("Unexpected recursive schema: %+v", recursive.Properties["children"])
+	}
+
+	type chain struct {
+		*chain
+		Name string `json:"name"`
+	}
+	embedded := SchemaFor(chain{})
+	if len(embedded.Properties) != 1 || embedded.Properties["name"] == nil {
+		t.Errorf("Unexpected self-embedding schema: %+v", embedded.Properties)
+	}
+}
+
+func TestToolRegistry(t *testing.T) {
+	registry := NewToolRegistry()
+	err := RegisterFunc(registry, "get_weather", "Météo d'une ville",
+		func(ctx context.Context, args weatherArgs) (map[string]interface{}, error) {
+			if args.City == "" {
+				return nil, errors.New("city is required")
+			}
+			return map[string]interface{}{"city": args.City, "temperature": 18}, nil
+		})
+	if err != nil {
+		t.Fatalf("RegisterFunc failed: %v", err)
+	}
+	RegisterFunc(registry, "echo", "Renvoie le texte",
+		func(ctx context.Context, args struct {
+			Text string `json:"text"`
+		}) (string, error) {
+			return args.Text, nil
+		})
+
+	tools := registry.Tools()
+	if len(tools) != 2 || tools[0].Function.Name != "echo" || tools[1].Function.Name != "get_weather" {
+		t.Fatalf("Unexpected tools: %+v", tools)
+	}
+	if schema, ok := tools[1].Function.Parameters.(*JSONSchema); !ok || schema.Properties["city"] == nil {
+		t.Errorf("Expected generated schema, got %+v", tools[1].Function.Parameters)
+	}
+
+	ctx := context.Background()
+	result, err := registry.Call(ctx, ToolCall{Function: FunctionCall{Name: "get_weather", Arguments: `{"city":"Paris"}`}})
+	if err != nil || result != `{"city":"Paris","temperature":18}` {
+		t.Errorf("Unexpected result: %s, %v", result, err)
+	}
+	if result, _ := registry.Call(ctx, ToolCall{Function: FunctionCall{Name: "echo", Arguments: `{"text":"bonjour"}`}}); result != "bonjour" {
+		t.Errorf("Expected string result to be sent as is, got %s", result)
+	}
+
+	msg, err := registry.Execute(ctx, ToolCall{ID: "call_1", Function: FunctionCall{Name: "get_weather", Arguments: `{}`}})
+	if err == nil || msg.ToolCallID != "call_1" || !strings.Contains(msg.Text(), "city is required") {
+		t.Errorf("Expected tool error in message, got %+v, %v", msg, err)
+	}
+
+	if _, err := registry.Call(ctx, ToolCall{Function: FunctionCall{Name: "missing"}}); !errors.Is(err, ErrUnknownTool) {
+		t.Errorf("Expected ErrUnknownTool, got %v", err)
+	}
+	if _, err := registry.Call(ctx, ToolCall{Function: FunctionCall{Name: "get_weather", Arguments: `not json`}}); err == nil {
+		t.Error("Expected error for invalid arguments")
+	}
+}
@@ -0,0 +1,282 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// File: pkg/aiyou/transport.go
+
+package aiyou
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Valeurs par défaut du transport construit par le client
+const (
+	DefaultRequestTimeout        = 30 * time.Second
+	DefaultConnectTimeout        = 30 * time.Second
+	DefaultTLSHandshakeTimeout   = 10 * time.Second
+	DefaultResponseHeaderTimeout = 2 * time.Minute
+	DefaultIdleConnTimeout       = 90 * time.Second
+	DefaultStreamReadTimeout     = time.Minute
+)
+
+// TimeoutConfig regroupe les délais appliqués par le transport HTTP du client.
+// Le délai global Request ne s'applique pas aux réponses en streaming, qui
+// sont bornées par le délai de lecture (WithStreamReadTimeout) afin de ne pas
+// être interrompues. Une valeur nulle conserve la valeur par défaut.
+type TimeoutConfig struct {
+	Request        time.Duration // Requête non streamée complète, lecture du corps comprise
+	Connect        time.Duration // Établissement de la connexion TCP
+	TLSHandshake   time.Duration // Négociation TLS
+	ResponseHeader time.Duration // Attente des en-têtes de réponse après l'envoi de la requête
+	IdleConn       time.Duration // Durée de conservation des connexions inactives
+}
+
+// transportConfig accumule les options de transport avant la construction du client.
+type transportConfig struct {
+	proxyURL     *url.URL
+	rootCAs      *x509.CertPool
+	certificates []tls.Certificate
+	timeouts     TimeoutConfig
+	customized   bool // au moins une option de transport a été fournie
+}
+
+// WithHTTPClient makes the client use the given *http.Client for every request,
+// including the JWT login call. Middlewares are applied on a copy of it.
+// It cannot be combined with the proxy, TLS and timeout options.
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(c *Client) error {
+		if httpClient == nil {
+			return fmt.Errorf("http client cannot be nil")
+		}
+		c.customHTTPClient = httpClient
+		return nil
+	}
+}
+
+// WithTransport sets the http.RoundTripper used for every request.
+// It cannot be combined with the proxy, TLS and timeout options.
+func WithTransport(transport http.RoundTripper) ClientOption {
+	return func(c *Client) error {
+		if transport == nil {
+			return fmt.Errorf("transport cannot be nil")
+		}
+		c.customTransport = transport
+		return nil
+	}
+}
+
+// WithProxy routes every request through the given HTTP(S) proxy URL.
+// Without this option, the standard HTTP_PROXY/HTTPS_PROXY/NO_PROXY variables apply.
+func WithProxy(proxyURL string) ClientOption {
+	return func(c *Client) error {
+		parsed, err := url.Parse(proxyURL)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			return fmt.Errorf("invalid proxy URL: %q", proxyURL)
+		}
+		c.transport.proxyURL = parsed
+		c.transport.customized = true
+		return nil
+	}
+}
+
+// WithCACertFile trusts the PEM-encoded certificates of the given bundle
+// in addition to the system certificate pool.
+func WithCACertFile(path string) ClientOption {
+	return func(c *Client) error {
+		pemData, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+
+		pool := c.transport.rootCAs
+		if pool == nil {
+			pool, err = x509.SystemCertPool()
+			if err != nil || pool == nil {
+				pool = x509.NewCertPool()
+			}
+		}
+		if !pool.AppendCertsFromPEM(pemData) {
+			return fmt.Errorf("no valid certificate found in CA bundle: %s", path)
+		}
+
+		c.transport.rootCAs = pool
+		c.transport.customized = true
+		return nil
+	}
+}
+
+// WithClientCertificate configures a client certificate for mutual TLS.
+func WithClientCertificate(certFile, keyFile string) ClientOption {
+	return func(c *Client) error {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		c.transport.certificates = append(c.transport.certificates, cert)
+		c.transport.customized = true
+		return nil
+	}
+}
+
+// WithTimeouts overrides the overall request, connect, TLS handshake, response
+// header and idle connection timeouts of the client transport. Zero values keep
+// the defaults.
+func WithTimeouts(timeouts TimeoutConfig) ClientOption {
+	return func(c *Client) error {
+		if timeouts.Request < 0 || timeouts.Connect < 0 || timeouts.TLSHandshake < 0 || timeouts.ResponseHeader < 0 || timeouts.IdleConn < 0 {
+			return fmt.Errorf("timeouts cannot be negative")
+		}
+		c.transport.timeouts = timeouts
+		c.transport.customized = true
+		return nil
+	}
+}
+
+// WithStreamReadTimeout sets the maximum time to wait for new data on a streaming
+// response before the stream is aborted. Zero disables the deadline.
+func WithStreamReadTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) error {
+		if timeout < 0 {
+			return fmt.Errorf("stream read timeout cannot be negative")
+		}
+		c.streamReadTimeout = timeout
+		return nil
+	}
+}
+
+// streamingRequest marque les requêtes dont la réponse est lue en streaming :
+// elles sont envoyées sans le délai global du client HTTP.
+type streamingRequest struct{}
+
+// buildHTTPClient construit le client HTTP final à partir des options,
+// puis applique la chaîne de middlewares sur son transport. Sauf client
+// fourni par WithHTTPClient, le délai global est celui de TimeoutConfig.
+func (c *Client) buildHTTPClient() (*http.Client, error) {
+	custom := c.customHTTPClient != nil || c.customTransport != nil
+	if custom && c.transport.customized {
+		return nil, fmt.Errorf("proxy, TLS and timeout options cannot be combined with WithHTTPClient or WithTransport")
+	}
+
+	var httpClient http.Client
+	if c.customHTTPClient != nil {
+		httpClient = *c.customHTTPClient
+	}
+	switch {
+	case c.customTransport != nil:
+		httpClient.Transport = c.customTransport
+	case c.customHTTPClient == nil:
+		httpClient.Transport = newTransport(c.transport)
+	}
+	if c.customHTTPClient == nil {
+		httpClient.Timeout = c.transport.timeouts.Request
+		if httpClient.Timeout == 0 {
+			httpClient.Timeout = DefaultRequestTimeout
+		}
+	}
+
+	if len(c.middlewares) > 0 {
+		httpClient.Transport = chainMiddlewares(httpClient.Transport, c.middlewares)
+	}
+	return &httpClient, nil
+}
+
+// streamingHTTPClient retourne une copie de httpClient sans délai global,
+// utilisée pour les requêtes en streaming.
+func streamingHTTPClient(httpClient *http.Client) *http.Client {
+	stream := *httpClient
+	stream.Timeout = 0
+	return &stream
+}
+
+// newTransport crée un *http.Transport à partir de la configuration fournie.
+func newTransport(cfg transportConfig) *http.Transport {
+	timeouts := cfg.timeouts
+	if timeouts.Connect == 0 {
+		timeouts.Connect = DefaultConnectTimeout
+	}
+	if timeouts.TLSHandshake == 0 {
+		timeouts.TLSHandshake = DefaultTLSHandshakeTimeout
+	}
+	if timeouts.ResponseHeader == 0 {
+		timeouts.ResponseHeader = DefaultResponseHeaderTimeout
+	}
+	if timeouts.IdleConn == 0 {
+		timeouts.IdleConn = DefaultIdleConnTimeout
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   timeouts.Connect,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = timeouts.TLSHandshake
+	transport.ResponseHeaderTimeout = timeouts.ResponseHeader
+	transport.IdleConnTimeout = timeouts.IdleConn
+
+	if cfg.proxyURL != nil {
+		transport.Proxy = http.ProxyURL(cfg.proxyURL)
+	}
+	if cfg.rootCAs != nil || len(cfg.certificates) > 0 {
+		transport.TLSClientConfig = &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			RootCAs:      cfg.rootCAs,
+			Certificates: cfg.certificates,
+		}
+	}
+	return transport
+}
+
+// idleTimeoutReader interrompt la lecture d'un flux lorsqu'aucune donnée
+// n'est reçue pendant timeout, en fermant le corps de la réponse.
+type idleTimeoutReader struct {
+	body     io.ReadCloser
+	timeout  time.Duration
+	timedOut atomic.Bool
+}
+
+func newIdleTimeoutReader(body io.ReadCloser, timeout time.Duration) io.ReadCloser {
+	if timeout <= 0 {
+		return body
+	}
+	return &idleTimeoutReader{body: body, timeout: timeout}
+}
+
+func (r *idleTimeoutReader) Read(p []byte) (int, error) {
+	timer := time.AfterFunc(r.timeout, func() {
+		r.timedOut.Store(true)
+		r.body.Close()
+	})
+	n, err := r.body.Read(p)
+	timer.Stop()
+	if err != nil && r.timedOut.Load() {
+		return n, fmt.Errorf("%w: no data received for %v", ErrStreamReadTimeout, r.timeout)
+	}
+	return n, err
+}
+
+func (r *idleTimeoutReader) Close() error {
+	return r.body.Close()
+}
@@ -0,0 +1,372 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package aiyou
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func loginOrSuccess(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/api/login" {
+		json.NewEncoder(w).Encode(LoginResponse{
+			Token:     "test_token",
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+		return
+	}
+	w.Write([]byte(`{"message":"success"}`))
+}
+
+func TestWithHTTPClientAndTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(loginOrSuccess))
+	defer server.Close()
+
+	t.Run("Custom HTTP client is used for login and requests", func(t *testing.T) {
+		var calls int32
+		httpClient := &http.Client{
+			Transport: RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				atomic.AddInt32(&calls, 1)
+				return http.DefaultTransport.RoundTrip(req)
+			}),
+		}
+
+		client, err := NewClient(
+			WithEmailPassword("test@example.com", "password"),
+			WithBaseURL(server.URL),
+			WithLogger(NewDefaultLogger(io.Discard)),
+			WithHTTPClient(httpClient),
+		)
+		if err != nil {
+			t.Fatalf("Failed to create client: %v", err)
+		}
+
+		resp, err := client.AuthenticatedRequest(context.Background(), "GET", "/test", nil)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+
+		if got := atomic.LoadInt32(&calls); got != 2 {
+			t.Errorf("Expected login and request through custom client, got %d calls", got)
+		}
+	})
+
+	t.Run("Custom transport is used", func(t *testing.T) {
+		var calls int32
+		transport := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			atomic.AddInt32(&calls, 1)
+			return http.DefaultTransport.RoundTrip(req)
+		})
+
+		client, err := NewClient(
+			WithBearerToken("test_token"),
+			WithBaseURL(server.URL),
+			WithLogger(NewDefaultLogger(io.Discard)),
+			WithTransport(transport),
+		)
+		if err != nil {
+			t.Fatalf("Failed to create client: %v", err)
+		}
+
+		resp, err := client.AuthenticatedRequest(context.Background(), "GET", "/test", nil)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+
+		if got := atomic.LoadInt32(&calls); got != 1 {
+			t.Errorf("Expected 1 call through custom transport, got %d", got)
+		}
+	})
+
+	t.Run("Transport options conflict with custom client", func(t *testing.T) {
+		_, err := NewClient(
+			WithBearerToken("test_token"),
+			WithHTTPClient(&http.Client{}),
+			WithProxy("http://proxy.example.com:3128"),
+		)
+		if err == nil {
+			t.Error("Expected error when combining WithHTTPClient and WithProxy")
+		}
+	})
+}
+
+func TestWithProxy(t *testing.T) {
+	var proxied int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Host != "aiyou.invalid" {
+			t.Errorf("Expected absolute request for aiyou.invalid, got %s", r.URL)
+		}
+		atomic.AddInt32(&proxied, 1)
+		loginOrSuccess(w, r)
+	}))
+	defer proxy.Close()
+
+	client, err := NewClient(
+		WithEmailPassword("test@example.com", "password"),
+		WithBaseURL("http://aiyou.invalid"),
+		WithLogger(NewDefaultLogger(io.Discard)),
+		WithProxy(proxy.URL),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	resp, err := client.AuthenticatedRequest(context.Background(), "GET", "/test", nil)
+	if err != nil {
+		t.Fatalf("Request through proxy failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if got := atomic.LoadInt32(&proxied); got != 2 {
+		t.Errorf("Expected login and request through proxy, got %d", got)
+	}
+}
+
+// writeClientCertificate génère un certificat client auto-signé et retourne
+// les chemins du certificat et de la clé au format PEM.
+func writeClientCertificate(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "aiyou-test-client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+func TestTLSOptions(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			http.Error(w, "client certificate required", http.StatusUnauthorized)
+			return
+		}
+		loginOrSuccess(w, r)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0600); err != nil {
+		t.Fatalf("Failed to write CA bundle: %v", err)
+	}
+	certFile, keyFile := writeClientCertificate(t, dir)
+
+	t.Run("Custom CA and client certificate", func(t *testing.T) {
+		client, err := NewClient(
+			WithBearerToken("test_token"),
+			WithBaseURL(server.URL),
+			WithLogger(NewDefaultLogger(io.Discard)),
+			WithCACertFile(caFile),
+			WithClientCertificate(certFile, keyFile),
+			WithTimeouts(TimeoutConfig{Connect: 5 * time.Second, ResponseHeader: 5 * time.Second}),
+		)
+		if err != nil {
+			t.Fatalf("Failed to create client: %v", err)
+		}
+
+		resp, err := client.AuthenticatedRequest(context.Background(), "GET", "/test", nil)
+		if err != nil {
+			t.Fatalf("mTLS request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected status 200, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("Unknown CA is rejected", func(t *testing.T) {
+		client, err := NewClient(
+			WithBearerToken("test_token"),
+			WithBaseURL(server.URL),
+			WithLogger(NewDefaultLogger(io.Discard)),
+			WithRetry(0, 0),
+		)
+		if err != nil {
+			t.Fatalf("Failed to create client: %v", err)
+		}
+
+		if _, err := client.AuthenticatedRequest(context.Background(), "GET", "/test", nil); err == nil {
+			t.Error("Expected certificate verification error")
+		}
+	})
+
+	t.Run("Invalid CA bundle", func(t *testing.T) {
+		invalid := filepath.Join(dir, "invalid.pem")
+		os.WriteFile(invalid, []byte("not a certificate"), 0600)
+		if _, err := NewClient(WithBearerToken("test_token"), WithCACertFile(invalid)); err == nil {
+			t.Error("Expected error for invalid CA bundle")
+		}
+	})
+}
+
+func TestStreamReadTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"id\":\"1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hel\"}}]}\n\n"))
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client, err := NewClient(
+		WithBearerToken("test_token"),
+		WithBaseURL(server.URL),
+		WithLogger(NewDefaultLogger(io.Discard)),
+		WithStreamReadTimeout(100*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	stream, err := client.ChatCompletionStream(context.Background(), ChatCompletionRequest{
+		Messages:    []Message{NewTextMessage("user", "Hello")},
+		AssistantID: "287",
+	})
+	if err != nil {
+		t.Fatalf("ChatCompletionStream failed: %v", err)
+	}
+	defer stream.Close()
+
+	if _, err := stream.ReadChunk(); err != nil {
+		t.Fatalf("Expected first chunk, got %v", err)
+	}
+	_, err = stream.ReadChunk()
+	if !errors.Is(err, ErrStreamReadTimeout) {
+		t.Errorf("Expected ErrStreamReadTimeout, got %v", err)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if !req.Stream {
+			// En-têtes puis corps interrompu
+			w.Write([]byte(`{"id":"1",`))
+			w.(http.Flusher).Flush()
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < 4; i++ {
+			w.Write([]byte("data: {\"id\":\"1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"a\"}}]}\n\n"))
+			w.(http.Flusher).Flush()
+			time.Sleep(60 * time.Millisecond)
+		}
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client, err := NewClient(
+		WithBearerToken("test_token"),
+		WithBaseURL(server.URL),
+		WithLogger(NewDefaultLogger(io.Discard)),
+		WithTimeouts(TimeoutConfig{Request: 100 * time.Millisecond}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	t.Run("Stalled body is aborted", func(t *testing.T) {
+		resp, err := client.AuthenticatedRequest(context.Background(), "POST", "/api/v1/chat/completions", strings.NewReader(`{"stream":false}`))
+		if err == nil {
+			_, err = io.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+		if err == nil {
+			t.Error("Expected the request timeout to abort the stalled body")
+		}
+	})
+
+	t.Run("Streams are not bound by the request timeout", func(t *testing.T) {
+		stream, err := client.ChatCompletionStream(context.Background(), ChatCompletionRequest{
+			Messages:    []Message{NewTextMessage("user", "Hello")},
+			AssistantID: "287",
+		})
+		if err != nil {
+			t.Fatalf("ChatCompletionStream failed: %v", err)
+		}
+		defer stream.Close()
+		chunks := 0
+		for {
+			_, err := stream.ReadChunk()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("Stream aborted after %d chunks: %v", chunks, err)
+			}
+			chunks++
+		}
+		if chunks != 4 {
+			t.Errorf("Expected 4 chunks, got %d", chunks)
+		}
+	})
+}
@@ -3,6 +3,7 @@ package aiyou
 
 import (
 	"context"
+	"encoding/json"
 	"time"
 )
 
@@ -12,6 +13,14 @@ type Authenticator interface {
 	Token() string
 }
 
+// RefreshableAuthenticator is implemented by authenticators able to obtain a new
+// token when the server rejects the current one with 401 Unauthorized.
+type RefreshableAuthenticator interface {
+	Authenticator
+	// Invalidate discards token if it is still the current one.
+	Invalidate(token string)
+}
+
 // LoginRequest represents the login request payload.
 type LoginRequest struct {
 	Email    string `json:"email"`
@@ -37,26 +46,39 @@ type LoginResponse struct {
 type ChatCompletionRequest struct {
 	Messages     []Message `json:"messages"`               // Liste des messages de la conversation
 	AssistantID  string    `json:"assistantId"`            // ID de l'assistant à utiliser
-	Temperature  float64   `json:"temperature"`            // Contrôle de la créativité (1-10)
-	TopP         float64   `json:"top_p"`                  // Contrôle de la diversité des réponses
+	Model        string    `json:"model,omitempty"`        // Modèle à utiliser, à défaut celui de l'assistant
+	Temperature  *float64  `json:"temperature,omitempty"`  // Contrôle de la créativité (0-10), nil pour la valeur de l'assistant
+	TopP         *float64  `json:"top_p,omitempty"`        // Contrôle de la diversité des réponses (0-1]
 	Stream       bool      `json:"stream"`                 // Activer le mode streaming
 	PromptSystem string    `json:"promptSystem,omitempty"` // Message système personnalisé
 	Form         string    `json:"form,omitempty"`         // Format de sortie
 	Stop         []string  `json:"stop,omitempty"`         // Séquences d'arrêt
 	ThreadId     string    `json:"threadId,omitempty"`     // ID du thread de conversation
 	MaxTokens    *int      `json:"max_tokens,omitempty"`   // Nombre maximum de tokens
+
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"` // Options du mode streaming (usage)
+	Tools         []Tool         `json:"tools,omitempty"`          // Outils que le modèle peut appeler
+	ToolChoice    *ToolChoice    `json:"tool_choice,omitempty"`    // Contrôle de l'appel des outils
 }
 
 // Message represents a single message in the conversation.
 type Message struct {
 	Role    string        `json:"role"`    // Rôle du message (user, assistant, system)
-	Content []ContentPart `json:"content"` // Contenu du message
+	Content []ContentPart `json:"content"` // Contenu du message, une chaîne est décodée en partie texte
+
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`   // Appels d'outils demandés par l'assistant
+	ToolCallID string     `json:"tool_call_id,omitempty"` // Appel auquel répond un message de rôle tool
+	Name       string     `json:"name,omitempty"`         // Nom de l'outil ou de l'auteur du message
+
+	Extra map[string]json.RawMessage `json:"-"` // Champs inconnus, conservés pour le ré-encodage
 }
 
 // ContentPart represents a part of the message content.
 type ContentPart struct {
-	Type string `json:"type"` // Type de contenu (text, image, etc.)
-	Text string `json:"text"` // Texte du contenu
+	Type     string       `json:"type"`                // Type de contenu (text, image_url, file)
+	Text     string       `json:"text,omitempty"`      // Texte du contenu
+	ImageURL *ImageURL    `json:"image_url,omitempty"` // Image (URL ou data URI) pour le type image_url
+	File     *FileContent `json:"file,omitempty"`      // Document joint pour le type file
 }
 
 // ChatCompletionResponse represents the response from the chat completions endpoint.
@@ -67,6 +89,8 @@ type ChatCompletionResponse struct {
 	Model   string   `json:"model"`           // Modèle utilisé
 	Choices []Choice `json:"choices"`         // Liste des choix de réponse
 	Usage   *Usage   `json:"usage,omitempty"` // Statistiques d'utilisation
+
+	Extra map[string]json.RawMessage `json:"-"` // Champs inconnus, conservés pour le ré-encodage
 }
 
 // Choice represents a single completion choice in the response.
@@ -75,12 +99,15 @@ type Choice struct {
 	Message      Message `json:"message,omitempty"`       // Message pour mode non-streaming
 	Delta        *Delta  `json:"delta,omitempty"`         // Delta pour mode streaming
 	FinishReason string  `json:"finish_reason,omitempty"` // Raison de fin de génération
+
+	Extra map[string]json.RawMessage `json:"-"` // Champs inconnus, conservés pour le ré-encodage
 }
 
 // Delta represents a streaming response delta.
 type Delta struct {
-	Role    string `json:"role,omitempty"`    // Rôle du message
-	Content string `json:"content,omitempty"` // Contenu du message
+	Role      string     `json:"role,omitempty"`       // Rôle du message
+	Content   string     `json:"content,omitempty"`    // Contenu du message
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"` // Fragments d'appels d'outils, identifiés par leur index
 }
 
 // Usage represents token usage information.
@@ -0,0 +1,279 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// File: pkg/prompt/library.go
+
+package prompt
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/chrlesur/aiyou.golib/pkg/aiyou"
+)
+
+// DefaultPattern sélectionne les fichiers chargés par LoadFS et LoadDir
+// lorsqu'aucun motif n'est donné.
+const DefaultPattern = "*.tmpl"
+
+// ErrTemplateNotFound est retournée pour un template absent de la bibliothèque.
+var ErrTemplateNotFound = errors.New("prompt template not found")
+
+// Library regroupe des templates de prompts. Chaque template peut inclure
+// les autres comme partials avec {{template "nom" .}}.
+//
+// Le corps d'un template est un text/template dont les blocs commencent par
+// {{role "system"}}, {{role "user"}} ou {{role "assistant"}} ; un template
+// sans bloc produit un unique message utilisateur. Un en-tête YAML optionnel,
+// entre deux lignes "---", déclare son nom, sa version et ses variables :
+//
+//	---
+//	name: triage
+//	version: "3"
+//	variables:
+//	  customer: string
+//	  urgent: {type: bool, default: false}
+//	---
+//	{{role "system"}}Tu es un agent de support.
+//	{{role "user"}}Client : {{.customer}}
+type Library struct {
+	mu        sync.RWMutex
+	root      *template.Template
+	templates map[string]*Template
+	logger    aiyou.Logger
+}
+
+// Option configure une Library.
+type Option func(*Library)
+
+// WithLogger sets the logger used to record rendered template versions.
+func WithLogger(logger aiyou.Logger) Option {
+	return func(l *Library) {
+		l.logger = logger
+	}
+}
+
+// NewLibrary crée une bibliothèque de templates vide.
+func NewLibrary(opts ...Option) *Library {
+	l := &Library{
+		templates: make(map[string]*Template),
+		logger:    aiyou.NewDefaultLogger(os.Stderr),
+	}
+	l.root = template.New("").Option("missingkey=error").Funcs(template.FuncMap{
+		"role": unboundRole,
+		"join": strings.Join,
+	})
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// LoadDir charge les templates du répertoire dir correspondant aux motifs
+// (DefaultPattern par défaut).
+func (l *Library) LoadDir(dir string, patterns ...string) error {
+	return l.LoadFS(os.DirFS(dir), patterns...)
+}
+
+// LoadFS charge les templates de fsys correspondant aux motifs
+// (DefaultPattern par défaut), par exemple depuis un embed.FS.
+func (l *Library) LoadFS(fsys fs.FS, patterns ...string) error {
+	if len(patterns) == 0 {
+		patterns = []string{DefaultPattern}
+	}
+
+	var files []string
+	for _, pattern := range patterns {
+		matches, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return fmt.Errorf("failed to list templates: %w", err)
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return fmt.Errorf("failed to read template %s: %w", file, err)
+		}
+		name := strings.TrimSuffix(path.Base(file), path.Ext(file))
+		if _, err := l.Parse(name, string(data)); err != nil {
+			return fmt.Errorf("failed to load template %s: %w", file, err)
+		}
+	}
+	l.logger.Debugf("Loaded %d prompt templates", len(files))
+	return nil
+}
+
+// Parse ajoute à la bibliothèque le template source. name est utilisé si
+// l'en-tête ne déclare pas de nom ; un template de même nom est remplacé.
+func (l *Library) Parse(name, source string) (*Template, error) {
+	h, body, err := parseSource(source)
+	if err != nil {
+		return nil, err
+	}
+	if h.Name != "" {
+		name = h.Name
+	}
+	if name == "" {
+		return nil, errors.New("template name is required")
+	}
+
+	t := &Template{
+		library:     l,
+		name:        name,
+		version:     h.Version,
+		description: h.Description,
+		variables:   h.Variables,
+	}
+	if t.version == "" {
+		t.version = contentVersion(source)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.root.New(name).Parse(body); err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", name, err)
+	}
+	l.templates[name] = t
+	return t, nil
+}
+
+// Get retourne le template name.
+func (l *Library) Get(name string) (*Template, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	t, ok := l.templates[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+	return t, nil
+}
+
+// Names retourne les noms des templates de la bibliothèque, triés.
+func (l *Library) Names() []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	names := make([]string, 0, len(l.templates))
+	for name := range l.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Render rend le template name avec vars et retourne ses messages.
+func (l *Library) Render(name string, vars Vars) ([]aiyou.Message, error) {
+	t, err := l.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return t.Render(vars)
+}
+
+// render exécute t et découpe le texte obtenu en messages.
+func (l *Library) render(t *Template, vars Vars) ([]aiyou.Message, error) {
+	data, err := t.bindVars(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	// La fonction role est liée à chaque rendu : elle relève la position des
+	// blocs dans la sortie, sans marqueur que les variables pourraient imiter
+	blocks := &roleBlocks{}
+	l.mu.RLock()
+	root, err := l.root.Clone()
+	l.mu.RUnlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to render template %s: %w", t.ID(), err)
+	}
+	root.Funcs(template.FuncMap{"role": blocks.role})
+	if err := root.ExecuteTemplate(&blocks.out, t.name, data); err != nil {
+		if strings.Contains(err.Error(), "map has no entry for key") {
+			return nil, fmt.Errorf("%w in template %s: %v", ErrMissingVariable, t.ID(), err)
+		}
+		return nil, fmt.Errorf("failed to render template %s: %w", t.ID(), err)
+	}
+
+	messages, err := blocks.messages()
+	if err != nil {
+		return nil, fmt.Errorf("failed to render template %s: %w", t.ID(), err)
+	}
+	l.logger.Infof("Rendered prompt template %s (%d messages)", t.ID(), len(messages))
+	return messages, nil
+}
+
+// unboundRole tient lieu de fonction role à l'analyse des templates ; elle
+// est remplacée par roleBlocks.role à chaque rendu.
+func unboundRole(role string) (string, error) {
+	return "", errors.New("role can only be called while rendering")
+}
+
+// roleBlock est le début d'un bloc de rôle dans le texte rendu.
+type roleBlock struct {
+	role  string
+	start int
+}
+
+// roleBlocks collecte le texte rendu et la position de chaque bloc de rôle.
+type roleBlocks struct {
+	out    strings.Builder
+	blocks []roleBlock
+}
+
+// role implémente la fonction de template role : text/template écrivant la
+// sortie au fil de l'exécution, la longueur courante marque le début du bloc.
+func (b *roleBlocks) role(role string) (string, error) {
+	switch role {
+	case aiyou.RoleSystem, aiyou.RoleUser, aiyou.RoleAssistant:
+		b.blocks = append(b.blocks, roleBlock{role: role, start: b.out.Len()})
+		return "", nil
+	}
+	return "", fmt.Errorf("unsupported role %q", role)
+}
+
+// messages découpe le texte rendu selon les blocs de rôle. Les blocs vides
+// sont ignorés.
+func (b *roleBlocks) messages() ([]aiyou.Message, error) {
+	text := b.out.String()
+	if len(b.blocks) == 0 {
+		return []aiyou.Message{aiyou.NewTextMessage(aiyou.RoleUser, strings.TrimSpace(text))}, nil
+	}
+	if strings.TrimSpace(text[:b.blocks[0].start]) != "" {
+		return nil, errors.New("text found before the first role block")
+	}
+
+	var messages []aiyou.Message
+	for i, block := range b.blocks {
+		end := len(text)
+		if i+1 < len(b.blocks) {
+			end = b.blocks[i+1].start
+		}
+		if content := strings.TrimSpace(text[block.start:end]); content != "" {
+			messages = append(messages, aiyou.NewTextMessage(block.role, content))
+		}
+	}
+	return messages, nil
+}
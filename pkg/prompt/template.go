@@ -0,0 +1,256 @@
+/*
+Copyright (C) 2024 Cloud Temple
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// File: pkg/prompt/template.go
+
+// Package prompt gère des bibliothèques de templates de prompts : variables
+// typées, partials, blocs system/user/assistant rendus en []aiyou.Message et
+// versions tracées dans les logs.
+package prompt
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/chrlesur/aiyou.golib/pkg/aiyou"
+	"gopkg.in/yaml.v3"
+)
+
+// Types de variables déclarables dans l'en-tête d'un template
+const (
+	TypeString = "string"
+	TypeInt    = "int"
+	TypeNumber = "number"
+	TypeBool   = "bool"
+	TypeList   = "list"
+	TypeObject = "object"
+	TypeAny    = "any"
+)
+
+// Erreurs de rendu
+var (
+	ErrMissingVariable = errors.New("missing prompt variable")
+	ErrInvalidVariable = errors.New("invalid prompt variable")
+)
+
+// Vars contient les valeurs des variables d'un template.
+type Vars map[string]interface{}
+
+// Variable décrit une variable déclarée dans l'en-tête d'un template. Une
+// variable est obligatoire sauf si elle a une valeur par défaut ou
+// "required: false".
+type Variable struct {
+	Type        string      `yaml:"type"`
+	Description string      `yaml:"description"`
+	Default     interface{} `yaml:"default"`
+	Required    *bool       `yaml:"required"`
+}
+
+// UnmarshalYAML accepte la forme courte "nom: type" en plus de la forme complète.
+func (v *Variable) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		v.Type = node.Value
+		return nil
+	}
+	type plain Variable
+	return node.Decode((*plain)(v))
+}
+
+// required indique si la variable doit être fournie au rendu.
+func (v Variable) required() bool {
+	if v.Required != nil {
+		return *v.Required
+	}
+	return v.Default == nil
+}
+
+// header est l'en-tête YAML optionnel d'un template, entre deux lignes "---".
+type header struct {
+	Name        string              `yaml:"name"`
+	Version     string              `yaml:"version"`
+	Description string              `yaml:"description"`
+	Variables   map[string]Variable `yaml:"variables"`
+}
+
+// Template est un prompt versionné d'une Library.
+type Template struct {
+	library     *Library
+	name        string
+	version     string
+	description string
+	variables   map[string]Variable
+}
+
+// Name retourne le nom du template.
+func (t *Template) Name() string {
+	return t.name
+}
+
+// Version retourne la version déclarée dans l'en-tête, ou à défaut une
+// empreinte du contenu du template.
+func (t *Template) Version() string {
+	return t.version
+}
+
+// ID retourne l'identifiant "nom@version" du template, à journaliser avec les
+// réponses pour retrouver le prompt qui les a produites.
+func (t *Template) ID() string {
+	return t.name + "@" + t.version
+}
+
+// Description retourne la description déclarée dans l'en-tête.
+func (t *Template) Description() string {
+	return t.description
+}
+
+// Variables retourne les noms des variables déclarées, triés.
+func (t *Template) Variables() []string {
+	names := make([]string, 0, len(t.variables))
+	for name := range t.variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Render rend le template avec vars et retourne ses messages.
+func (t *Template) Render(vars Vars) ([]aiyou.Message, error) {
+	return t.library.render(t, vars)
+}
+
+// parseSource sépare l'en-tête YAML et le corps d'un template.
+func parseSource(source string) (header, string, error) {
+	var h header
+	source = strings.ReplaceAll(source, "\r\n", "\n")
+	if !strings.HasPrefix(source, "---\n") {
+		return h, source, nil
+	}
+	rest := source[len("---"):] + "\n"
+	end := strings.Index(rest, "\n---\n")
+	if end < 0 {
+		return h, "", errors.New("unterminated template header")
+	}
+	if err := yaml.Unmarshal([]byte(rest[:end]), &h); err != nil {
+		return h, "", fmt.Errorf("failed to parse template header: %w", err)
+	}
+	body := strings.TrimSuffix(rest[end+len("\n---\n"):], "\n")
+	for name, v := range h.Variables {
+		if v.Type == "" {
+			v.Type = TypeAny
+			h.Variables[name] = v
+		}
+		if !knownType(v.Type) {
+			return h, "", fmt.Errorf("unknown type %q for variable %q", v.Type, name)
+		}
+	}
+	return h, body, nil
+}
+
+// contentVersion retourne une empreinte courte du source d'un template.
+func contentVersion(source string) string {
+	sum := sha256.Sum256([]byte(source))
+	return "sha256:" + hex.EncodeToString(sum[:6])
+}
+
+// knownType indique si typ est un type de variable connu.
+func knownType(typ string) bool {
+	switch typ {
+	case TypeString, TypeInt, TypeNumber, TypeBool, TypeList, TypeObject, TypeAny:
+		return true
+	}
+	return false
+}
+
+// bindVars vérifie vars au regard des variables déclarées et retourne les
+// données du rendu, complétées des valeurs par défaut.
+func (t *Template) bindVars(vars Vars) (map[string]interface{}, error) {
+	data := make(map[string]interface{}, len(vars)+len(t.variables))
+	for name, value := range vars {
+		data[name] = value
+	}
+
+	for _, name := range t.Variables() {
+		v := t.variables[name]
+		value, ok := data[name]
+		if !ok || value == nil {
+			switch {
+			case v.Default != nil:
+				data[name] = v.Default
+			case v.required():
+				return nil, fmt.Errorf("%w %q in template %s", ErrMissingVariable, name, t.ID())
+			default:
+				data[name] = zeroValue(v.Type)
+			}
+			continue
+		}
+		if !matchesType(value, v.Type) {
+			return nil, fmt.Errorf("%w %q in template %s: expected %s, got %T", ErrInvalidVariable, name, t.ID(), v.Type, value)
+		}
+	}
+	return data, nil
+}
+
+// zeroValue retourne la valeur d'une variable facultative non fournie.
+func zeroValue(typ string) interface{} {
+	switch typ {
+	case TypeString:
+		return ""
+	case TypeInt:
+		return 0
+	case TypeNumber:
+		return 0.0
+	case TypeBool:
+		return false
+	}
+	return nil
+}
+
+// matchesType indique si value est compatible avec le type déclaré typ.
+func matchesType(value interface{}, typ string) bool {
+	kind := reflect.Indirect(reflect.ValueOf(value)).Kind()
+	switch typ {
+	case TypeString:
+		return kind == reflect.String
+	case TypeInt:
+		switch kind {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return true
+		}
+		return false
+	case TypeNumber:
+		switch kind {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			return true
+		}
+		return false
+	case TypeBool:
+		return kind == reflect.Bool
+	case TypeList:
+		return kind == reflect.Slice || kind == reflect.Array
+	case TypeObject:
+		return kind == reflect.Map || kind == reflect.Struct
+	}
+	return true
+}